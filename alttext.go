@@ -0,0 +1,25 @@
+package palapuzzle
+
+import "compress/gzip"
+
+// SetAltText rewrites the puzzle at path, in place, with text as its
+// description for people who cannot see the picture, in an
+// X-Palapuzzle-AltText key of pala.desktop; it is read back into
+// PuzzleInfo.AltText. Palapeli ignores the key. An empty text removes it.
+// SetAltText heeds the writing options (see Option).
+func SetAltText(path, text string, opts ...Option) error {
+	pi, err := ScanPuzzle(path)
+	if err != nil {
+		return err
+	}
+	if pi.desktop == nil {
+		return &Error{"find member pala.desktop in", path, nil}
+	}
+	if text == "" {
+		pi.desktop.remove(mainGroup, altTextKey)
+	} else {
+		pi.desktop.set(mainGroup, altTextKey, escapeValue(text))
+	}
+	return rewritePuzzle(path, path, gzip.DefaultCompression, getOptions(opts),
+		rewriteDesktop(pi.desktop, nil))
+}
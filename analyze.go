@@ -0,0 +1,155 @@
+package palapuzzle
+
+import (
+	"io"
+	"math/rand"
+	"sort"
+)
+
+// A SizeShare describes how much of a puzzle one kind of member accounts for.
+type SizeShare struct {
+	// How many members of this kind there are
+	Members int
+	// Their total size, uncompressed
+	Bytes int64
+	// Roughly how many bytes of the .puzzle file they (and their tar
+	// headers) take up; accurate to a few KiB per member
+	Compressed int64
+}
+
+// A SizeReport attributes the size of a .puzzle file to its parts.
+type SizeReport struct {
+	// The size of the .puzzle file in bytes
+	PuzzleFileSize int64
+	// The preview image (image.jpg), the pieces (N.png), the manifest
+	// (pala.desktop) and any other members
+	Image, Pieces, Desktop, Other SizeShare
+	// Bytes of the file not attributable to any member: gzip framing,
+	// the end of the tar archive and so on
+	Overhead int64
+	// The median size of a piece in bytes
+	MedianPieceSize int64
+	// The names of pieces more than LargePieceFactor times the median size
+	LargePieces []string
+	// An estimate of PuzzleFileSize after OptimizePieces (with the
+	// ReducePalettes option), based on re-encoding a sample of pieces
+	OptimizedSize int64
+}
+
+// LargePieceFactor is how many times the median piece size a piece must be
+// for AnalyzeSize to flag it as anomalously large.
+const LargePieceFactor = 3
+
+// How many pieces AnalyzeSize re-encodes to estimate OptimizedSize.
+const analyzeSampleSize = 32
+
+// AnalyzeSize reads the puzzle at path (or URL, as for ScanPuzzle) and
+// reports what its size is made up of, which pieces are unusually large,
+// and how much OptimizePieces would be likely to save, so that users can
+// decide whether re-encoding is worthwhile before doing it.
+func AnalyzeSize(path string) (*SizeReport, error) {
+	b, name, err := backendFor(path)
+	if err != nil {
+		return nil, &Error{"open", path, err}
+	}
+	f, err := b.Open(name)
+	if err != nil {
+		return nil, &Error{"open", path, err}
+	}
+	defer f.Close()
+	cr := &countingReader{r: f}
+	tr, _, err := openArchive(cr)
+	if err != nil {
+		return nil, &Error{"open archive", path, err}
+	}
+
+	rep := &SizeReport{}
+	type piece struct {
+		name string
+		size int64
+	}
+	var pieces []piece
+	var sample [][]byte // A random sample of the pieces' contents
+	rng := rand.New(rand.NewSource(1))
+	var pos int64 // Compressed bytes consumed up to the previous member
+	for {
+		header, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, &Error{"read archive", path, err}
+		}
+		var share *SizeShare
+		var data []byte
+		switch {
+		case rePieceName.MatchString(header.Name):
+			share = &rep.Pieces
+			pieces = append(pieces, piece{header.Name, header.Size})
+			if len(sample) < analyzeSampleSize {
+				data, err = io.ReadAll(tr)
+				sample = append(sample, data)
+			} else if j := rng.Intn(len(pieces)); j < analyzeSampleSize {
+				data, err = io.ReadAll(tr)
+				sample[j] = data
+			}
+		case header.Name == "image.jpg":
+			share = &rep.Image
+		case header.Name == "pala.desktop":
+			share = &rep.Desktop
+		default:
+			share = &rep.Other
+		}
+		if err == nil && data == nil {
+			_, err = io.Copy(io.Discard, tr)
+		}
+		if err != nil {
+			return nil, &Error{"read member " + header.Name + " of", path, err}
+		}
+		share.Members++
+		share.Bytes += header.Size
+		share.Compressed += cr.n - pos
+		pos = cr.n
+	}
+	if _, err := io.Copy(io.Discard, cr); err != nil {
+		return nil, &Error{"read", path, err}
+	}
+	rep.PuzzleFileSize = cr.n
+	rep.Overhead = cr.n - rep.Image.Compressed - rep.Pieces.Compressed -
+		rep.Desktop.Compressed - rep.Other.Compressed
+
+	if len(pieces) > 0 {
+		sizes := make([]int64, len(pieces))
+		for i, p := range pieces {
+			sizes[i] = p.size
+		}
+		sort.Slice(sizes, func(i, j int) bool { return sizes[i] < sizes[j] })
+		rep.MedianPieceSize = sizes[len(sizes)/2]
+		for _, p := range pieces {
+			if p.size > LargePieceFactor*rep.MedianPieceSize {
+				rep.LargePieces = append(rep.LargePieces, p.name)
+			}
+		}
+	}
+
+	// Well-compressed PNG data hardly compresses further, so assume that
+	// optimized pieces take up as many bytes in the .puzzle file as they
+	// have, unless that is more than they take up now.
+	var before, after int64
+	for _, data := range sample {
+		before += int64(len(data))
+		if better := optimizePNG(data, true); better != nil {
+			after += int64(len(better))
+		} else {
+			after += int64(len(data))
+		}
+	}
+	rep.OptimizedSize = rep.PuzzleFileSize
+	if before > 0 {
+		optimized := int64(float64(rep.Pieces.Bytes) * float64(after) / float64(before))
+		if optimized < rep.Pieces.Compressed {
+			rep.OptimizedSize -= rep.Pieces.Compressed - optimized
+		}
+	}
+	return rep, nil
+}
@@ -0,0 +1,291 @@
+package palapuzzle
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"hash"
+	"io"
+	"io/fs"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// A Backend is somewhere .puzzle files can be stored: a local filesystem, an
+// object store, a remote server and so on. Names are slash-separated paths
+// whose interpretation is up to the Backend.
+type Backend interface {
+	// Open opens the named file for reading.
+	Open(name string) (io.ReadCloser, error)
+	// Stat returns details of the named file.
+	Stat(name string) (fs.FileInfo, error)
+	// List returns details of the files in the named directory, sorted
+	// by name.
+	List(dir string) ([]fs.FileInfo, error)
+	// Write creates or replaces the named file. The new content must not
+	// become visible under that name until the returned writer is closed.
+	// If the writer also has an Abort() error method, that is used to
+	// discard content which should not be kept.
+	Write(name string) (io.WriteCloser, error)
+}
+
+// A remover is a Backend that can also delete files; Local and SFTPBackend
+// are. Functions which need to delete files say what they do without one.
+type remover interface {
+	Remove(name string) error
+}
+
+// An appender is a Backend that can also add to the end of a file, creating
+// it if need be; Local is. The journal is written this way where it can be.
+type appender interface {
+	Append(name string) (io.WriteCloser, error)
+}
+
+// An aborter is a writer from Backend.Write that can discard its content.
+type aborter interface {
+	Abort() error
+}
+
+// abort discards what has been written to w, if it can, or else closes it.
+func abort(w io.WriteCloser) {
+	if a, ok := w.(aborter); ok {
+		a.Abort()
+	} else {
+		w.Close()
+	}
+}
+
+// ScanBackend is like ScanPuzzle, but reads the named file from b.
+func ScanBackend(b Backend, name string, opts ...Option) (*PuzzleInfo, error) {
+	return scanBackend(context.Background(), b, name, getOptions(opts))
+}
+
+// scanBackend does the work of ScanBackend, giving up if ctx is done.
+func scanBackend(ctx context.Context, b Backend, name string, o *options) (*PuzzleInfo, error) {
+	var ret = &PuzzleInfo{}
+
+	f, err := b.Open(name)
+	if err != nil {
+		return nil, &Error{"open", name, err}
+	}
+	defer f.Close()
+	ret.Dir, ret.Filename = splitName(name)
+	if s, ok := f.(interface{ Stat() (fs.FileInfo, error) }); ok {
+		fi, err := s.Stat()
+		if err != nil {
+			return nil, &Error{"examine", name, err} // Should never happen
+		}
+		ret.PuzzleFileSize = fi.Size()
+	} else {
+		fi, err := b.Stat(name)
+		if err != nil {
+			return nil, &Error{"examine", name, err}
+		}
+		ret.PuzzleFileSize = fi.Size()
+	}
+
+	var r io.Reader = f
+	if ctx.Done() != nil {
+		r = ctxReader{ctx, r}
+	}
+	var sum hash.Hash // Of the whole file, under HashMembers
+	if o.hashes {
+		sum = sha256.New()
+		r = io.TeeReader(r, sum)
+	}
+	// If the size is unknown (eg, a chunked HTTP response), count it.
+	var cr *countingReader
+	if ret.PuzzleFileSize < 0 {
+		cr = &countingReader{r: r}
+		r = cr
+	}
+	if err := scanArchive(ctx, r, name, ret, o); err != nil {
+		return nil, err
+	}
+	if (cr != nil || sum != nil) && !o.metadataOnly {
+		_, err := io.Copy(io.Discard, r)
+		if err != nil && !o.salvage() {
+			if ctx.Err() != nil {
+				return nil, ctx.Err()
+			}
+			return nil, &Error{"read", name, err}
+		}
+		if cr != nil {
+			ret.PuzzleFileSize = cr.n
+		}
+		if sum != nil && err == nil {
+			ret.Hashes.File = hex.EncodeToString(sum.Sum(nil))
+		}
+	}
+	return ret, nil
+}
+
+// A ctxReader reads from r until ctx is done.
+type ctxReader struct {
+	ctx context.Context
+	r   io.Reader
+}
+
+func (cr ctxReader) Read(p []byte) (int, error) {
+	if err := cr.ctx.Err(); err != nil {
+		return 0, err
+	}
+	return cr.r.Read(p)
+}
+
+// A countingReader counts the bytes read through it.
+type countingReader struct {
+	r io.Reader
+	n int64
+}
+
+func (cr *countingReader) Read(p []byte) (int, error) {
+	n, err := cr.r.Read(p)
+	cr.n += int64(n)
+	return n, err
+}
+
+// A Collection is a directory of .puzzle files kept in a Backend, such as
+// Palapeli's own collection directory or an archive of backups.
+type Collection struct {
+	Backend Backend // Where the puzzles are kept; nil means Local
+	Dir     string  // Which directory of Backend holds them
+
+	// Whether to record changes made through Import, Remove and Edit in
+	// a journal in Dir, so that they can be undone with Undo
+	KeepJournal bool
+}
+
+func (c *Collection) backend() Backend {
+	if c.Backend == nil {
+		return Local
+	}
+	return c.Backend
+}
+
+// Path returns the Backend name of the named puzzle in c.
+func (c *Collection) Path(name string) string {
+	return path.Join(filepath.ToSlash(c.Dir), name)
+}
+
+// List returns the names of the .puzzle files in c, in sorted order.
+func (c *Collection) List() ([]string, error) {
+	fis, err := c.backend().List(c.Dir)
+	if err != nil {
+		return nil, &Error{"list collection", c.Dir, err}
+	}
+	var names []string
+	for _, fi := range fis {
+		if !fi.IsDir() && strings.HasSuffix(fi.Name(), ".puzzle") {
+			names = append(names, fi.Name())
+		}
+	}
+	sort.Strings(names)
+	return names, nil
+}
+
+// Scan scans every puzzle in c. Puzzles that cannot be scanned are left out
+// of the results and their errors are joined into the returned error.
+func (c *Collection) Scan() ([]*PuzzleInfo, error) {
+	names, err := c.List()
+	if err != nil {
+		return nil, err
+	}
+	var ret []*PuzzleInfo
+	var errs []error
+	for _, name := range names {
+		pi, err := ScanBackend(c.backend(), c.Path(name))
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		ret = append(ret, pi)
+	}
+	return ret, errors.Join(errs...)
+}
+
+// Import copies the .puzzle file src into c, keeping its filename. Src may be
+// a local path or any URL that ScanPuzzle accepts. Import scans src as it
+// copies it, reading it only once, so that only readable puzzles are
+// imported, and will not replace a puzzle already in c. It heeds the DryRun
+// and InTransaction options.
+func (c *Collection) Import(src string, opts ...Option) (*PuzzleInfo, error) {
+	o := getOptions(opts)
+	sb, srcName, err := backendFor(src)
+	if err != nil {
+		return nil, &Error{"open", src, err}
+	}
+	_, name := splitName(srcName)
+	dst := c.Path(name)
+	if _, err := c.backend().Stat(dst); err == nil {
+		return nil, &Error{"import", src, fs.ErrExist}
+	}
+	if o.dryRun != nil {
+		pi, err := ScanBackend(sb, srcName)
+		if err != nil {
+			return nil, err
+		}
+		*o.dryRun = Plan{Files: []FileChange{{dst, "create"}}}
+		pi.Dir, pi.Filename = path.Split(dst)
+		return pi, nil
+	}
+	if o.tx != nil {
+		if err := o.tx.check(dst); err != nil {
+			return nil, &Error{"import", src, err}
+		}
+	}
+	in, err := sb.Open(srcName)
+	if err != nil {
+		return nil, &Error{"open", srcName, err}
+	}
+	defer in.Close()
+	out, err := c.backend().Write(dst)
+	if err != nil {
+		return nil, &Error{"import", src, err}
+	}
+	pi, err := ScanReader(io.TeeReader(in, out), srcName)
+	if err != nil {
+		abort(out)
+		return nil, err
+	}
+	if err := finishWrite(out, dst, o); err != nil {
+		return nil, err
+	}
+	entry := JournalEntry{Op: "import", Name: name}
+	if o.tx != nil {
+		o.tx.afterCommit(func() error { return c.record(entry) })
+	} else if err := c.record(entry); err != nil {
+		return nil, err
+	}
+	pi.Dir, pi.Filename = path.Split(dst)
+	return pi, nil
+}
+
+// copyBetween copies the file src in backend sb to the file dst in db. If tx
+// is not nil, the copy is staged in it rather than put in place.
+func copyBetween(db Backend, dst string, sb Backend, src string, tx *Transaction) error {
+	in, err := sb.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	out, err := db.Write(dst)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(out, in); err != nil {
+		abort(out)
+		return err
+	}
+	if tx != nil {
+		if err := tx.stage(dst, out); err != nil {
+			abort(out)
+			return err
+		}
+		return nil
+	}
+	return out.Close()
+}
@@ -0,0 +1,51 @@
+package palapuzzle
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+
+	"github.com/c12h/palapuzzle/palapuzzletest"
+)
+
+func TestImportURL(t *testing.T) {
+	puzzles := map[string][]byte{
+		"/good.puzzle": palapuzzletest.Bytes(palapuzzletest.Spec{}),
+		"/bad.puzzle":  palapuzzletest.Bytes(palapuzzletest.Spec{Variant: palapuzzletest.CorruptGzip}),
+	}
+	gets := 0
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodGet {
+			gets++
+		}
+		w.Write(puzzles[r.URL.Path])
+	}))
+	defer srv.Close()
+	c := &Collection{Dir: t.TempDir()}
+
+	pi, err := c.Import(srv.URL + "/good.puzzle?download=1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if gets != 1 {
+		t.Errorf("Import fetched the puzzle %d times, want once", gets)
+	}
+	if pi.Filename != "good.puzzle" || pi.PuzzleFileSize != int64(len(puzzles["/good.puzzle"])) {
+		t.Errorf("Import returned Filename %q, PuzzleFileSize %d", pi.Filename, pi.PuzzleFileSize)
+	}
+	if got, _ := os.ReadFile(c.Path("good.puzzle")); !bytes.Equal(got, puzzles["/good.puzzle"]) {
+		t.Error("the imported copy differs from the puzzle served")
+	}
+
+	if _, err := c.Import(srv.URL + "/bad.puzzle"); err == nil {
+		t.Error("Import of a corrupt puzzle succeeded")
+	}
+	if names, _ := c.List(); len(names) != 1 {
+		t.Errorf("after a failed Import, collection has %v", names)
+	}
+	if es, _ := os.ReadDir(c.Dir); len(es) != 1 {
+		t.Errorf("after a failed Import, directory has %v", es)
+	}
+}
@@ -0,0 +1,111 @@
+package palapuzzle
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// backupTimeFormat is the layout of the timestamp in a backup's name. Backups
+// of the same puzzle sort by name in the order they were made.
+const backupTimeFormat = "20060102T150405Z"
+
+// Backup makes functions which modify puzzles first copy each puzzle they are
+// about to replace to <name>.bak-<timestamp>, like
+// "tiger.puzzle.bak-20240131T174502Z", in dir (which must exist) or beside
+// the puzzle, if dir is "". The timestamp is in UTC.
+//
+// If keep > 0, only the newest keep backups of each puzzle are kept, and
+// older ones are deleted as new ones are made; this needs a Backend which can
+// delete files, such as Local. Otherwise backups are never deleted.
+//
+// The backup is made once the new puzzle has been written, just before it
+// replaces the old one; if the backup cannot be made, the puzzle is left as
+// it was.
+func Backup(dir string, keep int) Option {
+	return func(o *options) {
+		o.backup, o.backupDir, o.backupKeep = true, dir, keep
+	}
+}
+
+// A backupPlan is a backup that is to be made.
+type backupPlan struct {
+	b     Backend
+	name  string   // The file to back up
+	bak   string   // The backup
+	prune []string // Old backups to delete
+}
+
+// planBackup works out how to back up the named file in b before it is
+// replaced, if o asks for that. It returns nil if there is nothing to do.
+func planBackup(b Backend, name string, o *options) (*backupPlan, error) {
+	if !o.backup {
+		return nil, nil
+	}
+	if _, err := b.Stat(name); errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	dir, base := path.Split(filepath.ToSlash(name))
+	if o.backupDir != "" {
+		dir = filepath.ToSlash(o.backupDir)
+	}
+	if dir == "" {
+		dir = "."
+	}
+	prefix := base + ".bak-"
+	bp := &backupPlan{b: b, name: name}
+	stamp := prefix + time.Now().UTC().Format(backupTimeFormat)
+	bp.bak = path.Join(dir, stamp)
+	for i := 2; ; i++ {
+		if _, err := b.Stat(bp.bak); err != nil {
+			break
+		}
+		bp.bak = path.Join(dir, fmt.Sprintf("%s-%d", stamp, i))
+	}
+
+	if _, ok := b.(remover); !ok || o.backupKeep <= 0 {
+		return bp, nil
+	}
+	fis, err := b.List(dir)
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return nil, err
+	}
+	var old []string
+	for _, fi := range fis {
+		if strings.HasPrefix(fi.Name(), prefix) && fi.Mode().IsRegular() {
+			old = append(old, path.Join(dir, fi.Name()))
+		}
+	}
+	if n := len(old) + 1 - o.backupKeep; n > 0 {
+		bp.prune = old[:n]
+	}
+	return bp, nil
+}
+
+// run makes the backup and deletes the old ones.
+func (bp *backupPlan) run() error {
+	if err := copyBetween(bp.b, bp.bak, bp.b, bp.name, nil); err != nil {
+		return err
+	}
+	for _, name := range bp.prune {
+		if err := bp.b.(remover).Remove(name); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// changes describes what run would do, for a Plan.
+func (bp *backupPlan) changes() []FileChange {
+	ret := []FileChange{{bp.bak, "create"}}
+	for _, name := range bp.prune {
+		ret = append(ret, FileChange{name, "remove"})
+	}
+	return ret
+}
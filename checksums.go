@@ -0,0 +1,138 @@
+package palapuzzle
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"crypto/sha256"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+)
+
+// checksumsMember is the name of the member which lists the SHA-256 sums of
+// the others, as WriteChecksums writes it.
+const checksumsMember = "CHECKSUMS"
+
+// A checksums is the content of a CHECKSUMS member, being checked against
+// the members after it as a puzzle is scanned.
+type checksums struct {
+	want    map[string]string // Lower-case hex SHA-256 sums, by member
+	names   []string          // The members listed, in order
+	checked map[string]bool   // Those already found
+}
+
+// parseChecksums reads data, the content of a CHECKSUMS member, in the
+// format of sha256sum: a sum in hex, a space, a space or "*", and a member's
+// name, on each line. It also returns how many lines are not like that.
+func parseChecksums(data []byte) (*checksums, int) {
+	cs := &checksums{want: make(map[string]string), checked: make(map[string]bool)}
+	bad := 0
+	for _, line := range strings.Split(string(data), "\n") {
+		line = strings.TrimSuffix(line, "\r")
+		if line == "" {
+			continue
+		}
+		if len(line) < 2*sha256.Size+3 || line[2*sha256.Size] != ' ' ||
+			(line[2*sha256.Size+1] != ' ' && line[2*sha256.Size+1] != '*') {
+			bad++
+			continue
+		}
+		sum, name := strings.ToLower(line[:2*sha256.Size]), line[2*sha256.Size+2:]
+		if strings.Trim(sum, "0123456789abcdef") != "" {
+			bad++
+			continue
+		}
+		if _, ok := cs.want[name]; !ok {
+			cs.names = append(cs.names, name)
+		}
+		cs.want[name] = sum
+	}
+	return cs, bad
+}
+
+// WriteChecksums rewrites the puzzle at path, in place, with a CHECKSUMS
+// member listing the SHA-256 sum of every other member (but SIGNATURE; see
+// Sign), in the format of sha256sum, so that copies of it (on a mirror,
+// say) can be checked: every function which scans puzzles checks the
+// members against it, and warns of any that differ with WarnChecksum. The
+// member comes first, where the scan finds it before the members it lists.
+// Any old CHECKSUMS member is replaced, and the other members are copied
+// unchanged.
+//
+// Other functions which rewrite puzzles keep CHECKSUMS as it is, so after
+// (say) UpgradePuzzle, WriteChecksums needs calling again. WriteChecksums
+// heeds the writing options (see Option).
+func WriteChecksums(path string, opts ...Option) error {
+	list, err := memberSums(path)
+	if err != nil {
+		return err
+	}
+	return writeFirstMember(path, checksumsMember, list, getOptions(opts))
+}
+
+// memberSums returns the SHA-256 sum of every member of the puzzle at path
+// but CHECKSUMS and SIGNATURE, as lines in the format of sha256sum.
+func memberSums(path string) ([]byte, error) {
+	var list bytes.Buffer
+	err := walkPuzzle(path, func(hdr *tar.Header, r io.Reader) error {
+		if hdr.Name == checksumsMember || hdr.Name == signatureMember || hdr.Typeflag != tar.TypeReg {
+			return nil
+		}
+		sum := sha256.New()
+		if _, err := io.Copy(sum, r); err != nil {
+			return &Error{"read member " + hdr.Name + " of", path, err}
+		}
+		fmt.Fprintf(&list, "%x  %s\n", sum.Sum(nil), hdr.Name)
+		return nil
+	})
+	return list.Bytes(), err
+}
+
+// writeFirstMember rewrites the puzzle at path, in place, with a member of
+// the given name and content first, in place of any it already has; the
+// other members are copied unchanged.
+func writeFirstMember(path, name string, data []byte, o *options) error {
+	return writePuzzle(path, gzip.DefaultCompression, o,
+		func() ([]memberSummary, error) { return summarize(path) },
+		func(out io.Writer, level int, o *options) error {
+			return writeFirstTo(out, path, name, data, level, o)
+		})
+}
+
+// writeFirstTo does the work of writeFirstMember, writing to out.
+func writeFirstTo(out io.Writer, path, name string, data []byte, level int, o *options) error {
+	zw, err := newGzipWriter(out, level, o)
+	if err != nil {
+		return &Error{"create", path, err}
+	}
+	tw := tar.NewWriter(zw)
+	tmpl := &tar.Header{Typeflag: tar.TypeReg, Mode: 0644, ModTime: time.Now()}
+	err = writeMember(tw, name, data, tmpl)
+	if err != nil {
+		err = &Error{"write member " + name + " of", path, err}
+	} else {
+		err = walkPuzzle(path, func(hdr *tar.Header, r io.Reader) error {
+			if hdr.Name == name {
+				return nil
+			}
+			if err := copyMember(hdr, r, tw); err != nil {
+				return &Error{"rewrite member " + hdr.Name + " of", path, err}
+			}
+			return nil
+		})
+	}
+	if err != nil {
+		zw.Close() // Stop any goroutines; output is discarded anyway
+		return err
+	}
+	if err := tw.Close(); err != nil {
+		zw.Close()
+		return &Error{"write", path, err}
+	}
+	if err := zw.Close(); err != nil {
+		return &Error{"write", path, err}
+	}
+	return nil
+}
@@ -0,0 +1,238 @@
+package palapuzzle
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// CollectionEnv is the environment variable which, if set, names the
+// collection directory to use instead of any that DiscoverInstallations
+// finds or the configuration file names.
+const CollectionEnv = "PALAPUZZLE_COLLECTION"
+
+// A Config holds the settings from this package's configuration file. Zero
+// values mean that a setting was not made.
+//
+// The file is in a small subset of TOML: comments, [sections], and
+// key = value lines, where a value is a quoted string or an integer. For
+// example:
+//
+//	collection = "/mnt/nas/puzzles"  # Instead of Palapeli's own
+//
+//	[compression]
+//	level = 9       # 1 to 9, for functions which use the default level
+//	parallel = 4    # As for the Parallel option; -1 means one per CPU
+//
+//	[limits]
+//	max_download_size = 104857600   # Bytes, for DefaultHTTPBackend
+//	download_timeout = "2m"         # As for time.ParseDuration
+//	max_bytes = 8_589_934_592       # For DefaultLimits.MaxBytes
+//	max_members = -1                # Negative means no limit
+//
+// The other scan limits are max_piece_index, max_desktop_size and
+// max_member_size, each for the field of DefaultLimits of that name.
+type Config struct {
+	Path             string        // The file read, or "" if there was none
+	Collection       string        // The collection directory
+	CompressionLevel int           // See the CompressionLevel option
+	Parallel         int           // See the Parallel option
+	MaxDownloadSize  int64         // For DefaultHTTPBackend.MaxSize
+	DownloadTimeout  time.Duration // For DefaultHTTPBackend.Timeout
+	// For the fields of DefaultLimits; here a negative field means no
+	// limit, as zero means the setting was not made
+	Limits Limits
+}
+
+// ConfigPath returns where LoadConfig looks for the configuration file:
+// palapuzzle/config.toml in os.UserConfigDir(), which on Linux is usually
+// ~/.config.
+func ConfigPath() (string, error) {
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "palapuzzle", "config.toml"), nil
+}
+
+// LoadConfig reads the configuration file, if there is one, and applies the
+// PALAPUZZLE_COLLECTION environment variable, which overrides the file's
+// collection setting. A missing file is not an error. Programs using this
+// package should call it at start-up, then Apply the result and pass its
+// Options to the functions they call.
+func LoadConfig() (*Config, error) {
+	c := &Config{}
+	if p, err := ConfigPath(); err == nil {
+		data, err := os.ReadFile(p)
+		switch {
+		case err == nil:
+			if c, err = ParseConfig(data, p); err != nil {
+				return nil, err
+			}
+		case !errors.Is(err, fs.ErrNotExist):
+			return nil, &Error{"read", p, err}
+		}
+	}
+	if dir := os.Getenv(CollectionEnv); dir != "" {
+		c.Collection = dir
+	}
+	return c, nil
+}
+
+// ParseConfig parses the contents of a configuration file; path is only used
+// in error messages and to set Config.Path.
+func ParseConfig(data []byte, path string) (*Config, error) {
+	c := &Config{Path: path}
+	section := ""
+	sc := bufio.NewScanner(bytes.NewReader(data))
+	for n := 1; sc.Scan(); n++ {
+		line := strings.TrimSpace(stripComment(sc.Text()))
+		if line == "" {
+			continue
+		}
+		if strings.HasPrefix(line, "[") && strings.HasSuffix(line, "]") {
+			section = strings.TrimSpace(line[1 : len(line)-1])
+			continue
+		}
+		key, value, ok := strings.Cut(line, "=")
+		if !ok {
+			return nil, &Error{fmt.Sprintf("parse line %d of", n), path, errors.New("not key = value")}
+		}
+		key = strings.TrimSpace(key)
+		if section != "" {
+			key = section + "." + key
+		}
+		if err := c.set(key, strings.TrimSpace(value)); err != nil {
+			return nil, &Error{fmt.Sprintf("parse line %d of", n), path, err}
+		}
+	}
+	if err := sc.Err(); err != nil {
+		return nil, &Error{"read", path, err}
+	}
+	return c, nil
+}
+
+// set sets the setting key (with its section, like "limits.download_timeout")
+// to the TOML value.
+func (c *Config) set(key, value string) error {
+	var err error
+	switch key {
+	case "collection":
+		c.Collection, err = tomlString(value)
+	case "compression.level":
+		c.CompressionLevel, err = strconv.Atoi(value)
+		if err == nil && (c.CompressionLevel < 1 || c.CompressionLevel > 9) {
+			err = errors.New("compression level must be from 1 to 9")
+		}
+	case "compression.parallel":
+		c.Parallel, err = strconv.Atoi(value)
+	case "limits.max_download_size":
+		c.MaxDownloadSize, err = tomlInt(value)
+	case "limits.max_bytes":
+		c.Limits.MaxBytes, err = tomlInt(value)
+	case "limits.max_members":
+		var n int64
+		n, err = tomlInt(value)
+		c.Limits.MaxMembers = int(n)
+	case "limits.max_piece_index":
+		var n int64
+		n, err = tomlInt(value)
+		c.Limits.MaxPieceIndex = int(n)
+	case "limits.max_desktop_size":
+		c.Limits.MaxDesktopSize, err = tomlInt(value)
+	case "limits.max_member_size":
+		c.Limits.MaxMemberSize, err = tomlInt(value)
+	case "limits.download_timeout":
+		var s string
+		if s, err = tomlString(value); err == nil {
+			c.DownloadTimeout, err = time.ParseDuration(s)
+		}
+	default:
+		err = fmt.Errorf("unknown setting %q", key)
+	}
+	return err
+}
+
+// stripComment removes any comment from a line of TOML.
+func stripComment(line string) string {
+	var quote rune // The quote of the string we are in, if any
+	for i, r := range line {
+		switch {
+		case quote != 0:
+			if r == quote && (quote == '\'' || line[i-1] != '\\') {
+				quote = 0
+			}
+		case r == '"' || r == '\'':
+			quote = r
+		case r == '#':
+			return line[:i]
+		}
+	}
+	return line
+}
+
+// tomlInt decodes a TOML integer, which may have underscores between
+// digits.
+func tomlInt(value string) (int64, error) {
+	return strconv.ParseInt(strings.ReplaceAll(value, "_", ""), 10, 64)
+}
+
+// tomlString decodes a TOML basic ("...") or literal ('...') string.
+func tomlString(value string) (string, error) {
+	if len(value) >= 2 && value[0] == '\'' && value[len(value)-1] == '\'' {
+		return value[1 : len(value)-1], nil
+	}
+	s, err := strconv.Unquote(value)
+	if err != nil || !strings.HasPrefix(value, `"`) {
+		return "", fmt.Errorf("bad string %s", value)
+	}
+	return s, nil
+}
+
+// Apply makes the settings of c which concern package variables, namely the
+// limits on downloads and DefaultLimits, take effect.
+func (c *Config) Apply() {
+	if c.MaxDownloadSize != 0 {
+		DefaultHTTPBackend.MaxSize = c.MaxDownloadSize
+	}
+	if c.DownloadTimeout != 0 {
+		DefaultHTTPBackend.Timeout = c.DownloadTimeout
+	}
+	l := &DefaultLimits
+	l.MaxBytes = configLimit(c.Limits.MaxBytes, l.MaxBytes)
+	l.MaxMembers = int(configLimit(int64(c.Limits.MaxMembers), int64(l.MaxMembers)))
+	l.MaxPieceIndex = int(configLimit(int64(c.Limits.MaxPieceIndex), int64(l.MaxPieceIndex)))
+	l.MaxDesktopSize = configLimit(c.Limits.MaxDesktopSize, l.MaxDesktopSize)
+	l.MaxMemberSize = configLimit(c.Limits.MaxMemberSize, l.MaxMemberSize)
+}
+
+// configLimit returns what a limit, now cur, becomes under the setting set:
+// cur if set is zero (not made), no limit (zero) if it is negative.
+func configLimit(set, cur int64) int64 {
+	switch {
+	case set > 0:
+		return set
+	case set < 0:
+		return 0
+	}
+	return cur
+}
+
+// Options returns the Options that c's settings call for.
+func (c *Config) Options() []Option {
+	var ret []Option
+	if c.CompressionLevel != 0 {
+		ret = append(ret, CompressionLevel(c.CompressionLevel))
+	}
+	if c.Parallel != 0 {
+		ret = append(ret, Parallel(c.Parallel))
+	}
+	return ret
+}
@@ -0,0 +1,34 @@
+package palapuzzle
+
+import "testing"
+
+func TestConfigScanLimits(t *testing.T) {
+	c, err := ParseConfig([]byte(`
+[limits]
+max_download_size = 1_000
+max_bytes = 8_589_934_592
+max_members = -1
+max_piece_index = 5000
+max_desktop_size = 65536
+`), "config.toml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := Limits{MaxBytes: 8 << 30, MaxMembers: -1, MaxPieceIndex: 5000, MaxDesktopSize: 64 << 10}
+	if c.Limits != want || c.MaxDownloadSize != 1000 {
+		t.Fatalf("Limits = %+v, MaxDownloadSize = %d", c.Limits, c.MaxDownloadSize)
+	}
+
+	saved, savedHTTP := DefaultLimits, DefaultHTTPBackend.MaxSize
+	defer func() { DefaultLimits, DefaultHTTPBackend.MaxSize = saved, savedHTTP }()
+	c.Apply()
+	want = Limits{MaxBytes: 8 << 30, MaxMembers: 0, MaxPieceIndex: 5000, MaxDesktopSize: 64 << 10,
+		MaxMemberSize: saved.MaxMemberSize}
+	if DefaultLimits != want {
+		t.Errorf("DefaultLimits = %+v, want %+v", DefaultLimits, want)
+	}
+
+	if _, err := ParseConfig([]byte("[limits]\nmax_members = lots\n"), "config.toml"); err == nil {
+		t.Error("no error for a bad limit")
+	}
+}
@@ -0,0 +1,199 @@
+package palapuzzle
+
+import (
+	"image"
+	"image/color"
+	"sort"
+)
+
+// A Region is a connected area of a puzzle's image.
+type Region struct {
+	Bounds image.Rectangle // The smallest rectangle containing the region
+	Pixels int             // How many pixels are in it
+}
+
+// A CoverageReport says how completely the pieces of a puzzle tile its image.
+type CoverageReport struct {
+	// The image area: the size of image.jpg if the puzzle has a readable
+	// one, or else the area spanned by the pieces
+	Area image.Rectangle
+	// How many pixels of Area are not covered by any piece
+	Uncovered int
+	// The largest uncovered regions, biggest first; at most
+	// MaxCoverageRegions of them
+	Regions []Region
+}
+
+// MaxCoverageRegions limits how many uncovered regions CheckCoverage lists.
+const MaxCoverageRegions = 100
+
+// coverageAlpha is how opaque (out of 255) a pixel must be, counting all
+// the pieces drawn on it, to be covered. Pieces' anti-aliased edges are
+// partly transparent, but should add up to more than this where they meet.
+const coverageAlpha = 128
+
+// CheckCoverage composites the alpha masks of the pieces of the puzzle at
+// path at their offsets and reports any parts of the image that no piece
+// covers. Those are usually a slicer bug: a sliver of the picture missing
+// from every piece.
+func CheckCoverage(path string) (*CoverageReport, error) {
+	pc, err := readContent(path)
+	if err != nil {
+		return nil, err
+	}
+	area, err := pc.bounds()
+	if err != nil {
+		return nil, &Error{"check coverage of", path, err}
+	}
+	if pc.imageOK {
+		area = pc.imageBox
+	}
+
+	w, h := area.Dx(), area.Dy()
+	alpha := make([]uint16, w*h)
+	pc.eachPixel(area, func(n, i int, a uint8) {
+		alpha[i] += uint16(a)
+	})
+
+	rep := &CoverageReport{Area: area}
+	uncovered := make([]bool, w*h)
+	for i, a := range alpha {
+		if a < coverageAlpha {
+			uncovered[i] = true
+			rep.Uncovered++
+		}
+	}
+	rep.Regions = regions(uncovered, w, h, area.Min)
+	if len(rep.Regions) > MaxCoverageRegions {
+		rep.Regions = rep.Regions[:MaxCoverageRegions]
+	}
+	return rep, nil
+}
+
+// eachPixel calls fn for every pixel of every piece (in order of piece
+// number) that falls within area, with the piece number, the index of the
+// pixel in a row-major bitmap of area and the pixel's alpha value.
+func (pc *puzzleContent) eachPixel(area image.Rectangle, fn func(n, i int, a uint8)) {
+	w, h := area.Dx(), area.Dy()
+	nums := make([]int, 0, len(pc.pieces))
+	for n := range pc.pieces {
+		nums = append(nums, n)
+	}
+	sort.Ints(nums)
+	for _, n := range nums {
+		img := pc.pieces[n]
+		b := img.Bounds()
+		off := pc.offsets[n].Sub(b.Min).Sub(area.Min)
+		for y := b.Min.Y; y < b.Max.Y; y++ {
+			for x := b.Min.X; x < b.Max.X; x++ {
+				px, py := x+off.X, y+off.Y
+				if px < 0 || py < 0 || px >= w || py >= h {
+					continue
+				}
+				a := color.NRGBAModel.Convert(img.At(x, y)).(color.NRGBA).A
+				fn(n, py*w+px, a)
+			}
+		}
+	}
+}
+
+// An Overlap describes two pieces whose opaque parts overlap.
+type Overlap struct {
+	A, B   int             // The pieces' numbers, A < B
+	Bounds image.Rectangle // The smallest rectangle containing the overlap
+	Pixels int             // How many pixels both pieces cover
+}
+
+// CheckOverlaps reports pairs of pieces of the puzzle at path whose fully
+// opaque pixels overlap, at their offsets, in more than tolerance pixels.
+// Pieces' interlocking tabs and blanks meet along anti-aliased (so partly
+// transparent) edges and should not overlap at all, so small tolerances are
+// enough; a piece whose offset is wrong by even one pixel will typically
+// overlap each neighbour along the whole of their common edge.
+//
+// The overlaps are listed biggest first.
+func CheckOverlaps(path string, tolerance int) ([]Overlap, error) {
+	pc, err := readContent(path)
+	if err != nil {
+		return nil, err
+	}
+	area, err := pc.bounds()
+	if err != nil {
+		return nil, &Error{"check overlaps of", path, err}
+	}
+
+	w := area.Dx()
+	owner := make([]int32, w*area.Dy())
+	for i := range owner {
+		owner[i] = -1
+	}
+	pairs := make(map[[2]int]*Overlap)
+	pc.eachPixel(area, func(n, i int, a uint8) {
+		if a != 255 {
+			return
+		}
+		if owner[i] < 0 {
+			owner[i] = int32(n)
+			return
+		}
+		key := [2]int{int(owner[i]), n}
+		ov := pairs[key]
+		if ov == nil {
+			ov = &Overlap{A: key[0], B: key[1]}
+			pairs[key] = ov
+		}
+		x, y := area.Min.X+i%w, area.Min.Y+i/w
+		ov.Bounds = ov.Bounds.Union(image.Rect(x, y, x+1, y+1))
+		ov.Pixels++
+	})
+
+	var ret []Overlap
+	for _, ov := range pairs {
+		if ov.Pixels > tolerance {
+			ret = append(ret, *ov)
+		}
+	}
+	sort.Slice(ret, func(i, j int) bool {
+		if ret[i].Pixels != ret[j].Pixels {
+			return ret[i].Pixels > ret[j].Pixels
+		}
+		return ret[i].A < ret[j].A || ret[i].A == ret[j].A && ret[i].B < ret[j].B
+	})
+	return ret, nil
+}
+
+// regions finds the 4-connected regions of set pixels in a w×h bitmap
+// whose top left corner is at origin, and returns them biggest first.
+func regions(set []bool, w, h int, origin image.Point) []Region {
+	var ret []Region
+	seen := make([]bool, len(set))
+	var stack []int
+	for start := range set {
+		if !set[start] || seen[start] {
+			continue
+		}
+		r := Region{Bounds: image.Rect(start%w, start/w, start%w+1, start/w+1)}
+		seen[start] = true
+		stack = append(stack[:0], start)
+		for len(stack) > 0 {
+			i := stack[len(stack)-1]
+			stack = stack[:len(stack)-1]
+			x, y := i%w, i/w
+			r.Pixels++
+			r.Bounds = r.Bounds.Union(image.Rect(x, y, x+1, y+1))
+			for _, j := range [4]int{i - w, i + w, i - 1, i + 1} {
+				if j < 0 || j >= len(set) || (j == i-1 && x == 0) || (j == i+1 && x == w-1) {
+					continue
+				}
+				if set[j] && !seen[j] {
+					seen[j] = true
+					stack = append(stack, j)
+				}
+			}
+		}
+		r.Bounds = r.Bounds.Add(origin)
+		ret = append(ret, r)
+	}
+	sort.SliceStable(ret, func(i, j int) bool { return ret[i].Pixels > ret[j].Pixels })
+	return ret
+}
@@ -0,0 +1,162 @@
+package palapuzzle
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"image"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// A NewPuzzle describes a puzzle for WritePuzzle to create. Its pieces are
+// supplied one at a time, so that puzzles far too big to hold in memory
+// (10,000 pieces, say) can be written.
+type NewPuzzle struct {
+	Title   string
+	Author  string
+	Comment string
+	AltText string // See SetAltText
+	// How many pieces there are, numbered from 0
+	Pieces int
+	// Piece is called for each piece in turn, for the content of its N.png
+	// file and where its top-left corner goes in the solved puzzle. If the
+	// reader is also an io.Closer, it is closed once read.
+	Piece func(n int) (png io.Reader, offset image.Point, err error)
+	// Image, if not nil, is called once for the content of image.jpg;
+	// without it the puzzle has no image.jpg (see SlimPuzzle)
+	Image func() (io.Reader, error)
+}
+
+// WritePuzzle writes the puzzle np describes to dst, in the layout of
+// FormatModern. The image and pieces are written first, as they are
+// supplied, and pala.desktop last, once every piece's offset is known.
+//
+// Memory use does not grow with the size of the puzzle's pictures: only
+// one piece (or the image) is held at a time, as it was supplied, because a
+// tarball needs each member's size before its content. Beyond that there is
+// about 20 bytes per piece for pala.desktop, and the compressor's state:
+// about 1MB, or 3MB per goroutine under the Parallel option. So a
+// 10,000-piece puzzle with pieces of 10KB or so is written in a few MB
+// (about 12MB with Parallel(4)). WritePuzzle heeds the writing options (see
+// Option).
+func WritePuzzle(dst string, np *NewPuzzle, opts ...Option) error {
+	if np.Pieces <= 0 {
+		return &Error{"create", dst, fmt.Errorf("a puzzle needs pieces, not %d", np.Pieces)}
+	}
+	return writePuzzle(dst, gzip.DefaultCompression, getOptions(opts),
+		func() ([]memberSummary, error) { return summarizeExisting(dst) },
+		func(out io.Writer, level int, o *options) error {
+			return np.writeTo(out, dst, level, o)
+		})
+}
+
+// summarizeExisting is summarize for a new puzzle's dst, which there may
+// be nothing at yet to compare with in a dry run.
+func summarizeExisting(dst string) ([]memberSummary, error) {
+	if b, name, err := backendFor(dst); err == nil {
+		if _, err := b.Stat(name); err != nil {
+			return nil, nil // Nothing to compare with
+		}
+	}
+	return summarize(dst)
+}
+
+// writeTo does the work of WritePuzzle, writing to out; dst is only used in
+// error messages.
+func (np *NewPuzzle) writeTo(out io.Writer, dst string, level int, o *options) error {
+	zw, err := newGzipWriter(out, level, o)
+	if err != nil {
+		return &Error{"create", dst, err}
+	}
+	tw := tar.NewWriter(zw)
+	if err := np.writeMembers(tw, dst); err != nil {
+		zw.Close() // Stop any goroutines; output is discarded anyway
+		return err
+	}
+	if err := tw.Close(); err != nil {
+		zw.Close()
+		return &Error{"write", dst, err}
+	}
+	if err := zw.Close(); err != nil {
+		return &Error{"write", dst, err}
+	}
+	return nil
+}
+
+// writeMembers writes the members of the puzzle to tw.
+func (np *NewPuzzle) writeMembers(tw *tar.Writer, dst string) error {
+	tmpl := &tar.Header{Typeflag: tar.TypeReg, Mode: 0644, ModTime: time.Now()}
+	var buf bytes.Buffer // Reused for every member, so never bigger than the biggest
+	member := func(name string, r io.Reader) error {
+		buf.Reset()
+		_, err := buf.ReadFrom(r)
+		if c, ok := r.(io.Closer); ok {
+			if cerr := c.Close(); err == nil {
+				err = cerr
+			}
+		}
+		if err != nil {
+			return &Error{"read member " + name + " for", dst, err}
+		}
+		if err := writeMember(tw, name, buf.Bytes(), tmpl); err != nil {
+			return &Error{"write member " + name + " of", dst, err}
+		}
+		return nil
+	}
+
+	if np.Image != nil {
+		r, err := np.Image()
+		if err != nil {
+			return &Error{"get member image.jpg for", dst, err}
+		}
+		if err := member("image.jpg", r); err != nil {
+			return err
+		}
+	}
+	offsets := make([]image.Point, np.Pieces)
+	for n := 0; n < np.Pieces; n++ {
+		name := strconv.Itoa(n) + ".png"
+		r, off, err := np.Piece(n)
+		if err != nil {
+			return &Error{"get member " + name + " for", dst, err}
+		}
+		if err := member(name, r); err != nil {
+			return err
+		}
+		offsets[n] = off
+	}
+
+	d := newDesktop(Metadata{np.Title, np.Author, np.Comment, np.AltText}, offsets)
+	if err := writeMember(tw, "pala.desktop", d, tmpl); err != nil {
+		return &Error{"write member pala.desktop of", dst, err}
+	}
+	return nil
+}
+
+// newDesktop returns the content of pala.desktop for a new puzzle with the
+// given metadata, whose piece N goes at offsets[N].
+func newDesktop(m Metadata, offsets []image.Point) []byte {
+	var d strings.Builder
+	fmt.Fprintf(&d, "[%s]\n", mainGroup)
+	for _, kv := range [][2]string{
+		{"Comment", m.Comment},
+		{"Name", m.Title},
+		{"Type", "X-Palapeli-Puzzle"},
+		{"X-KDE-PluginInfo-Author", m.Author},
+		{altTextKey, m.AltText},
+	} {
+		if kv[1] != "" || kv[0] == "Name" {
+			fmt.Fprintf(&d, "%s=%s\n", kv[0], escapeValue(kv[1]))
+		}
+	}
+	fmt.Fprintf(&d, "\n[%s]\n", offsetsGroup)
+	for n, off := range offsets {
+		fmt.Fprintf(&d, "%d=%d,%d\n", n, off.X, off.Y)
+	}
+	fmt.Fprintf(&d, "\n[%s]\nPieceCount=%d\n", slicerGroup, len(offsets))
+	return []byte(d.String())
+}
@@ -0,0 +1,67 @@
+package palapuzzle
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"image/draw"
+	"image/png"
+	"io"
+	"path/filepath"
+	"testing"
+)
+
+// benchPieces is how many pieces the benchmarks write: as many as the
+// biggest puzzles in the wild.
+const benchPieces = 10000
+
+// benchPiece returns the content of a small piece, for the benchmarks.
+func benchPiece(b *testing.B) []byte {
+	img := image.NewNRGBA(image.Rect(0, 0, 32, 32))
+	draw.Draw(img, img.Bounds(), image.NewUniform(color.NRGBA{200, 100, 50, 255}), image.Point{}, draw.Src)
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, img); err != nil {
+		b.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+// BenchmarkWritePuzzle writes a 10,000-piece puzzle. What it allocates per
+// write (a few MB, mostly tar headers and pala.desktop) should grow with
+// the number of pieces, but not with their size.
+func BenchmarkWritePuzzle(b *testing.B) {
+	piece := benchPiece(b)
+	dst := filepath.Join(b.TempDir(), "big.puzzle")
+	np := &NewPuzzle{
+		Title:  "Benchmark",
+		Pieces: benchPieces,
+		Piece: func(n int) (io.Reader, image.Point, error) {
+			return bytes.NewReader(piece), image.Pt(n%100*32, n/100*32), nil
+		},
+	}
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if err := WritePuzzle(dst, np, CompressionLevel(1)); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+// BenchmarkPuzzleWriter is like BenchmarkWritePuzzle, for a PuzzleWriter.
+func BenchmarkPuzzleWriter(b *testing.B) {
+	piece := benchPiece(b)
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		pw := NewWriter(io.Discard, CompressionLevel(1))
+		for n := 0; n < benchPieces; n++ {
+			if err := pw.AddPiece(n, bytes.NewReader(piece), image.Pt(n%100*32, n/100*32)); err != nil {
+				b.Fatal(err)
+			}
+		}
+		if err := pw.Close(); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
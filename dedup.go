@@ -0,0 +1,57 @@
+package palapuzzle
+
+import (
+	"archive/tar"
+	"crypto/sha256"
+	"io"
+)
+
+// A DuplicateGroup is a set of members of a puzzle with identical content.
+type DuplicateGroup struct {
+	Names []string // The members' names, in archive order
+	Size  int64    // The size of each member in bytes
+}
+
+// FindDuplicates reads the .puzzle file fs (a path or URL, as for
+// ScanPuzzle) and returns the groups of regular members whose content is
+// identical, as determined by SHA-256 hashes, in order of first appearance.
+// Some slicers emit many identical blank or duplicate pieces.
+//
+// Savings is how many bytes of uncompressed content would be saved by storing
+// each group's content only once. The saving in the size of the .puzzle file
+// is usually smaller, since gzip already finds repeats that are within 32KiB
+// of each other. This package does not write hard-link members to achieve
+// such savings, because Palapeli may not follow them.
+func FindDuplicates(fs string) (groups []DuplicateGroup, savings int64, err error) {
+	seen := make(map[[sha256.Size]byte]int) // Hash => index in groups
+	var all []DuplicateGroup
+	err = walkPuzzle(fs, func(hdr *tar.Header, r io.Reader) error {
+		if hdr.Typeflag != tar.TypeReg {
+			return nil
+		}
+		h := sha256.New()
+		n, err := io.Copy(h, r)
+		if err != nil {
+			return &Error{"read member " + hdr.Name + " of", fs, err}
+		}
+		var sum [sha256.Size]byte
+		copy(sum[:], h.Sum(nil))
+		if i, ok := seen[sum]; ok {
+			all[i].Names = append(all[i].Names, hdr.Name)
+			return nil
+		}
+		seen[sum] = len(all)
+		all = append(all, DuplicateGroup{[]string{hdr.Name}, n})
+		return nil
+	})
+	if err != nil {
+		return nil, 0, err
+	}
+	for _, g := range all {
+		if len(g.Names) > 1 {
+			groups = append(groups, g)
+			savings += int64(len(g.Names)-1) * g.Size
+		}
+	}
+	return groups, savings, nil
+}
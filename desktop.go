@@ -0,0 +1,290 @@
+package palapuzzle
+
+import (
+	"bytes"
+	"image"
+	"strconv"
+	"strings"
+)
+
+// Groups and keys of pala.desktop which this package reads or writes.
+const (
+	mainGroup    = "Desktop Entry" // Name, Comment, author and so on
+	offsetsGroup = "PieceOffsets"  // N=x,y for each piece
+	jobGroup     = "Job"           // How the puzzle was made: Image, Slicer, SlicerMode
+	slimKey      = "X-Palapuzzle-Slim"
+	rebuiltKey   = "X-Palapuzzle-ImageRebuilt"
+	altTextKey   = "X-Palapuzzle-AltText"
+)
+
+// A desktopFile is a parsed pala.desktop, kept line by line so that it can be
+// written back out with nothing changed except what was meant to be.
+type desktopFile struct {
+	lines     []desktopLine
+	crlf      bool // Lines end with "\r\n" (the "\r" is kept in their text)
+	noFinalNL bool // The last line has no newline
+}
+
+// A desktopLine is one line of a desktopFile.
+type desktopLine struct {
+	text       string // The line as read, without its newline
+	group      string // The group it is in ("" before the first header)
+	key, value string // For key=value lines; value is trimmed
+	isKey      bool
+}
+
+// parseDesktop parses the contents of a pala.desktop member.
+func parseDesktop(data []byte) *desktopFile {
+	d := &desktopFile{}
+	text := string(data)
+	if text == "" {
+		return d
+	}
+	if strings.HasSuffix(text, "\n") {
+		text = text[:len(text)-1]
+	} else {
+		d.noFinalNL = true
+	}
+	group := ""
+	for i, raw := range strings.Split(text, "\n") {
+		if i == 0 {
+			d.crlf = strings.HasSuffix(raw, "\r")
+		}
+		line := desktopLine{text: raw, group: group}
+		t := strings.TrimSpace(raw)
+		if strings.HasPrefix(t, "[") && strings.HasSuffix(t, "]") {
+			group = t[1 : len(t)-1]
+			line.group = group
+		} else if m := reKeyValue.FindStringSubmatch(t); m != nil && !strings.HasPrefix(t, "#") {
+			line.key, line.value = strings.TrimSpace(m[1]), strings.TrimSpace(m[2])
+			line.isKey = true
+		}
+		d.lines = append(d.lines, line)
+	}
+	return d
+}
+
+// get returns the value of key in group, and whether it was present.
+func (d *desktopFile) get(group, key string) (string, bool) {
+	for _, l := range d.lines {
+		if l.isKey && l.group == group && l.key == key {
+			return l.value, true
+		}
+	}
+	return "", false
+}
+
+// groups returns the keys of d, by group and then by key. Where a key is
+// repeated in a group, the first is used, as by get.
+func (d *desktopFile) groups() map[string]map[string]string {
+	ret := make(map[string]map[string]string)
+	for _, l := range d.lines {
+		if !l.isKey {
+			continue
+		}
+		g := ret[l.group]
+		if g == nil {
+			g = make(map[string]string)
+			ret[l.group] = g
+		}
+		if _, ok := g[l.key]; !ok {
+			g[l.key] = l.value
+		}
+	}
+	return ret
+}
+
+// extras returns the keys of d, by group and then by key, which are not in
+// used, the translations of the title and comment, or the groups of slicer
+// settings and piece offsets. It returns nil if there are none.
+func (d *desktopFile) extras(used map[string]KeySource) map[string]map[string]string {
+	skip := make(map[KeySource]bool)
+	for _, ks := range used {
+		skip[ks] = true
+	}
+	var ret map[string]map[string]string
+	for _, l := range d.lines {
+		if !l.isKey || skip[KeySource{l.group, l.key}] || l.group == slicerGroup || l.group == offsetsGroup {
+			continue
+		}
+		if m := reLocalizedKey.FindStringSubmatch(l.key); m != nil && l.group == mainGroup &&
+			(m[1] == "Name" || m[1] == "Comment") {
+			continue
+		}
+		if ret == nil {
+			ret = make(map[string]map[string]string)
+		}
+		g := ret[l.group]
+		if g == nil {
+			g = make(map[string]string)
+			ret[l.group] = g
+		}
+		if _, ok := g[l.key]; !ok {
+			g[l.key] = l.value
+		}
+	}
+	return ret
+}
+
+// flags returns the keys of the main and job groups which have boolean
+// values, or nil if there are none.
+func (d *desktopFile) flags() map[string]bool {
+	var ret map[string]bool
+	for _, l := range d.lines {
+		if !l.isKey || (l.group != mainGroup && l.group != jobGroup) {
+			continue
+		}
+		if v, ok := parseBool(l.value); ok {
+			if ret == nil {
+				ret = make(map[string]bool)
+			}
+			if _, seen := ret[l.key]; !seen {
+				ret[l.key] = v
+			}
+		}
+	}
+	return ret
+}
+
+// parseBool parses a boolean value as KConfig does, except that numbers
+// are not taken to be booleans.
+func parseBool(v string) (b, ok bool) {
+	switch strings.ToLower(v) {
+	case "true", "yes", "on":
+		return true, true
+	case "false", "no", "off":
+		return false, true
+	}
+	return false, false
+}
+
+// set sets key in group to value, adding the key (and group) if need be.
+func (d *desktopFile) set(group, key, value string) {
+	text := d.eol(key + "=" + value)
+	last := -1 // Index of the last line of group
+	for i, l := range d.lines {
+		if l.group != group {
+			continue
+		}
+		if l.isKey && l.key == key {
+			d.lines[i].text, d.lines[i].value = text, value
+			return
+		}
+		if strings.TrimSpace(l.text) != "" {
+			last = i
+		}
+	}
+	line := desktopLine{text: text, group: group, key: key, value: value, isKey: true}
+	if last < 0 {
+		if n := len(d.lines); n > 0 && strings.TrimSpace(d.lines[n-1].text) != "" {
+			d.lines = append(d.lines, desktopLine{text: d.eol(""), group: d.lines[n-1].group})
+		}
+		d.lines = append(d.lines, desktopLine{text: d.eol("[" + group + "]"), group: group}, line)
+		return
+	}
+	d.lines = append(d.lines[:last+1], append([]desktopLine{line}, d.lines[last+1:]...)...)
+}
+
+// remove removes key from group, if it is there.
+func (d *desktopFile) remove(group, key string) {
+	kept := d.lines[:0]
+	for _, l := range d.lines {
+		if !(l.isKey && l.group == group && l.key == key) {
+			kept = append(kept, l)
+		}
+	}
+	d.lines = kept
+}
+
+// eol adds a "\r" to text if d's lines end with "\r\n".
+func (d *desktopFile) eol(text string) string {
+	if d.crlf {
+		return text + "\r"
+	}
+	return text
+}
+
+// bytes returns the text of d. An unmodified desktopFile gives back exactly
+// the data it was parsed from.
+func (d *desktopFile) bytes() []byte {
+	var b bytes.Buffer
+	for i, l := range d.lines {
+		b.WriteString(l.text)
+		if i < len(d.lines)-1 || !d.noFinalNL {
+			b.WriteByte('\n')
+		}
+	}
+	return b.Bytes()
+}
+
+// pieceOffsets returns the offsets of the pieces within the puzzle's image,
+// from the PieceOffsets group.
+func (d *desktopFile) pieceOffsets() map[int]image.Point {
+	return d.points(offsetsGroup)
+}
+
+// points returns the points given for numbered keys in group, by number.
+// KConfig writes points as "x,y", but "x y" is also accepted.
+func (d *desktopFile) points(group string) map[int]image.Point {
+	ret := make(map[int]image.Point)
+	for _, l := range d.lines {
+		if !l.isKey || l.group != group {
+			continue
+		}
+		n, err := strconv.Atoi(l.key)
+		if err != nil {
+			continue
+		}
+		xy := strings.FieldsFunc(l.value, func(r rune) bool { return r == ',' || r == ' ' })
+		if len(xy) != 2 {
+			continue
+		}
+		x, err1 := strconv.Atoi(xy[0])
+		y, err2 := strconv.Atoi(xy[1])
+		if err1 == nil && err2 == nil {
+			ret[n] = image.Pt(x, y)
+		}
+	}
+	return ret
+}
+
+// escapeValue escapes a value for a desktop file, as the Desktop Entry
+// Specification says: backslashes, newlines, tabs and carriage returns.
+func escapeValue(v string) string {
+	return strings.NewReplacer(`\`, `\\`, "\n", `\n`, "\t", `\t`, "\r", `\r`).Replace(v)
+}
+
+// unescapeValue undoes escapeValue, and decodes "\s" as a space. Unknown
+// escapes are left as they are. PuzzleInfo's fields from pala.desktop are
+// decoded with it.
+func unescapeValue(v string) string {
+	return strings.NewReplacer(`\\`, `\`, `\n`, "\n", `\t`, "\t", `\r`, "\r", `\s`, " ").Replace(v)
+}
+
+// splitList splits a list value of a desktop file into its items, at
+// semicolons not escaped as "\;", and decodes each. The list's last
+// semicolon is optional.
+func splitList(v string) []string {
+	items := []string{}
+	var item strings.Builder
+	for i := 0; i < len(v); i++ {
+		switch {
+		case v[i] == '\\' && i+1 < len(v):
+			if v[i+1] == ';' {
+				item.WriteByte(';')
+			} else {
+				item.WriteString(v[i : i+2])
+			}
+			i++
+		case v[i] == ';':
+			items = append(items, unescapeValue(item.String()))
+			item.Reset()
+		default:
+			item.WriteByte(v[i])
+		}
+	}
+	if item.Len() > 0 {
+		items = append(items, unescapeValue(item.String()))
+	}
+	return items
+}
@@ -0,0 +1,104 @@
+package palapuzzle
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+)
+
+// An Installation is a copy of Palapeli's collection directory found by
+// DiscoverInstallations.
+type Installation struct {
+	// Which sort of installation: "native", "flatpak", "snap", "system"
+	// (shared by all users) or "kde4"
+	Kind string
+	Dir  string // The directory holding its .puzzle files
+}
+
+// Collection returns the collection in in's directory.
+func (in Installation) Collection() *Collection {
+	return &Collection{Dir: in.Dir}
+}
+
+// ErrNoCollection is returned by DefaultCollection and FindInstallation when
+// no suitable Palapeli collection directory can be found.
+var ErrNoCollection = errors.New("palapuzzle: no Palapeli collection found")
+
+// DiscoverInstallations returns the Palapeli collection directories that
+// exist for the current user, the likeliest to be in use first. It looks
+// where Palapeli keeps them on the current operating system:
+//
+//   - Linux and other Unix systems, following the XDG Base Directory
+//     Specification, in this order:
+//     $XDG_DATA_HOME/palapeli/collection ($XDG_DATA_HOME defaults to
+//     ~/.local/share); for the Flatpak,
+//     ~/.var/app/org.kde.palapeli/data/palapeli/collection; for the Snap,
+//     ~/snap/palapeli/current/.local/share/palapeli/collection;
+//     palapeli/collection in each directory of $XDG_DATA_DIRS, in turn
+//     (which defaults to /usr/local/share:/usr/share); and for KDE 4,
+//     ~/.kde/share/apps/palapeli/collection (or ~/.kde4/...).
+//     Relative paths in $XDG_DATA_HOME and $XDG_DATA_DIRS are ignored, as
+//     the specification says.
+//   - Windows: %LOCALAPPDATA%\palapeli\collection, or for KDE 4,
+//     %APPDATA%\.kde\share\apps\palapeli\collection
+//   - macOS: ~/Library/Application Support/palapeli/collection, or for
+//     KDE 4, ~/Library/Preferences/KDE/share/apps/palapeli/collection
+//
+// A directory is only listed once, under its first kind. Under js (in a
+// browser), where there is nowhere to look, it finds none.
+func DiscoverInstallations() []Installation {
+	var ret []Installation
+	seen := make(map[string]bool)
+	for _, in := range candidateInstallations() {
+		if seen[in.Dir] {
+			continue
+		}
+		seen[in.Dir] = true
+		if fi, err := os.Stat(in.Dir); err == nil && fi.IsDir() {
+			ret = append(ret, in)
+		}
+	}
+	return ret
+}
+
+// DefaultCollection returns the collection named by PALAPUZZLE_COLLECTION or
+// the configuration file (see LoadConfig), if either does, or else that of
+// the first of the installations that DiscoverInstallations finds.
+func DefaultCollection() (*Collection, error) {
+	cfg, err := LoadConfig()
+	if err != nil {
+		return nil, err
+	}
+	if cfg.Collection != "" {
+		return &Collection{Dir: cfg.Collection}, nil
+	}
+	found := DiscoverInstallations()
+	if len(found) == 0 {
+		return nil, ErrNoCollection
+	}
+	return found[0].Collection(), nil
+}
+
+// FindInstallation returns the collection of the first installation of
+// the given kind (such as "flatpak") that DiscoverInstallations finds, for
+// choosing between several installations of Palapeli.
+func FindInstallation(kind string) (*Collection, error) {
+	for _, in := range DiscoverInstallations() {
+		if in.Kind == kind {
+			return in.Collection(), nil
+		}
+	}
+	return nil, ErrNoCollection
+}
+
+// CacheDir returns the directory in which this package's users should keep
+// caches, such as indexes of collections: palapuzzle in os.UserCacheDir(),
+// which on Linux and other Unix systems is $XDG_CACHE_HOME (defaulting to
+// ~/.cache). The directory may not exist yet.
+func CacheDir() (string, error) {
+	dir, err := os.UserCacheDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "palapuzzle"), nil
+}
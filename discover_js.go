@@ -0,0 +1,9 @@
+//go:build js
+
+package palapuzzle
+
+// candidateInstallations returns nothing under js, where there are no
+// directories to look in.
+func candidateInstallations() []Installation {
+	return nil
+}
@@ -0,0 +1,63 @@
+//go:build !js
+
+package palapuzzle
+
+import (
+	"os"
+	"path/filepath"
+	"runtime"
+)
+
+// candidateInstallations returns where DiscoverInstallations looks, in
+// order. Directories which cannot be worked out (because $HOME is not set,
+// say) are left out.
+func candidateInstallations() []Installation {
+	var ret []Installation
+	add := func(kind string, base string, elem ...string) {
+		if base != "" {
+			ret = append(ret, Installation{kind, filepath.Join(append([]string{base}, elem...)...)})
+		}
+	}
+	home, _ := os.UserHomeDir()
+	kde4 := []string{"share", "apps", "palapeli", "collection"}
+	switch runtime.GOOS {
+	case "windows":
+		add("native", os.Getenv("LOCALAPPDATA"), "palapeli", "collection")
+		add("kde4", os.Getenv("APPDATA"), append([]string{".kde"}, kde4...)...)
+	case "darwin", "ios":
+		add("native", home, "Library", "Application Support", "palapeli", "collection")
+		add("kde4", home, append([]string{"Library", "Preferences", "KDE"}, kde4...)...)
+	default:
+		dataHome := xdgDirs("XDG_DATA_HOME", "")
+		if len(dataHome) == 0 && home != "" {
+			dataHome = []string{filepath.Join(home, ".local", "share")}
+		}
+		for _, dir := range dataHome {
+			add("native", dir, "palapeli", "collection")
+		}
+		add("flatpak", home, ".var", "app", "org.kde.palapeli", "data", "palapeli", "collection")
+		add("snap", home, "snap", "palapeli", "current", ".local", "share", "palapeli", "collection")
+		for _, dir := range xdgDirs("XDG_DATA_DIRS", "/usr/local/share:/usr/share") {
+			add("system", dir, "palapeli", "collection")
+		}
+		add("kde4", home, append([]string{".kde"}, kde4...)...)
+		add("kde4", home, append([]string{".kde4"}, kde4...)...)
+	}
+	return ret
+}
+
+// xdgDirs returns the absolute directories listed in the environment
+// variable name, or in def if it is unset or empty.
+func xdgDirs(name, def string) []string {
+	v := os.Getenv(name)
+	if v == "" {
+		v = def
+	}
+	var ret []string
+	for _, dir := range filepath.SplitList(v) {
+		if filepath.IsAbs(dir) {
+			ret = append(ret, dir)
+		}
+	}
+	return ret
+}
@@ -0,0 +1,173 @@
+package palapuzzle
+
+import (
+	"bytes"
+	"encoding/binary"
+	"image/jpeg"
+	"strings"
+	"time"
+)
+
+// EXIF holds the details a camera or photo editor recorded in image.jpg, as
+// read under the ReadEXIF option. Fields the image does not record are
+// empty; Artist, in particular, can stand in for a missing Author.
+type EXIF struct {
+	Artist      string
+	Copyright   string
+	Description string // ImageDescription
+	Make        string // Of the camera
+	Model       string
+	// When the photo was taken (DateTimeOriginal), or failing that last
+	// changed (DateTime). EXIF records no time zone, so it is given as UTC.
+	Taken time.Time
+}
+
+// EXIF tags read into an EXIF.
+const (
+	exifDescription = 0x010e
+	exifMake        = 0x010f
+	exifModel       = 0x0110
+	exifDateTime    = 0x0132
+	exifArtist      = 0x013b
+	exifCopyright   = 0x8298
+	exifIFDPointer  = 0x8769 // Where the Exif sub-IFD is
+	exifOriginal    = 0x9003 // DateTimeOriginal, in the Exif sub-IFD
+)
+
+// exifTimeLayout is how EXIF writes times.
+const exifTimeLayout = "2006:01:02 15:04:05"
+
+// parseEXIF returns the EXIF details in jpg, the start of a JPEG file up to
+// at least its frame header, or nil if there are none.
+func parseEXIF(jpg []byte) *EXIF {
+	if len(jpg) < 2 || jpg[0] != 0xff || jpg[1] != 0xd8 {
+		return nil
+	}
+	for p := 2; p+4 <= len(jpg) && jpg[p] == 0xff; {
+		marker, n := jpg[p+1], int(binary.BigEndian.Uint16(jpg[p+2:]))
+		if marker == 0xda || (marker >= 0xc0 && marker <= 0xcf && marker != 0xc4 && marker != 0xc8 && marker != 0xcc) {
+			return nil // The image data, or its frame header: APP1 comes before
+		}
+		if n < 2 {
+			return nil // A length which does not even cover itself
+		}
+		seg := jpg[p+4 : min(len(jpg), p+2+n)]
+		if marker == 0xe1 && bytes.HasPrefix(seg, []byte("Exif\x00\x00")) {
+			return parseTIFF(seg[6:])
+		}
+		p += 2 + n
+	}
+	return nil
+}
+
+// parseTIFF reads the EXIF details from tiff, the TIFF structure inside an
+// APP1 segment.
+func parseTIFF(tiff []byte) *EXIF {
+	if len(tiff) < 8 {
+		return nil
+	}
+	var bo binary.ByteOrder
+	switch string(tiff[:2]) {
+	case "II":
+		bo = binary.LittleEndian
+	case "MM":
+		bo = binary.BigEndian
+	default:
+		return nil
+	}
+	tags := make(map[uint16]string)
+	var sub uint32
+	readIFD := func(off uint32) {
+		if off < 8 || int64(off)+2 > int64(len(tiff)) {
+			return
+		}
+		n := int(bo.Uint16(tiff[off:]))
+		for i := 0; i < n; i++ {
+			e := int(off) + 2 + 12*i
+			if e+12 > len(tiff) {
+				return
+			}
+			tag, typ, count := bo.Uint16(tiff[e:]), bo.Uint16(tiff[e+2:]), bo.Uint32(tiff[e+4:])
+			switch {
+			case tag == exifIFDPointer && typ == 4: // LONG
+				sub = bo.Uint32(tiff[e+8:])
+			case typ == 2: // ASCII
+				val := tiff[e+8 : e+12]
+				if count > 4 {
+					start := int64(bo.Uint32(tiff[e+8:]))
+					if start+int64(count) > int64(len(tiff)) {
+						continue
+					}
+					val = tiff[start : start+int64(count)]
+				} else {
+					val = val[:count]
+				}
+				tags[tag] = strings.TrimSpace(strings.TrimRight(string(val), "\x00"))
+			}
+		}
+	}
+	readIFD(bo.Uint32(tiff[4:]))
+	if sub != 0 {
+		readIFD(sub)
+	}
+	if len(tags) == 0 {
+		return nil
+	}
+	x := &EXIF{
+		Artist:      tags[exifArtist],
+		Copyright:   tags[exifCopyright],
+		Description: tags[exifDescription],
+		Make:        tags[exifMake],
+		Model:       tags[exifModel],
+	}
+	for _, tag := range []uint16{exifOriginal, exifDateTime} {
+		if t, err := time.Parse(exifTimeLayout, tags[tag]); err == nil {
+			x.Taken = t
+			break
+		}
+	}
+	return x
+}
+
+// stripEXIF returns jpg, a JPEG image, without the segments which record
+// where, when and with what it was taken: EXIF and XMP (in APP1 segments)
+// and IPTC (in APP13). The image data, and segments needed to show it right,
+// such as an ICC profile, are kept as they are. If jpg is too garbled to
+// find its segments in, but can be decoded, it is re-encoded, which keeps
+// none; if it cannot even be decoded, it is returned as it is.
+func stripEXIF(jpg []byte) []byte {
+	if len(jpg) < 2 || jpg[0] != 0xff || jpg[1] != 0xd8 {
+		return reencodeJPEG(jpg)
+	}
+	out := append([]byte(nil), jpg[:2]...)
+	for p := 2; ; {
+		if p+4 > len(jpg) || jpg[p] != 0xff {
+			return reencodeJPEG(jpg)
+		}
+		marker, n := jpg[p+1], int(binary.BigEndian.Uint16(jpg[p+2:]))
+		if marker == 0xda { // The image data, which runs to the end
+			return append(out, jpg[p:]...)
+		}
+		if n < 2 || p+2+n > len(jpg) {
+			return reencodeJPEG(jpg)
+		}
+		if marker != 0xe1 && marker != 0xed { // APP1 and APP13
+			out = append(out, jpg[p:p+2+n]...)
+		}
+		p += 2 + n
+	}
+}
+
+// reencodeJPEG returns jpg decoded and encoded again, which leaves out
+// everything but the picture, or jpg as it is if it cannot be decoded.
+func reencodeJPEG(jpg []byte) []byte {
+	img, err := jpeg.Decode(bytes.NewReader(jpg))
+	if err != nil {
+		return jpg
+	}
+	var buf bytes.Buffer
+	if err := jpeg.Encode(&buf, img, &jpeg.Options{Quality: imageQuality}); err != nil {
+		return jpg
+	}
+	return buf.Bytes()
+}
@@ -0,0 +1,29 @@
+package palapuzzle
+
+import "testing"
+
+func TestParseEXIFBadSegments(t *testing.T) {
+	for _, jpg := range [][]byte{
+		{0xff, 0xd8, 0xff, 0xe0, 0, 0, 0, 0},             // Zero length
+		{0xff, 0xd8, 0xff, 0xe1, 0, 1, 'E', 'x'},         // Length 1
+		{0xff, 0xd8, 0xff, 0xe1, 0, 100, 'E', 'x'},       // Cut short
+		{0xff, 0xd8, 0xff, 0xe1, 0, 8, 'E', 'x', 'i'},    // Cut short, inside Exif
+		{0xff, 0xd8, 0xff, 0xe1, 0, 2, 0xff, 0xe1, 0, 0}, // Empty, then zero
+		{0xff, 0xd8, 0xff},
+	} {
+		if x := parseEXIF(jpg); x != nil {
+			t.Errorf("parseEXIF(% x) = %+v, want nil", jpg, x)
+		}
+	}
+}
+
+func TestScanBadEXIFSegment(t *testing.T) {
+	p := testPuzzle(t, testMember{Name: "image.jpg", Body: "\xff\xd8\xff\xe0\x00\x00\x00\x00"})
+	pi, err := ScanPuzzle(p, ReadEXIF())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if pi.EXIF != nil {
+		t.Errorf("EXIF = %+v, want nil", pi.EXIF)
+	}
+}
@@ -0,0 +1,248 @@
+package palapuzzle
+
+import (
+	"archive/tar"
+	"bufio"
+	"compress/bzip2"
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+)
+
+// An Archive gives sequential access to the members of an opened container,
+// in the manner of a *tar.Reader: Next advances to the next member (returning
+// io.EOF at the end) and Read reads the content of the current member.
+//
+// Formats whose members are not described by tar headers should fill in at
+// least the Name, Size and ModTime fields of the headers they return.
+type Archive interface {
+	Next() (*tar.Header, error)
+	io.Reader
+}
+
+// ErrFormat indicates that a file was not in any registered container format.
+var ErrFormat = errors.New("palapuzzle: unknown container format")
+
+// A format holds a container format's name, magic header and how to open it.
+type format struct {
+	name, magic string
+	open        func(io.Reader) (Archive, error)
+	// For the built-in formats, which are all tarballs, and those added by
+	// RegisterCompression, how to get at the tar stream; nil for formats
+	// added by RegisterFormat
+	decompress func(io.Reader) (io.Reader, error)
+	// How to write the format, for those which can be written
+	compress func(io.Writer) (io.WriteCloser, error)
+}
+
+var (
+	formatsMu sync.Mutex
+	formats   []format
+)
+
+// RegisterFormat registers a container format for use by ScanPuzzle and
+// friends. Name is the name of the format, like "gzip" or "zstd". Magic is
+// the magic prefix that identifies the format's encoding; it can contain "?"
+// wildcards that each match any one byte. Open is the function that opens a
+// stream in that format as an Archive.
+//
+// Formats are tried in the order they were registered, so a more specific
+// magic string should be registered before a less specific one. The default
+// format, gzip-compressed tar, is always registered first, followed by
+// bzip2-compressed and uncompressed tar.
+//
+// Tarballs compressed with xz or zstd, which the standard library cannot
+// decompress, are recognised but fail with an error wrapping ErrFormat,
+// unless a format for them has been registered, with RegisterFormat or
+// RegisterCompression.
+func RegisterFormat(name, magic string, open func(io.Reader) (Archive, error)) {
+	formatsMu.Lock()
+	formats = append(formats, format{name, magic, open, nil, nil})
+	formatsMu.Unlock()
+}
+
+// RegisterCompression registers a compression for tarballs, such as zstd, for
+// writing puzzles with (see the Compression option) as well as reading them.
+// Name and magic are as for RegisterFormat. Compress returns a writer which
+// compresses what is written to it, and decompress a reader which
+// decompresses what it reads; neither is given a level, so the
+// CompressionLevel and Parallel options do not apply. Puzzles in a
+// registered compression are read as gzipped ones are, so that (say)
+// Puzzle.OpenPiece can skip straight to a piece.
+func RegisterCompression(name, magic string, compress func(io.Writer) (io.WriteCloser, error), decompress func(io.Reader) (io.Reader, error)) {
+	registerTar(name, magic, decompress, compress)
+}
+
+// compressor returns how to write the named format, or nil if it cannot be
+// written.
+func compressor(name string) func(io.Writer) (io.WriteCloser, error) {
+	formatsMu.Lock()
+	defer formatsMu.Unlock()
+	for _, f := range formats {
+		if f.name == name && f.compress != nil {
+			return f.compress
+		}
+	}
+	return nil
+}
+
+// registerTar registers a tarball format, compressed in a way that
+// decompress undoes, and compress (if it is not nil) does.
+func registerTar(name, magic string, decompress func(io.Reader) (io.Reader, error), compress func(io.Writer) (io.WriteCloser, error)) {
+	open := func(r io.Reader) (Archive, error) {
+		d, err := decompress(r)
+		if err != nil {
+			return nil, err
+		}
+		return tar.NewReader(d), nil
+	}
+	formatsMu.Lock()
+	formats = append(formats, format{name, magic, open, decompress, compress})
+	formatsMu.Unlock()
+}
+
+// decompressor returns how to get at the tar stream of the named built-in
+// format, or nil if there is no such format.
+func decompressor(name string) func(io.Reader) (io.Reader, error) {
+	formatsMu.Lock()
+	defer formatsMu.Unlock()
+	for _, f := range formats {
+		if f.name == name && f.decompress != nil {
+			return f.decompress
+		}
+	}
+	return nil
+}
+
+// tarMagic matches a tar archive's header, whose "ustar" magic comes 257
+// bytes in.
+var tarMagic = strings.Repeat("?", 257) + "ustar"
+
+func init() {
+	registerTar("gzip", "\x1f\x8b", func(r io.Reader) (io.Reader, error) {
+		return gzip.NewReader(r)
+	}, nil) // Written by newGzipWriter, at a level
+	registerTar("bzip2", "BZh", func(r io.Reader) (io.Reader, error) {
+		return bzip2.NewReader(r), nil
+	}, nil)
+	registerTar("tar", tarMagic, func(r io.Reader) (io.Reader, error) {
+		return r, nil
+	}, func(w io.Writer) (io.WriteCloser, error) {
+		return nopWriteCloser{w}, nil
+	})
+}
+
+// A nopWriteCloser is a Writer whose Close does nothing, for writing
+// uncompressed tarballs.
+type nopWriteCloser struct {
+	io.Writer
+}
+
+func (nopWriteCloser) Close() error { return nil }
+
+// unsupportedFormats are compressions that are recognised, once no
+// registered format matches, only to explain why they cannot be read.
+var unsupportedFormats = []format{
+	{name: "xz", magic: "\xfd7zXZ\x00"},
+	{name: "zstd", magic: "\x28\xb5\x2f\xfd"},
+}
+
+// ErrTrailingData is returned, under the RejectTrailingData option, for
+// puzzles with data after the end of their archive.
+var ErrTrailingData = errors.New("palapuzzle: data after the end of the archive")
+
+// trailingData reads the rest of r, the tar stream of an archive in the
+// named built-in format, once the tar reader has found its end. It returns
+// where there is data which should not be there, or "" if there is none.
+// Zeros are allowed, as tar pads archives with them. If max > 0, no more
+// than max bytes are read, so that a stream of zeros cannot take forever.
+func trailingData(r io.Reader, format string, max int64) string {
+	if max > 0 {
+		r = io.LimitReader(r, max)
+	}
+	buf := make([]byte, 32*1024)
+	for {
+		n, err := r.Read(buf)
+		for _, b := range buf[:n] {
+			if b != 0 {
+				return "after the end of the tar archive"
+			}
+		}
+		if err == io.EOF {
+			return ""
+		}
+		if err != nil {
+			// Which, for a compressed archive, means the decompressor
+			// found something other than another compressed stream.
+			return "after the " + format + " stream"
+		}
+	}
+}
+
+// match reports whether magic matches b. Magic may contain "?" wildcards.
+func match(magic string, b []byte) bool {
+	if len(magic) != len(b) {
+		return false
+	}
+	for i, c := range b {
+		if magic[i] != c && magic[i] != '?' {
+			return false
+		}
+	}
+	return true
+}
+
+// sniff determines the format of r, returning the format and a reader that
+// will yield all of r's data, even the bytes that were examined.
+func sniff(r io.Reader) (format, io.Reader, error) {
+	br, ok := r.(*bufio.Reader)
+	if !ok {
+		br = bufio.NewReader(r)
+	}
+	formatsMu.Lock()
+	fmts := formats
+	formatsMu.Unlock()
+	for _, f := range fmts {
+		b, err := br.Peek(len(f.magic))
+		if err == nil && match(f.magic, b) {
+			return f, br, nil
+		}
+	}
+	for _, f := range unsupportedFormats {
+		b, err := br.Peek(len(f.magic))
+		if err == nil && match(f.magic, b) {
+			return format{}, br, fmt.Errorf("%w: %s compression needs a format registered for it", ErrFormat, f.name)
+		}
+	}
+	return format{}, br, ErrFormat
+}
+
+// openArchive sniffs the format of r and opens it as an Archive.
+func openArchive(r io.Reader) (Archive, string, error) {
+	a, name, _, err := openCounted(r)
+	return a, name, err
+}
+
+// openCounted is like openArchive, but for the built-in formats also
+// returns a countingReader for the tar stream, whose count after each call
+// of Next is where the member's content starts. For other formats it is
+// nil.
+func openCounted(r io.Reader) (Archive, string, *countingReader, error) {
+	f, br, err := sniff(r)
+	if err != nil {
+		return nil, "", nil, err
+	}
+	if f.decompress == nil {
+		a, err := f.open(br)
+		return a, f.name, nil, err
+	}
+	d, err := f.decompress(br)
+	if err != nil {
+		return nil, f.name, nil, err
+	}
+	cr := &countingReader{r: d}
+	return tar.NewReader(cr), f.name, cr, nil
+}
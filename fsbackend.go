@@ -0,0 +1,43 @@
+package palapuzzle
+
+import (
+	"errors"
+	"io"
+	"io/fs"
+)
+
+// An FSBackend is a read-only Backend for the puzzles in an fs.FS, such as
+// an embed.FS or a zip.Reader. Names are as fs.ValidPath requires:
+// slash-separated and unrooted.
+type FSBackend struct {
+	FS fs.FS
+}
+
+func (b FSBackend) Open(name string) (io.ReadCloser, error) { return b.FS.Open(name) }
+
+func (b FSBackend) Stat(name string) (fs.FileInfo, error) { return fs.Stat(b.FS, name) }
+
+func (b FSBackend) List(dir string) ([]fs.FileInfo, error) {
+	entries, err := fs.ReadDir(b.FS, dir)
+	if err != nil {
+		return nil, err
+	}
+	var ret []fs.FileInfo
+	for _, e := range entries {
+		fi, err := e.Info()
+		if err != nil {
+			continue
+		}
+		ret = append(ret, fi)
+	}
+	return ret, nil
+}
+
+func (b FSBackend) Write(name string) (io.WriteCloser, error) {
+	return nil, errors.ErrUnsupported
+}
+
+// ScanPuzzleFS is like ScanPuzzle, but reads the named file from fsys.
+func ScanPuzzleFS(fsys fs.FS, name string, opts ...Option) (*PuzzleInfo, error) {
+	return ScanBackend(FSBackend{fsys}, name, opts...)
+}
@@ -0,0 +1,34 @@
+package palapuzzle
+
+import "sort"
+
+// Hashes are the SHA-256 hashes of a puzzle, in lower-case hex, as worked
+// out under the HashMembers option.
+type Hashes struct {
+	File   string         // Of the whole .puzzle file, as stored
+	Image  string         // Of image.jpg; "" if there is none
+	Pieces map[int]string // Of each N.png (the first, if there are several), by N
+	// The groups of pieces with identical content, which a working slicer
+	// never makes: each group's Ns in order, and the groups in order of
+	// their first N. Nil if there are none; each group gets a
+	// WarnIdenticalPieces warning.
+	IdenticalPieces [][]int
+}
+
+// identicalPieces returns the groups of pieces in h.Pieces with the same
+// hash, as for IdenticalPieces.
+func (h *Hashes) identicalPieces() [][]int {
+	byHash := make(map[string][]int)
+	for n, sum := range h.Pieces {
+		byHash[sum] = append(byHash[sum], n)
+	}
+	var ret [][]int
+	for _, ns := range byHash {
+		if len(ns) > 1 {
+			sort.Ints(ns)
+			ret = append(ret, ns)
+		}
+	}
+	sort.Slice(ret, func(i, j int) bool { return ret[i][0] < ret[j][0] })
+	return ret
+}
@@ -0,0 +1,125 @@
+package palapuzzle
+
+import "fmt"
+
+// A Health rates how well a puzzle is put together, from 0 (hopeless) to
+// 100 (nothing to fix), so that collections can be sorted worst first.
+type Health struct {
+	Score      int // The categories' scores, averaged by weight
+	Categories []HealthCategory
+}
+
+// A HealthCategory is one aspect of a puzzle's Health.
+type HealthCategory struct {
+	Name  string // "integrity", "metadata", "size" or "preview"
+	Score int    // From 0 to 100
+	// How much the category counts towards the overall score; zero if it
+	// could not be judged
+	Weight int
+	// What lost the category points, and what to do about it, suitable
+	// for display
+	Problems []string
+}
+
+// Healthy overhead, in bytes of pieces and manifest per byte of image.jpg:
+// puzzles at most healthyOverhead times their image's size score full marks
+// for size, falling to none at wastefulOverhead.
+const (
+	healthyOverhead  = 4
+	wastefulOverhead = 12
+)
+
+// severityPoints is how many integrity points a warning of each severity
+// costs.
+var severityPoints = map[Severity]int{
+	SeverityNotice:  5,
+	SeverityWarning: 15,
+	SeverityError:   25,
+}
+
+// HealthScore rates the puzzle pi describes, from what ScanPuzzle found:
+//
+//   - integrity (weight 4): pieces missing or duplicated, and a PieceCount
+//     which is not a number or does not match the pieces there are; each
+//     warning costs up to a quarter of the points, by its Severity;
+//   - metadata (weight 2): a title, an author, a declared piece count and
+//     a description of the picture (see SetAltText);
+//   - size (weight 2): how big the pieces are compared with the image,
+//     which is usually put right by OptimizePieces; not judged without an
+//     image;
+//   - preview (weight 2): whether there is an image.jpg for Palapeli to
+//     show (see RebuildImage).
+//
+// Under the MetadataOnly option, which does not count the pieces, the
+// pieces are not judged, nor (unless image.jpg came before pala.desktop)
+// the size and preview.
+func HealthScore(pi *PuzzleInfo) *Health {
+	h := &Health{}
+	add := func(name string, weight, score int, problems []string) {
+		h.Categories = append(h.Categories, HealthCategory{name, max(0, score), weight, problems})
+	}
+
+	score, problems := 100, []string(nil)
+	lose := func(points int, format string, args ...interface{}) {
+		score -= points
+		problems = append(problems, fmt.Sprintf(format, args...))
+	}
+	counted := pi.NPieceFiles >= 0 // Not under MetadataOnly
+	if pi.NPieceFiles == 0 {
+		lose(100, "no pieces")
+	}
+	for _, w := range pi.Warnings {
+		lose(severityPoints[w.Severity()], "%s", w.Text)
+	}
+	if counted && pi.NPiecesDecl > 0 && pi.NPiecesDecl != pi.NPieceFiles {
+		lose(25, "PieceCount is %d, but there are %d pieces", pi.NPiecesDecl, pi.NPieceFiles)
+	}
+	add("integrity", 4, score, problems)
+
+	score, problems = 100, nil
+	if pi.Title == "" {
+		lose(40, "no title")
+	}
+	if pi.Author == "" || pi.Author == "?" {
+		lose(30, "no author")
+	}
+	if pi.NPiecesDecl == 0 {
+		lose(15, "no PieceCount (see UpgradePuzzle)")
+	}
+	if pi.AltText == "" {
+		lose(15, "no description of the picture (see SetAltText)")
+	}
+	add("metadata", 2, score, problems)
+
+	switch {
+	case pi.ImageFileSize > 0 && pi.PuzzleFileSize > 0:
+		score, problems = 100, nil
+		ratio := float64(pi.PuzzleFileSize-pi.ImageFileSize) / float64(pi.ImageFileSize)
+		if ratio > healthyOverhead {
+			lose(int(100*(ratio-healthyOverhead)/(wastefulOverhead-healthyOverhead)+0.5),
+				"pieces take %.1f times the image's size (see OptimizePieces)", ratio)
+		}
+		add("size", 2, score, problems)
+	case pi.ImageFileSize > 0:
+		add("size", 0, 0, []string{"cannot be judged without the file's size"})
+	default:
+		add("size", 0, 0, []string{"cannot be judged without image.jpg"})
+	}
+
+	switch {
+	case pi.ImageFileSize > 0:
+		add("preview", 2, 100, nil)
+	case !counted:
+		add("preview", 0, 0, []string{"cannot be judged under MetadataOnly"})
+	default:
+		add("preview", 2, 0, []string{"no image.jpg (see RebuildImage)"})
+	}
+
+	var sum, weights int
+	for _, c := range h.Categories {
+		sum += c.Score * c.Weight
+		weights += c.Weight
+	}
+	h.Score = (sum + weights/2) / weights
+	return h
+}
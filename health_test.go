@@ -0,0 +1,60 @@
+package palapuzzle
+
+import (
+	"testing"
+
+	"github.com/c12h/palapuzzle/palapuzzletest"
+)
+
+func TestHealthScoreSeverity(t *testing.T) {
+	integrity := func(pi *PuzzleInfo) int {
+		for _, c := range HealthScore(pi).Categories {
+			if c.Name == "integrity" {
+				return c.Score
+			}
+		}
+		t.Fatal("no integrity category")
+		return 0
+	}
+	base := PuzzleInfo{NPieceFiles: 4, NPiecesDecl: 4}
+	if got := integrity(&base); got != 100 {
+		t.Fatalf("integrity with no warnings = %d, want 100", got)
+	}
+	var scores []int
+	for _, kind := range []WarningKind{WarnUnknownMember, WarnBadPieceCount, WarnMissingPiece} {
+		pi := base
+		pi.Warnings = []Warning{{Kind: kind, Text: kind.String()}}
+		scores = append(scores, integrity(&pi))
+	}
+	// A notice, a warning and an error, in that order
+	if !(scores[0] > scores[1] && scores[1] > scores[2]) || scores[2] != 75 {
+		t.Errorf("integrity scores by severity = %v", scores)
+	}
+}
+
+func TestHealthScoreMetadataOnly(t *testing.T) {
+	p := palapuzzletest.File(t, palapuzzletest.Spec{})
+	full, err := ScanPuzzle(p)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pi, err := ScanPuzzle(p, MetadataOnly())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if pi.NPieceFiles != -1 {
+		t.Fatalf("NPieceFiles = %d, want -1", pi.NPieceFiles)
+	}
+	if m := pi.PieceCountMismatch(); m != nil {
+		t.Errorf("PieceCountMismatch = %+v, want nil", m)
+	}
+	for _, c := range HealthScore(pi).Categories {
+		if c.Name == "integrity" && (c.Score != 100 || len(c.Problems) != 0) {
+			t.Errorf("integrity under MetadataOnly = %d, %q", c.Score, c.Problems)
+		}
+	}
+	// Palapuzzletest writes image.jpg first, so only the pieces go unjudged
+	if got, want := HealthScore(pi).Score, HealthScore(full).Score; got != want {
+		t.Errorf("score under MetadataOnly = %d, want %d", got, want)
+	}
+}
@@ -0,0 +1,224 @@
+package palapuzzle
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"net/http"
+	"net/url"
+	"path"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"time"
+)
+
+// An HTTPBackend is a read-only Backend for puzzles on web servers, whose
+// names are http:// or https:// URLs. Files are streamed, never staged on
+// disk.
+type HTTPBackend struct {
+	// The client used to make requests; nil means http.DefaultClient
+	Client *http.Client
+	// How long each request (including reading the body) may take; zero
+	// means no limit
+	Timeout time.Duration
+	// The largest file that will be read, in bytes; zero means no limit
+	MaxSize int64
+}
+
+// DefaultHTTPBackend is used by ScanPuzzle and Collection.Import for http://
+// and https:// URLs. Its fields may be changed to suit.
+var DefaultHTTPBackend = &HTTPBackend{
+	Timeout: 10 * time.Minute,
+	MaxSize: 1 << 30,
+}
+
+// ErrTooLarge is returned when a file exceeds a configured size limit.
+var ErrTooLarge = errors.New("palapuzzle: file too large")
+
+func (b *HTTPBackend) client() *http.Client {
+	if b.Client == nil {
+		return http.DefaultClient
+	}
+	return b.Client
+}
+
+func (b *HTTPBackend) do(method, name string) (*http.Response, context.CancelFunc, error) {
+	return b.doContext(context.Background(), method, name)
+}
+
+// doContext is like do, but the request is also cancelled if ctx is done.
+func (b *HTTPBackend) doContext(ctx context.Context, method, name string) (*http.Response, context.CancelFunc, error) {
+	cancel := context.CancelFunc(func() {})
+	if b.Timeout > 0 {
+		ctx, cancel = context.WithTimeout(ctx, b.Timeout)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, name, nil)
+	if err != nil {
+		cancel()
+		return nil, nil, err
+	}
+	resp, err := b.client().Do(req)
+	if err != nil {
+		cancel()
+		return nil, nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		resp.Body.Close()
+		cancel()
+		if resp.StatusCode == http.StatusNotFound {
+			return nil, nil, fs.ErrNotExist
+		}
+		return nil, nil, fmt.Errorf("HTTP status %q", resp.Status)
+	}
+	if b.MaxSize > 0 && resp.ContentLength > b.MaxSize {
+		resp.Body.Close()
+		cancel()
+		return nil, nil, ErrTooLarge
+	}
+	return resp, cancel, nil
+}
+
+func (b *HTTPBackend) Open(name string) (io.ReadCloser, error) {
+	resp, cancel, err := b.do(http.MethodGet, name)
+	if err != nil {
+		return nil, err
+	}
+	return &httpFile{resp: resp, cancel: cancel, max: b.MaxSize}, nil
+}
+
+func (b *HTTPBackend) Stat(name string) (fs.FileInfo, error) {
+	resp, cancel, err := b.do(http.MethodHead, name)
+	if err != nil {
+		return nil, err
+	}
+	resp.Body.Close()
+	cancel()
+	return httpFileInfo{resp}, nil
+}
+
+func (b *HTTPBackend) List(dir string) ([]fs.FileInfo, error) {
+	return nil, errors.ErrUnsupported
+}
+
+func (b *HTTPBackend) Write(name string) (io.WriteCloser, error) {
+	return nil, errors.ErrUnsupported
+}
+
+// A contextHTTPBackend is an HTTPBackend whose requests are tied to ctx.
+type contextHTTPBackend struct {
+	*HTTPBackend
+	ctx context.Context
+}
+
+func (b contextHTTPBackend) Open(name string) (io.ReadCloser, error) {
+	resp, cancel, err := b.doContext(b.ctx, http.MethodGet, name)
+	if err != nil {
+		return nil, err
+	}
+	return &httpFile{resp: resp, cancel: cancel, max: b.MaxSize}, nil
+}
+
+func (b contextHTTPBackend) Stat(name string) (fs.FileInfo, error) {
+	resp, cancel, err := b.doContext(b.ctx, http.MethodHead, name)
+	if err != nil {
+		return nil, err
+	}
+	resp.Body.Close()
+	cancel()
+	return httpFileInfo{resp}, nil
+}
+
+// ScanURL is like ScanPuzzleContext, but only for http:// and https:// URLs,
+// such as those of puzzles on the KDE Store. The response is streamed
+// through the scanner, never saved, within DefaultHTTPBackend's limits on
+// size (MaxSize) and time (Timeout); ctx can end it sooner.
+func ScanURL(ctx context.Context, rawURL string, opts ...Option) (*PuzzleInfo, error) {
+	if !strings.HasPrefix(rawURL, "http://") && !strings.HasPrefix(rawURL, "https://") {
+		return nil, &Error{"fetch", rawURL, errors.New("not an http:// or https:// URL")}
+	}
+	return ScanPuzzleContext(ctx, rawURL, opts...)
+}
+
+// An httpFile is the body of a response, limited to max bytes if max > 0.
+type httpFile struct {
+	resp   *http.Response
+	cancel context.CancelFunc
+	max, n int64
+}
+
+func (f *httpFile) Read(p []byte) (int, error) {
+	if f.max > 0 && f.n >= f.max {
+		// Only complain if there is more to come.
+		if n, _ := f.resp.Body.Read(make([]byte, 1)); n > 0 {
+			return 0, ErrTooLarge
+		}
+		return 0, io.EOF
+	}
+	if f.max > 0 && int64(len(p)) > f.max-f.n {
+		p = p[:f.max-f.n]
+	}
+	n, err := f.resp.Body.Read(p)
+	f.n += int64(n)
+	return n, err
+}
+
+func (f *httpFile) Close() error {
+	err := f.resp.Body.Close()
+	f.cancel()
+	return err
+}
+
+func (f *httpFile) Stat() (fs.FileInfo, error) { return httpFileInfo{f.resp}, nil }
+
+// An httpFileInfo describes a file from the headers of a response. Its size
+// is -1 if the server did not say.
+type httpFileInfo struct{ resp *http.Response }
+
+func (fi httpFileInfo) Name() string      { return path.Base(fi.resp.Request.URL.Path) }
+func (fi httpFileInfo) Size() int64       { return fi.resp.ContentLength }
+func (fi httpFileInfo) Mode() fs.FileMode { return 0444 }
+func (fi httpFileInfo) IsDir() bool       { return false }
+func (fi httpFileInfo) Sys() interface{}  { return nil }
+
+func (fi httpFileInfo) ModTime() time.Time {
+	t, _ := http.ParseTime(fi.resp.Header.Get("Last-Modified"))
+	return t
+}
+
+// backendFor works out which Backend handles name, which can be a local
+// path or an http://, https:// or file:// URL, and what that Backend calls it.
+func backendFor(name string) (Backend, string, error) {
+	switch {
+	case strings.HasPrefix(name, "http://"), strings.HasPrefix(name, "https://"):
+		return DefaultHTTPBackend, name, nil
+	case strings.HasPrefix(name, "file://"):
+		u, err := url.Parse(name)
+		if err != nil {
+			return nil, "", err
+		}
+		if u.Host != "" && u.Host != "localhost" {
+			return nil, "", fmt.Errorf("cannot access files on host %q", u.Host)
+		}
+		p := u.Path
+		if runtime.GOOS == "windows" && len(p) > 2 && p[0] == '/' && p[2] == ':' {
+			p = p[1:] // "/C:/Users/..." => "C:/Users/..."
+		}
+		return Local, filepath.FromSlash(p), nil
+	}
+	return Local, name, nil
+}
+
+// splitName splits a name (possibly a URL) into directory and filename.
+func splitName(name string) (dir, file string) {
+	if strings.HasPrefix(name, "http://") || strings.HasPrefix(name, "https://") {
+		if u, err := url.Parse(name); err == nil {
+			dir, file = path.Split(u.Path)
+			u.Path, u.RawPath, u.RawQuery, u.Fragment = dir, "", "", ""
+			return u.String(), file
+		}
+	}
+	return filepath.Split(name)
+}
@@ -0,0 +1,188 @@
+package palapuzzle
+
+import (
+	"archive/tar"
+	"bytes"
+	"errors"
+	"image"
+	"image/color"
+	"image/draw"
+	"image/jpeg"
+	"image/png"
+	"io"
+	"strconv"
+)
+
+// The JPEG quality used when this package makes an image.jpg.
+const imageQuality = 90
+
+// A puzzleContent holds the parts of a puzzle needed to work with its
+// pictures: its manifest, its decoded pieces and their offsets.
+type puzzleContent struct {
+	desktop  *desktopFile
+	pieces   map[int]image.Image
+	offsets  map[int]image.Point
+	hasImage bool            // Whether there is an image.jpg member
+	imageOK  bool            // Whether it decodes as a JPEG
+	imageBox image.Rectangle // If so, its bounds
+}
+
+// readContent reads the manifest and pieces of the puzzle at path. Pieces
+// which cannot be decoded are an error.
+func readContent(path string) (*puzzleContent, error) {
+	pc := &puzzleContent{pieces: make(map[int]image.Image)}
+	err := walkPuzzle(path, func(hdr *tar.Header, r io.Reader) error {
+		if m := rePieceName.FindStringSubmatch(hdr.Name); m != nil {
+			n, err := strconv.Atoi(m[1])
+			if err != nil {
+				return &Error{"parse member name " + hdr.Name + " in", path, err}
+			}
+			img, err := png.Decode(r)
+			if err != nil {
+				return &Error{"decode member " + hdr.Name + " of", path, err}
+			}
+			pc.pieces[n] = img
+		} else if hdr.Name == "pala.desktop" {
+			data, err := io.ReadAll(r)
+			if err != nil {
+				return &Error{"read member pala.desktop of", path, err}
+			}
+			pc.desktop = parseDesktop(data)
+		} else if hdr.Name == "image.jpg" {
+			img, err := jpeg.Decode(r)
+			pc.hasImage, pc.imageOK = true, err == nil
+			if err == nil {
+				pc.imageBox = img.Bounds()
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	if pc.desktop == nil {
+		return nil, &Error{"find member pala.desktop in", path, nil}
+	}
+	pc.offsets = pc.desktop.pieceOffsets()
+	return pc, nil
+}
+
+// errNoOffsets means that a puzzle's pieces cannot be placed on its image.
+var errNoOffsets = errors.New("palapuzzle: pieces have no offsets")
+
+// bounds returns the area covered by the pieces at their offsets, which is
+// the area of the puzzle's image.
+func (pc *puzzleContent) bounds() (image.Rectangle, error) {
+	var r image.Rectangle
+	for n, img := range pc.pieces {
+		off, ok := pc.offsets[n]
+		if !ok {
+			return r, errNoOffsets
+		}
+		b := img.Bounds()
+		r = r.Union(b.Sub(b.Min).Add(off))
+	}
+	if r.Empty() {
+		return r, errNoOffsets
+	}
+	return r, nil
+}
+
+// composite draws every piece at its offset onto a white background,
+// reconstructing the puzzle's image.
+func (pc *puzzleContent) composite() (*image.RGBA, error) {
+	r, err := pc.bounds()
+	if err != nil {
+		return nil, err
+	}
+	canvas := image.NewRGBA(r.Sub(r.Min))
+	draw.Draw(canvas, canvas.Bounds(), image.NewUniform(color.White), image.Point{}, draw.Src)
+	for n, img := range pc.pieces {
+		b := img.Bounds()
+		dst := b.Sub(b.Min).Add(pc.offsets[n]).Sub(r.Min)
+		draw.Draw(canvas, dst, img, b.Min, draw.Over)
+	}
+	return canvas, nil
+}
+
+// compositeJPEG returns the puzzle's image, reconstructed from its pieces,
+// encoded as a JPEG.
+func (pc *puzzleContent) compositeJPEG() ([]byte, error) {
+	img, err := pc.composite()
+	if err != nil {
+		return nil, err
+	}
+	var buf bytes.Buffer
+	if err := jpeg.Encode(&buf, img, &jpeg.Options{Quality: imageQuality}); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// shrinkJPEG returns jpg, a JPEG image, shrunk to be no more than maxSize
+// pixels across (if maxSize > 0) and encoded at the given quality (or
+// imageQuality, if it is 0). It returns jpg as it is if it cannot be
+// decoded, or if that would not make it any smaller.
+func shrinkJPEG(jpg []byte, maxSize, quality int) []byte {
+	img, err := jpeg.Decode(bytes.NewReader(jpg))
+	if err != nil {
+		return jpg
+	}
+	if b := img.Bounds(); maxSize > 0 {
+		if w, h := fitWithin(b.Dx(), b.Dy(), maxSize); w != b.Dx() || h != b.Dy() {
+			img = scaleImage(img, w, h)
+		}
+	}
+	if quality == 0 {
+		quality = imageQuality
+	}
+	var buf bytes.Buffer
+	if err := jpeg.Encode(&buf, img, &jpeg.Options{Quality: quality}); err != nil || buf.Len() >= len(jpg) {
+		return jpg
+	}
+	return buf.Bytes()
+}
+
+// writeMember writes a regular member with the given name and content,
+// using tmpl (if not nil) for its other header fields.
+func writeMember(tw *tar.Writer, name string, data []byte, tmpl *tar.Header) error {
+	hdr := &tar.Header{Typeflag: tar.TypeReg, Mode: 0644}
+	if tmpl != nil {
+		hdr = resizedHeader(tmpl, int64(len(data)))
+	}
+	hdr.Name, hdr.Size = name, int64(len(data))
+	if err := tw.WriteHeader(hdr); err != nil {
+		return err
+	}
+	_, err := tw.Write(data)
+	return err
+}
+
+// resizedHeader returns a copy of hdr for a member of the given size.
+func resizedHeader(hdr *tar.Header, size int64) *tar.Header {
+	ret := *hdr
+	ret.Size = size
+	if hdr.PAXRecords != nil {
+		// Don't let a stale record override the new values.
+		ret.PAXRecords = make(map[string]string)
+		for k, v := range hdr.PAXRecords {
+			if k != "path" && k != "size" {
+				ret.PAXRecords[k] = v
+			}
+		}
+	}
+	return &ret
+}
+
+// checkJPEG reports what is wrong with the JPEG image data, if anything: it
+// must start and end with the SOI and EOI markers, and decode.
+func checkJPEG(data []byte) error {
+	if !bytes.HasPrefix(data, []byte{0xff, 0xd8}) {
+		return errors.New("no start-of-image marker")
+	}
+	if !bytes.HasSuffix(bytes.TrimRight(data, "\x00"), []byte{0xff, 0xd9}) {
+		return errors.New("no end-of-image marker; cut short?")
+	}
+	_, err := jpeg.Decode(bytes.NewReader(data))
+	return err
+}
@@ -0,0 +1,249 @@
+package palapuzzle
+
+import (
+	"archive/tar"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"io"
+	"math"
+	"math/bits"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// ThumbnailSize is the largest width or height of the thumbnails made by
+// ExportHashes.
+const ThumbnailSize = 256
+
+// An ImageHash identifies a puzzle's picture, for finding where it came
+// from with reverse image search tools. It is written by ExportHashes as a
+// line of JSON.
+type ImageHash struct {
+	File   string `json:"file"`
+	Title  string `json:"title"`
+	Author string `json:"author"`
+	Width  int    `json:"width"`
+	Height int    `json:"height"`
+	// A 64-bit DCT perceptual hash ("pHash"), as 16 hex digits; similar
+	// pictures have hashes differing in few bits
+	PHash string `json:"phash"`
+	// A 64-bit difference hash ("dHash"), likewise
+	DHash string `json:"dhash"`
+	// The thumbnail's path, if one was written
+	Thumbnail string `json:"thumbnail,omitempty"`
+	// Whether the picture was rebuilt from the pieces, because the
+	// puzzle's image.jpg was missing or unreadable
+	Rebuilt bool `json:"rebuilt,omitempty"`
+}
+
+// A PictureHash holds perceptual hashes of a puzzle's picture, as worked out
+// under the PerceptualHash option; they are the same as an ImageHash's.
+type PictureHash struct {
+	PHash uint64
+	DHash uint64
+}
+
+// Distance returns how many bits of h's and other's pHashes differ, from 0
+// to 64. Pictures less than about 10 apart are probably the same, perhaps
+// resized or recompressed, as when one picture is cut into puzzles with
+// different piece counts.
+func (h PictureHash) Distance(other PictureHash) int {
+	return bits.OnesCount64(h.PHash ^ other.PHash)
+}
+
+// HashPuzzle returns the hashes of the picture of the puzzle at path, and a
+// thumbnail of it (at most ThumbnailSize pixels across) encoded as a JPEG.
+func HashPuzzle(path string) (*ImageHash, []byte, error) {
+	pi, err := ScanPuzzle(path)
+	if err != nil {
+		return nil, nil, err
+	}
+	img, rebuilt, err := puzzleImage(path)
+	if err != nil {
+		return nil, nil, err
+	}
+	b := img.Bounds()
+	ih := &ImageHash{
+		File: path, Title: pi.Title, Author: pi.Author,
+		Width: b.Dx(), Height: b.Dy(), Rebuilt: rebuilt,
+		PHash: fmt.Sprintf("%016x", pHash(img)),
+		DHash: fmt.Sprintf("%016x", dHash(img)),
+	}
+	tw, th := fitWithin(b.Dx(), b.Dy(), ThumbnailSize)
+	var buf bytes.Buffer
+	if err := jpeg.Encode(&buf, scaleImage(img, tw, th), &jpeg.Options{Quality: imageQuality}); err != nil {
+		return nil, nil, &Error{"make thumbnail for", path, err}
+	}
+	return ih, buf.Bytes(), nil
+}
+
+// ExportHashes writes the ImageHash of each of the puzzles at paths to w, as
+// one line of JSON each. If thumbDir is not "", a thumbnail of each is
+// written there too, named after the puzzle with ".jpg" in place of
+// ".puzzle" (and a number added if puzzles in different directories have
+// the same name). Puzzles which cannot be read are left out, and their errors
+// joined into the returned error.
+func ExportHashes(w io.Writer, paths []string, thumbDir string) error {
+	enc := json.NewEncoder(w)
+	used := make(map[string]bool) // Thumbnail names
+	var errs []error
+	for _, p := range paths {
+		ih, thumb, err := HashPuzzle(p)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		if thumbDir != "" {
+			base := strings.TrimSuffix(filepath.Base(p), ".puzzle")
+			name := base + ".jpg"
+			for i := 2; used[name]; i++ {
+				name = fmt.Sprintf("%s-%d.jpg", base, i)
+			}
+			used[name] = true
+			ih.Thumbnail = filepath.Join(thumbDir, name)
+			if err := os.WriteFile(ih.Thumbnail, thumb, 0644); err != nil {
+				return &Error{"write thumbnail", ih.Thumbnail, err}
+			}
+		}
+		if err := enc.Encode(ih); err != nil {
+			return err
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// puzzleImage returns the picture of the puzzle at path: its image.jpg, or
+// if that is missing or unreadable, the pieces composited at their offsets.
+// It reports which.
+func puzzleImage(path string) (image.Image, bool, error) {
+	var img image.Image
+	err := walkPuzzle(path, func(hdr *tar.Header, r io.Reader) error {
+		if hdr.Name == "image.jpg" {
+			img, _ = jpeg.Decode(r)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, false, err
+	}
+	if img != nil {
+		return img, false, nil
+	}
+	pc, err := readContent(path)
+	if err != nil {
+		return nil, false, err
+	}
+	rgba, err := pc.composite()
+	if err != nil {
+		return nil, false, &Error{"rebuild image for", path, err}
+	}
+	return rgba, true, nil
+}
+
+// fitWithin returns the size of a w×h image shrunk, keeping its shape, to be
+// no more than size pixels across either way; or w and h if it already is.
+func fitWithin(w, h, size int) (int, int) {
+	if w <= size && h <= size {
+		return w, h
+	}
+	if w >= h {
+		return size, max(1, h*size/w)
+	}
+	return max(1, w*size/h), size
+}
+
+// scaleImage scales img to w×h pixels, averaging the pixels that fall in
+// each pixel of the result. It is for shrinking; enlarging makes it blocky.
+func scaleImage(img image.Image, w, h int) *image.RGBA {
+	b := img.Bounds()
+	dst := image.NewRGBA(image.Rect(0, 0, w, h))
+	for y := 0; y < h; y++ {
+		y0, y1 := b.Min.Y+y*b.Dy()/h, b.Min.Y+(y+1)*b.Dy()/h
+		y1 = max(y1, y0+1)
+		for x := 0; x < w; x++ {
+			x0, x1 := b.Min.X+x*b.Dx()/w, b.Min.X+(x+1)*b.Dx()/w
+			x1 = max(x1, x0+1)
+			var r, g, bl, a, n uint64
+			for sy := y0; sy < y1; sy++ {
+				for sx := x0; sx < x1; sx++ {
+					cr, cg, cb, ca := img.At(sx, sy).RGBA()
+					r, g, bl, a, n = r+uint64(cr), g+uint64(cg), bl+uint64(cb), a+uint64(ca), n+1
+				}
+			}
+			dst.SetRGBA(x, y, color.RGBA{uint8(r / n >> 8), uint8(g / n >> 8), uint8(bl / n >> 8), uint8(a / n >> 8)})
+		}
+	}
+	return dst
+}
+
+// grey returns img scaled to w×h as grey levels, row by row.
+func grey(img image.Image, w, h int) []float64 {
+	small := scaleImage(img, w, h)
+	ret := make([]float64, w*h)
+	for i := range ret {
+		c := small.RGBAAt(i%w, i/w)
+		ret[i] = 0.299*float64(c.R) + 0.587*float64(c.G) + 0.114*float64(c.B)
+	}
+	return ret
+}
+
+// dHash returns the difference hash of img: one bit for each pair of
+// horizontally adjacent pixels of a 9×8 grey version, set if the left one
+// is brighter.
+func dHash(img image.Image) uint64 {
+	g := grey(img, 9, 8)
+	var h uint64
+	for y := 0; y < 8; y++ {
+		for x := 0; x < 8; x++ {
+			h <<= 1
+			if g[y*9+x] > g[y*9+x+1] {
+				h |= 1
+			}
+		}
+	}
+	return h
+}
+
+// pHash returns the DCT perceptual hash of img: the 8×8 lowest frequencies
+// of the discrete cosine transform of a 32×32 grey version, one bit each,
+// set if above their median (ignoring the DC term).
+func pHash(img image.Image) uint64 {
+	const n = 32
+	g := grey(img, n, n)
+	cos := make([]float64, n*8)
+	for u := 0; u < 8; u++ {
+		for x := 0; x < n; x++ {
+			cos[u*n+x] = math.Cos(float64(2*x+1) * float64(u) * math.Pi / (2 * n))
+		}
+	}
+	var coef [64]float64
+	for v := 0; v < 8; v++ {
+		for u := 0; u < 8; u++ {
+			var sum float64
+			for y := 0; y < n; y++ {
+				for x := 0; x < n; x++ {
+					sum += g[y*n+x] * cos[u*n+x] * cos[v*n+y]
+				}
+			}
+			coef[v*8+u] = sum
+		}
+	}
+	sorted := append([]float64(nil), coef[1:]...)
+	sort.Float64s(sorted)
+	median := sorted[len(sorted)/2]
+	var h uint64
+	for _, c := range coef {
+		h <<= 1
+		if c > median {
+			h |= 1
+		}
+	}
+	return h
+}
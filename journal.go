@@ -0,0 +1,302 @@
+package palapuzzle
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"time"
+)
+
+// journalName is the name of a Collection's journal within its directory.
+const journalName = ".palapuzzle-journal"
+
+// A JournalEntry records one change made to a Collection with a journal.
+type JournalEntry struct {
+	ID     int       `json:"id"`
+	Time   time.Time `json:"time"`
+	Op     string    `json:"op"`               // "import", "remove", "edit" or "undo"
+	Name   string    `json:"name"`             // The puzzle concerned
+	Saved  string    `json:"saved,omitempty"`  // A copy of it as it was before
+	Undoes int       `json:"undoes,omitempty"` // For "undo", the entry undone
+}
+
+// Journal returns the entries of c's journal, oldest first. A collection
+// without a journal has no entries.
+func (c *Collection) Journal() ([]JournalEntry, error) {
+	r, err := c.backend().Open(c.Path(journalName))
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	} else if err != nil {
+		return nil, &Error{"read journal of", c.Dir, err}
+	}
+	defer r.Close()
+	var ret []JournalEntry
+	sc := bufio.NewScanner(r)
+	for sc.Scan() {
+		var e JournalEntry
+		if err := json.Unmarshal(sc.Bytes(), &e); err != nil {
+			return nil, &Error{"parse journal of", c.Dir, err}
+		}
+		ret = append(ret, e)
+	}
+	if err := sc.Err(); err != nil {
+		return nil, &Error{"read journal of", c.Dir, err}
+	}
+	return ret, nil
+}
+
+// journalTail is how much of the end of a journal lastJournalID reads: far
+// more than any one entry takes.
+const journalTail = 4096
+
+// record appends an entry to c's journal, if it keeps one, filling in its
+// ID and time. Only the new line is written, if the Backend can add to the
+// end of a file (see appender); otherwise the journal is copied with the
+// line added.
+func (c *Collection) record(e JournalEntry) error {
+	if !c.KeepJournal {
+		return nil
+	}
+	id, err := c.lastJournalID()
+	if err != nil {
+		return err
+	}
+	e.ID, e.Time = id+1, time.Now().UTC()
+	line, err := json.Marshal(e)
+	if err != nil {
+		return &Error{"write journal of", c.Dir, err} // Should never happen
+	}
+	line = append(line, '\n')
+	b, name := c.backend(), c.Path(journalName)
+	var out io.WriteCloser
+	if a, ok := b.(appender); ok {
+		out, err = a.Append(name)
+	} else {
+		var old []byte
+		if r, err := b.Open(name); err == nil {
+			old, err = io.ReadAll(r)
+			r.Close()
+			if err != nil {
+				return &Error{"read journal of", c.Dir, err}
+			}
+		} else if !errors.Is(err, fs.ErrNotExist) {
+			return &Error{"read journal of", c.Dir, err}
+		}
+		line = append(old, line...)
+		out, err = b.Write(name)
+	}
+	if err == nil {
+		_, err = out.Write(line)
+		if err != nil {
+			abort(out)
+		} else {
+			err = out.Close()
+		}
+	}
+	if err != nil {
+		return &Error{"write journal of", c.Dir, err}
+	}
+	return nil
+}
+
+// lastJournalID returns the ID of the last entry in c's journal, or 0 if it
+// has none. If the journal can be seeked in, as local files can, only its
+// last journalTail bytes are read.
+func (c *Collection) lastJournalID() (int, error) {
+	r, err := c.backend().Open(c.Path(journalName))
+	if errors.Is(err, fs.ErrNotExist) {
+		return 0, nil
+	} else if err != nil {
+		return 0, &Error{"read journal of", c.Dir, err}
+	}
+	defer r.Close()
+	partial := false // Whether the first line read may be part of one
+	if s, ok := r.(io.Seeker); ok {
+		if end, err := s.Seek(0, io.SeekEnd); err == nil && end > journalTail {
+			_, err = s.Seek(end-journalTail, io.SeekStart)
+			partial = err == nil
+		} else {
+			s.Seek(0, io.SeekStart)
+		}
+	}
+	id := 0
+	sc := bufio.NewScanner(r)
+	for sc.Scan() {
+		var e JournalEntry
+		if partial {
+			partial = false
+		} else if err := json.Unmarshal(sc.Bytes(), &e); err != nil {
+			return 0, &Error{"parse journal of", c.Dir, err}
+		} else {
+			id = e.ID
+		}
+	}
+	if err := sc.Err(); err != nil {
+		return 0, &Error{"read journal of", c.Dir, err}
+	}
+	return id, nil
+}
+
+// save copies the named puzzle aside so that a change to it can be undone,
+// and returns the copy's name, or "" if c keeps no journal.
+func (c *Collection) save(name string) (string, error) {
+	if !c.KeepJournal {
+		return "", nil
+	}
+	saved := fmt.Sprintf(".%s.undo-%d", name, time.Now().UnixNano())
+	b := c.backend()
+	if err := copyBetween(b, c.Path(saved), b, c.Path(name), nil); err != nil {
+		return "", &Error{"save a copy of", c.Path(name), err}
+	}
+	return saved, nil
+}
+
+// Remove deletes the named puzzle from c. If c keeps a journal, the puzzle
+// is moved aside instead, so that Undo can restore it. Remove needs a
+// Backend which can delete files, such as Local. It heeds the DryRun option.
+func (c *Collection) Remove(name string, opts ...Option) error {
+	o := getOptions(opts)
+	dst := c.Path(name)
+	rm, ok := c.backend().(remover)
+	if !ok {
+		return &Error{"remove", dst, errors.ErrUnsupported}
+	}
+	if _, err := c.backend().Stat(dst); err != nil {
+		return &Error{"remove", dst, err}
+	}
+	if o.dryRun != nil {
+		*o.dryRun = Plan{Files: []FileChange{{dst, "remove"}}}
+		return nil
+	}
+	saved, err := c.save(name)
+	if err != nil {
+		return err
+	}
+	if err := rm.Remove(dst); err != nil {
+		return &Error{"remove", dst, err}
+	}
+	return c.record(JournalEntry{Op: "remove", Name: name, Saved: saved})
+}
+
+// Edit changes the named puzzle in c by calling fn with a local path to it,
+// which fn may modify (as SlimPuzzle and the like do) or replace. If the
+// Backend is not Local, the puzzle is copied to a temporary file for fn and
+// copied back afterwards. If c keeps a journal, the puzzle as it was is
+// saved first, so that Undo can restore it. Edit heeds the DryRun option,
+// under which fn is not called, and the Plan only says that the puzzle
+// would be replaced.
+func (c *Collection) Edit(name string, fn func(path string) error, opts ...Option) error {
+	o := getOptions(opts)
+	b, dst := c.backend(), c.Path(name)
+	if _, err := b.Stat(dst); err != nil {
+		return &Error{"edit", dst, err}
+	}
+	if o.dryRun != nil {
+		*o.dryRun = Plan{Files: []FileChange{{dst, "replace"}}}
+		return nil
+	}
+	saved, err := c.save(name)
+	if err != nil {
+		return err
+	}
+	if b == Local {
+		err = fn(dst)
+	} else {
+		err = editCopy(b, dst, fn)
+	}
+	if err != nil {
+		if saved != "" {
+			if rm, ok := b.(remover); ok {
+				rm.Remove(c.Path(saved))
+			}
+		}
+		return err
+	}
+	return c.record(JournalEntry{Op: "edit", Name: name, Saved: saved})
+}
+
+// editCopy has fn edit a local copy of the file name in b, then writes the
+// result back.
+func editCopy(b Backend, name string, fn func(path string) error) error {
+	f, err := os.CreateTemp("", "palapuzzle-*-"+path.Base(name))
+	if err != nil {
+		return &Error{"edit", name, err}
+	}
+	tmp := f.Name()
+	defer os.Remove(tmp)
+	in, err := b.Open(name)
+	if err == nil {
+		_, err = io.Copy(f, in)
+		in.Close()
+	}
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		return &Error{"edit", name, err}
+	}
+	if err := fn(tmp); err != nil {
+		return err
+	}
+	if err := copyBetween(b, name, Local, tmp, nil); err != nil {
+		return &Error{"write", name, err}
+	}
+	return nil
+}
+
+// Undo reverts the last n changes recorded in c's journal which have not
+// already been undone, newest first: imported puzzles are removed, and
+// removed or edited ones are put back as they were. Each change undone is
+// itself recorded, as an "undo" entry, but undos cannot be undone.
+//
+// Undo stops at the first change it cannot revert. Removing imported
+// puzzles needs a Backend which can delete files, such as Local.
+func (c *Collection) Undo(n int) error {
+	entries, err := c.Journal()
+	if err != nil {
+		return err
+	}
+	undone := make(map[int]bool)
+	for _, e := range entries {
+		if e.Op == "undo" {
+			undone[e.Undoes] = true
+		}
+	}
+	b := c.backend()
+	rm, canRemove := b.(remover)
+	for i := len(entries) - 1; i >= 0 && n > 0; i-- {
+		e := entries[i]
+		if e.Op == "undo" || undone[e.ID] {
+			continue
+		}
+		dst := c.Path(e.Name)
+		switch {
+		case e.Op == "import":
+			if !canRemove {
+				return &Error{"undo import of", dst, errors.ErrUnsupported}
+			}
+			if err := rm.Remove(dst); err != nil && !errors.Is(err, fs.ErrNotExist) {
+				return &Error{"undo import of", dst, err}
+			}
+		case e.Saved != "":
+			if err := copyBetween(b, dst, b, c.Path(e.Saved), nil); err != nil {
+				return &Error{"undo " + e.Op + " of", dst, err}
+			}
+			if canRemove {
+				rm.Remove(c.Path(e.Saved))
+			}
+		default:
+			return &Error{"undo " + e.Op + " of", dst, errors.New("no saved copy")}
+		}
+		if err := c.record(JournalEntry{Op: "undo", Name: e.Name, Undoes: e.ID}); err != nil {
+			return err
+		}
+		n--
+	}
+	return nil
+}
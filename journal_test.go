@@ -0,0 +1,121 @@
+package palapuzzle
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestJournalAppends(t *testing.T) {
+	for _, tc := range []struct {
+		name string
+		b    Backend
+	}{
+		{"Local", nil},
+		{"no Append", struct{ Backend }{Local}}, // Hides Local's Append
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			c := &Collection{Backend: tc.b, Dir: t.TempDir(), KeepJournal: true}
+			// Enough entries, with long enough names, that lastJournalID
+			// reads only the end.
+			long := strings.Repeat("x", 200)
+			var before []byte
+			for i := 0; i < 50; i++ {
+				if err := c.record(JournalEntry{Op: "edit", Name: long}); err != nil {
+					t.Fatal(err)
+				}
+				after, err := os.ReadFile(c.Path(journalName))
+				if err != nil {
+					t.Fatal(err)
+				}
+				if !bytes.HasPrefix(after, before) {
+					t.Fatalf("entry %d changed the ones before it", i+1)
+				}
+				before = after
+			}
+			if len(before) <= journalTail {
+				t.Fatalf("journal is only %d bytes", len(before))
+			}
+			entries, err := c.Journal()
+			if err != nil {
+				t.Fatal(err)
+			}
+			for i, e := range entries {
+				if e.ID != i+1 {
+					t.Fatalf("entry %d has ID %d", i, e.ID)
+				}
+			}
+			if len(entries) != 50 {
+				t.Errorf("%d entries, want 50", len(entries))
+			}
+		})
+	}
+}
+
+func TestJournalTransaction(t *testing.T) {
+	src := testPuzzle(t)
+	c := &Collection{Dir: t.TempDir(), KeepJournal: true}
+	errFail := errors.New("fail")
+	err := Transact(func(tx Option) error {
+		if _, err := c.Import(src, tx); err != nil {
+			return err
+		}
+		return errFail
+	})
+	if err != errFail {
+		t.Fatalf("Transact: %v", err)
+	}
+	if entries, _ := c.Journal(); len(entries) != 0 {
+		t.Errorf("after Rollback, journal has %v", entries)
+	}
+
+	err = Transact(func(tx Option) error {
+		_, err := c.Import(src, tx)
+		if entries, _ := c.Journal(); len(entries) != 0 {
+			t.Errorf("before Commit, journal has %v", entries)
+		}
+		return err
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	entries, err := c.Journal()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 1 || entries[0].Op != "import" || entries[0].Name != "test.puzzle" {
+		t.Errorf("after Commit, journal has %v", entries)
+	}
+}
+
+func TestEditDryRun(t *testing.T) {
+	c := &Collection{Dir: t.TempDir(), KeepJournal: true}
+	if _, err := c.Import(testPuzzle(t)); err != nil {
+		t.Fatal(err)
+	}
+	orig, _ := os.ReadFile(c.Path("test.puzzle"))
+	var plan Plan
+	called := false
+	err := c.Edit("test.puzzle", func(string) error { called = true; return nil }, DryRun(&plan))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if called {
+		t.Error("fn was called under DryRun")
+	}
+	want := []FileChange{{c.Path("test.puzzle"), "replace"}}
+	if len(plan.Files) != 1 || plan.Files[0] != want[0] {
+		t.Errorf("Plan.Files = %v, want %v", plan.Files, want)
+	}
+	if now, _ := os.ReadFile(c.Path("test.puzzle")); !bytes.Equal(now, orig) {
+		t.Error("the puzzle changed under DryRun")
+	}
+	if entries, _ := c.Journal(); len(entries) != 1 {
+		t.Errorf("journal has %v, want only the import", entries)
+	}
+	if es, _ := os.ReadDir(c.Dir); len(es) != 2 {
+		t.Errorf("directory has %v, want the puzzle and journal only", es)
+	}
+}
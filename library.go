@@ -0,0 +1,127 @@
+package palapuzzle
+
+import (
+	"errors"
+	"io/fs"
+)
+
+// A Library is several collections used together, such as Palapeli's own
+// collection, a mirror on a NAS and an archive on a USB drive. Each is one
+// of the Library's roots.
+type Library struct {
+	Roots []Root
+}
+
+// A Root is one of the collections of a Library.
+type Root struct {
+	Name       string // How the root is referred to, like "nas"
+	Collection *Collection
+	ReadOnly   bool // Whether the Library refuses to change it
+}
+
+// An Entry is a puzzle in a Library.
+type Entry struct {
+	Root string      // The name of the root it is in
+	Name string      // Its filename in that root
+	Info *PuzzleInfo // Its details, from Scan; nil from List
+}
+
+// ErrReadOnly is returned by a Library's methods for changes to a read-only
+// root.
+var ErrReadOnly = errors.New("palapuzzle: collection is read-only")
+
+// root returns the named root of l.
+func (l *Library) root(name string) (*Root, error) {
+	for i := range l.Roots {
+		if l.Roots[i].Name == name {
+			return &l.Roots[i], nil
+		}
+	}
+	return nil, &Error{"find root", name, fs.ErrNotExist}
+}
+
+// writable returns the named root of l, if it may be changed.
+func (l *Library) writable(name string) (*Root, error) {
+	r, err := l.root(name)
+	if err == nil && r.ReadOnly {
+		err = &Error{"change root", name, ErrReadOnly}
+	}
+	return r, err
+}
+
+// List returns the puzzles in every root of l, root by root in the order of
+// l.Roots, and by name within each. A root which cannot be listed (such as
+// a NAS that is switched off) is left out, and its error is joined into the
+// returned error.
+func (l *Library) List() ([]Entry, error) {
+	var ret []Entry
+	var errs []error
+	for _, r := range l.Roots {
+		names, err := r.Collection.List()
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		for _, name := range names {
+			ret = append(ret, Entry{Root: r.Name, Name: name})
+		}
+	}
+	return ret, errors.Join(errs...)
+}
+
+// Scan is like List, but also scans each puzzle. Puzzles that cannot be
+// scanned are left out, as for Collection.Scan.
+func (l *Library) Scan() ([]Entry, error) {
+	var ret []Entry
+	var errs []error
+	for _, r := range l.Roots {
+		infos, err := r.Collection.Scan()
+		if err != nil {
+			errs = append(errs, err)
+		}
+		for _, pi := range infos {
+			ret = append(ret, Entry{Root: r.Name, Name: pi.Filename, Info: pi})
+		}
+	}
+	return ret, errors.Join(errs...)
+}
+
+// Find returns the entries for every copy of the named puzzle in l.
+func (l *Library) Find(name string) ([]Entry, error) {
+	all, err := l.List()
+	var ret []Entry
+	for _, e := range all {
+		if e.Name == name {
+			ret = append(ret, e)
+		}
+	}
+	return ret, err
+}
+
+// Import imports src into the named root, as Collection.Import does.
+func (l *Library) Import(root, src string, opts ...Option) (*PuzzleInfo, error) {
+	r, err := l.writable(root)
+	if err != nil {
+		return nil, err
+	}
+	return r.Collection.Import(src, opts...)
+}
+
+// Remove removes the named puzzle from the named root, as
+// Collection.Remove does.
+func (l *Library) Remove(root, name string, opts ...Option) error {
+	r, err := l.writable(root)
+	if err != nil {
+		return err
+	}
+	return r.Collection.Remove(name, opts...)
+}
+
+// Edit edits the named puzzle in the named root, as Collection.Edit does.
+func (l *Library) Edit(root, name string, fn func(path string) error, opts ...Option) error {
+	r, err := l.writable(root)
+	if err != nil {
+		return err
+	}
+	return r.Collection.Edit(name, fn, opts...)
+}
@@ -0,0 +1,54 @@
+package palapuzzle
+
+import "fmt"
+
+// Limits bound the resources that scanning a puzzle may take, so that a
+// hostile or broken file (one which decompresses to gigabytes, say, or has
+// a member named "999999999.png") is rejected instead of exhausting memory
+// or time. A zero field means no limit.
+type Limits struct {
+	MaxBytes       int64 // Total size of the archive's members, uncompressed
+	MaxMembers     int   // How many members the archive may have
+	MaxPieceIndex  int   // The highest N allowed in a piece's name, N.png
+	MaxDesktopSize int64 // The size of pala.desktop
+	MaxMemberSize  int64 // The size of any one member
+}
+
+// DefaultLimits are the limits used by functions which scan puzzles, unless
+// the ScanLimits option says otherwise. They are far beyond what Palapeli
+// makes, and may be changed to suit.
+var DefaultLimits = Limits{
+	MaxBytes:       4 << 30,
+	MaxMembers:     1 << 20,
+	MaxPieceIndex:  1 << 20,
+	MaxDesktopSize: 16 << 20,
+	MaxMemberSize:  1 << 30,
+}
+
+// ScanLimits makes functions which scan puzzles use l instead of
+// DefaultLimits.
+func ScanLimits(l Limits) Option {
+	return func(o *options) { o.limits = &l }
+}
+
+// A LimitError reports that a puzzle went beyond one of its Limits. It
+// satisfies errors.Is(err, ErrTooLarge).
+type LimitError struct {
+	Limit string // The field of Limits, like "MaxMembers"
+	Max   int64  // Its value
+}
+
+func (e *LimitError) Error() string {
+	return fmt.Sprintf("palapuzzle: puzzle exceeds %s of %d", e.Limit, e.Max)
+}
+
+// Is reports whether target is ErrTooLarge, for the benefit of errors.Is.
+func (e *LimitError) Is(target error) bool { return target == ErrTooLarge }
+
+// scanLimits returns the limits that o says to scan with.
+func (o *options) scanLimits() Limits {
+	if o.limits != nil {
+		return *o.limits
+	}
+	return DefaultLimits
+}
@@ -0,0 +1,219 @@
+package palapuzzle
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"sync"
+)
+
+// A LintRule is one check of a scanned puzzle, which a Linter can run.
+// Every kind of finding this package reports (see FindingCodes) has a rule
+// of its own, whose ID is the kind's code, like "missing-piece"; others can
+// be added with RegisterRule.
+type LintRule interface {
+	// A stable identifier, by which the rule is enabled and disabled
+	ID() string
+	// How much the rule's findings matter
+	Severity() Severity
+	// Checks pi, and returns what is wrong with it. The Rule and Severity
+	// of each Finding are filled in by the Linter.
+	Run(pi *PuzzleInfo) []Finding
+}
+
+// A Finding is a problem found by a LintRule. Its fields are named in JSON
+// as their lower-case names.
+type Finding struct {
+	Rule     string   `json:"rule"` // The rule's ID
+	Severity Severity `json:"severity"`
+	// The kind of finding, for the rules of this package; zero for the
+	// rules added by RegisterRule
+	Kind   WarningKind       `json:"kind,omitempty"`
+	Text   string            `json:"text"` // Details, suitable for display
+	Params map[string]string `json:"params,omitempty"`
+}
+
+// Warning returns f as a Warning, which has no Rule or Severity of its own.
+func (f Finding) Warning() Warning {
+	return Warning{f.Kind, f.Text, f.Params}
+}
+
+// NewLintRule returns a LintRule with the given ID and severity, which
+// checks puzzles with run.
+func NewLintRule(id string, severity Severity, run func(pi *PuzzleInfo) []Finding) LintRule {
+	return funcRule{id, severity, run}
+}
+
+type funcRule struct {
+	id       string
+	severity Severity
+	run      func(pi *PuzzleInfo) []Finding
+}
+
+func (r funcRule) ID() string                   { return r.id }
+func (r funcRule) Severity() Severity           { return r.severity }
+func (r funcRule) Run(pi *PuzzleInfo) []Finding { return r.run(pi) }
+
+// A kindRule is the rule for one kind of finding: either those that
+// scanning found, or (if check is not nil) those that check finds.
+type kindRule struct {
+	kind  WarningKind
+	check func(pi *PuzzleInfo) []Warning
+	rules Rules // Which of Validate's sets of checks it is in
+}
+
+func (r kindRule) ID() string         { return r.kind.Code() }
+func (r kindRule) Severity() Severity { return r.kind.Severity() }
+
+func (r kindRule) Run(pi *PuzzleInfo) []Finding {
+	ws := pi.WarningsOf(r.kind)
+	if r.check != nil {
+		ws = r.check(pi)
+	}
+	var ret []Finding
+	for _, w := range ws {
+		ret = append(ret, Finding{Kind: w.Kind, Text: w.Text, Params: w.Params})
+	}
+	return ret
+}
+
+var (
+	rulesMu sync.Mutex
+	rules   []LintRule // In the order they were registered
+)
+
+func init() {
+	for _, fc := range findingCodes {
+		r := kindRule{kind: fc.Kind, rules: RuleScan}
+		switch fc.Kind {
+		case WarnBadPiece, WarnBadImage:
+			r.rules = RuleScan | RuleImages
+		case WarnNoDesktop:
+			r.rules = RuleManifest
+		case WarnMissingOffset:
+			r.check, r.rules = checkOffsets, RuleManifest
+		case WarnPieceCountMismatch:
+			r.check, r.rules = checkPieceCount, RulePieceCount
+		}
+		rules = append(rules, r)
+	}
+}
+
+// RegisterRule adds r to the rules which Linters run, after those already
+// registered. It is an error if there is already a rule with r's ID.
+func RegisterRule(r LintRule) error {
+	rulesMu.Lock()
+	defer rulesMu.Unlock()
+	for _, old := range rules {
+		if old.ID() == r.ID() {
+			return fmt.Errorf("palapuzzle: there is already a rule %q", r.ID())
+		}
+	}
+	rules = append(rules, r)
+	return nil
+}
+
+// LintRules returns every registered rule, in the order they were
+// registered: this package's own, in the order of FindingCodes, and then
+// those added by RegisterRule.
+func LintRules() []LintRule {
+	rulesMu.Lock()
+	defer rulesMu.Unlock()
+	return append([]LintRule(nil), rules...)
+}
+
+// A Linter runs a chosen set of LintRules. The zero Linter runs them all.
+type Linter struct {
+	// The IDs of the rules to run; if empty, every registered rule
+	Enable []string
+	// The IDs of rules not to run, even if they are in Enable
+	Disable []string
+}
+
+// Lint checks pi by l's rules, in the order they were registered, and
+// returns what they find. It is an error if l names a rule that is not
+// registered, which is usually a typo.
+func (l *Linter) Lint(pi *PuzzleInfo) ([]Finding, error) {
+	all := LintRules()
+	known := make(map[string]bool, len(all))
+	for _, r := range all {
+		known[r.ID()] = true
+	}
+	enabled, disabled := make(map[string]bool), make(map[string]bool)
+	for _, ids := range []struct {
+		ids []string
+		set map[string]bool
+	}{{l.Enable, enabled}, {l.Disable, disabled}} {
+		for _, id := range ids.ids {
+			if !known[id] {
+				return nil, fmt.Errorf("palapuzzle: no rule %q", id)
+			}
+			ids.set[id] = true
+		}
+	}
+	var ret []Finding
+	for _, r := range all {
+		if disabled[r.ID()] || (len(enabled) > 0 && !enabled[r.ID()]) {
+			continue
+		}
+		for _, f := range r.Run(pi) {
+			f.Rule, f.Severity = r.ID(), r.Severity()
+			ret = append(ret, f)
+		}
+	}
+	return ret, nil
+}
+
+// ruleIDs returns the IDs of the rules in Validate's sets of checks.
+// Rules added by RegisterRule count as part of RuleScan.
+func ruleIDs(sets Rules) []string {
+	var ids []string
+	for _, r := range LintRules() {
+		in := RuleScan
+		if kr, ok := r.(kindRule); ok {
+			in = kr.rules
+		}
+		if sets&in != 0 {
+			ids = append(ids, r.ID())
+		}
+	}
+	return ids
+}
+
+// checkOffsets finds pieces with no offset in pala.desktop.
+func checkOffsets(pi *PuzzleInfo) []Warning {
+	if pi.desktop == nil {
+		return nil // Which scanning warns of
+	}
+	offsets := pi.desktop.pieceOffsets()
+	if len(offsets) == 0 && len(pi.PieceSizes) > 0 {
+		return []Warning{newWarning(WarnMissingOffset, "no piece has an offset")}
+	}
+	nums := make([]int, 0, len(pi.PieceSizes))
+	for n := range pi.PieceSizes {
+		if _, ok := offsets[n]; !ok {
+			nums = append(nums, n)
+		}
+	}
+	sort.Ints(nums)
+	var ret []Warning
+	for _, n := range nums {
+		ret = append(ret, newWarning(WarnMissingOffset,
+			fmt.Sprintf(`no offset for "%d.png"`, n), "piece", strconv.Itoa(n)))
+	}
+	return ret
+}
+
+// checkPieceCount finds a PieceCount which does not match the pieces.
+func checkPieceCount(pi *PuzzleInfo) []Warning {
+	m := pi.PieceCountMismatch()
+	if m == nil {
+		return nil
+	}
+	text := fmt.Sprintf("PieceCount is %d, but there are %d pieces", m.Declared, m.Found)
+	if m.Declared == m.Found {
+		text = fmt.Sprintf("PieceCount is %d, but the pieces are not numbered 0 to %d", m.Declared, m.Declared-1)
+	}
+	return []Warning{newWarning(WarnPieceCountMismatch, text,
+		"declared", strconv.Itoa(m.Declared), "found", strconv.Itoa(m.Found))}
+}
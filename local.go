@@ -0,0 +1,80 @@
+//go:build !js
+
+package palapuzzle
+
+import (
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+)
+
+// Local is the Backend for the local filesystem. It accepts any path that
+// os.Open does.
+var Local Backend = localBackend{}
+
+type localBackend struct{}
+
+func (localBackend) Open(name string) (io.ReadCloser, error) { return os.Open(name) }
+
+func (localBackend) Stat(name string) (fs.FileInfo, error) { return os.Stat(name) }
+
+func (localBackend) Remove(name string) error { return os.Remove(name) }
+
+func (localBackend) Append(name string) (io.WriteCloser, error) {
+	return os.OpenFile(name, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0644)
+}
+
+func (localBackend) List(dir string) ([]fs.FileInfo, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	var ret []fs.FileInfo
+	for _, e := range entries {
+		fi, err := e.Info()
+		if err != nil {
+			continue // Removed since ReadDir; ignore it
+		}
+		ret = append(ret, fi)
+	}
+	return ret, nil
+}
+
+// Write writes to a temporary file in the same directory, which Close
+// renames over the target.
+func (localBackend) Write(name string) (io.WriteCloser, error) {
+	dir, base := filepath.Split(name)
+	if dir == "" {
+		dir = "."
+	}
+	f, err := os.CreateTemp(dir, "."+base+".tmp-*")
+	if err != nil {
+		return nil, err
+	}
+	return &localWriter{f, name}, nil
+}
+
+type localWriter struct {
+	*os.File
+	target string
+}
+
+func (w *localWriter) Close() error {
+	err := w.File.Close()
+	if err == nil {
+		err = os.Chmod(w.Name(), 0644)
+	}
+	if err == nil {
+		err = os.Rename(w.Name(), w.target)
+	}
+	if err != nil {
+		os.Remove(w.Name())
+	}
+	return err
+}
+
+func (w *localWriter) Abort() error {
+	w.File.Close()
+	return os.Remove(w.Name())
+}
@@ -0,0 +1,32 @@
+//go:build js
+
+package palapuzzle
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+)
+
+// Local stands in for the local filesystem, which a browser does not have:
+// every method fails with an error satisfying
+// errors.Is(err, errors.ErrUnsupported). Use ScanBytes for a puzzle the
+// user has picked, or a Collection with another Backend.
+var Local Backend = localBackend{}
+
+type localBackend struct{}
+
+var errNoLocal = fmt.Errorf("palapuzzle: no local filesystem under js: %w", errors.ErrUnsupported)
+
+func (localBackend) Open(name string) (io.ReadCloser, error) { return nil, errNoLocal }
+
+func (localBackend) Stat(name string) (fs.FileInfo, error) { return nil, errNoLocal }
+
+func (localBackend) Remove(name string) error { return errNoLocal }
+
+func (localBackend) Append(name string) (io.WriteCloser, error) { return nil, errNoLocal }
+
+func (localBackend) List(dir string) ([]fs.FileInfo, error) { return nil, errNoLocal }
+
+func (localBackend) Write(name string) (io.WriteCloser, error) { return nil, errNoLocal }
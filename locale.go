@@ -0,0 +1,54 @@
+package palapuzzle
+
+import "strings"
+
+// TitleFor returns the puzzle's title in the given locale, falling back as
+// the Desktop Entry Specification says: a locale like "sr_RS@latin" looks
+// for Name[sr_RS@latin], then Name[sr_RS], Name[sr@latin] and Name[sr],
+// and then the untranslated Title. Locales may be given as in $LANG, with
+// an encoding ("de_AT.UTF-8"), or as language tags ("de-AT").
+func (pi *PuzzleInfo) TitleFor(locale string) string {
+	return localized(pi.Titles, locale, pi.Title)
+}
+
+// CommentFor is like TitleFor, for the puzzle's comment.
+func (pi *PuzzleInfo) CommentFor(locale string) string {
+	return localized(pi.Comments, locale, pi.Comment)
+}
+
+// localized returns the best match for locale in m, or def if there is none.
+func localized(m map[string]string, locale, def string) string {
+	for _, l := range localeFallbacks(locale) {
+		if v, ok := m[l]; ok {
+			return v
+		}
+	}
+	return def
+}
+
+// localeFallbacks returns the keys to look for, best first, for locale.
+func localeFallbacks(locale string) []string {
+	locale = strings.ReplaceAll(locale, "-", "_")
+	var modifier string
+	if i := strings.IndexByte(locale, '@'); i >= 0 {
+		locale, modifier = locale[:i], locale[i:]
+	}
+	if i := strings.IndexByte(locale, '.'); i >= 0 {
+		locale = locale[:i] // The encoding, which translations do not name
+	}
+	if locale == "" || locale == "C" || locale == "POSIX" {
+		return nil
+	}
+	lang, country, _ := strings.Cut(locale, "_")
+	var ret []string
+	if country != "" {
+		if modifier != "" {
+			ret = append(ret, lang+"_"+country+modifier)
+		}
+		ret = append(ret, lang+"_"+country)
+	}
+	if modifier != "" {
+		ret = append(ret, lang+modifier)
+	}
+	return append(ret, lang)
+}
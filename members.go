@@ -0,0 +1,72 @@
+package palapuzzle
+
+import (
+	"archive/tar"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+)
+
+// A MemberInfo describes one member of a puzzle's archive.
+type MemberInfo struct {
+	Name    string
+	Size    int64
+	ModTime time.Time
+	Type    byte // The tar typeflag, like tar.TypeReg
+}
+
+// ListMembers returns a description of every member of the puzzle at path
+// (or URL, as for ScanPuzzle), in order, including any that this package
+// does not understand. Nothing is checked or decoded, so it works on
+// puzzles too broken to scan; if the archive itself is damaged, the members
+// before the damage are returned along with the error.
+func ListMembers(path string) ([]MemberInfo, error) {
+	var ret []MemberInfo
+	err := walkPuzzle(path, func(hdr *tar.Header, r io.Reader) error {
+		ret = append(ret, MemberInfo{hdr.Name, hdr.Size, hdr.ModTime, hdr.Typeflag})
+		return nil
+	})
+	return ret, err
+}
+
+// unsafeMember returns why it would be unsafe to unpack the member with
+// header hdr, or "" if it is safe: names which climb out of the archive or
+// are absolute could be made to overwrite any file, and links and devices
+// have no business in a puzzle. Anything which unpacks members must refuse
+// those for which it returns a reason.
+func unsafeMember(hdr *tar.Header) string {
+	name := strings.ReplaceAll(hdr.Name, "\\", "/") // As Windows would see it
+	switch {
+	case strings.HasPrefix(name, "/") || (len(name) >= 2 && name[1] == ':'):
+		return "absolute path"
+	case name == ".." || strings.HasPrefix(name, "../") || strings.HasSuffix(name, "/..") ||
+		strings.Contains(name, "/../"):
+		return `".." in path`
+	}
+	switch hdr.Typeflag {
+	case tar.TypeSymlink, tar.TypeLink:
+		return "link to " + hdr.Linkname
+	case tar.TypeChar, tar.TypeBlock, tar.TypeFifo:
+		return "device or pipe"
+	}
+	return ""
+}
+
+// checkSize returns err, the error from reading n bytes of the content of
+// the member with header hdr, or an error if n is not the size the header
+// gives, so that where an archive is cut short or corrupt can be told from
+// which member it is in.
+func checkSize(hdr *tar.Header, n int64, err error) error {
+	switch {
+	case err != nil && n < hdr.Size:
+		return fmt.Errorf("member %q has only %d of its %d bytes: %w", hdr.Name, n, hdr.Size, err)
+	case err != nil:
+		return err
+	case n < hdr.Size:
+		return fmt.Errorf("member %q has only %d of its %d bytes: %w", hdr.Name, n, hdr.Size, io.ErrUnexpectedEOF)
+	case n > hdr.Size:
+		return fmt.Errorf("member %q has more than its %d bytes", hdr.Name, hdr.Size)
+	}
+	return nil
+}
@@ -0,0 +1,204 @@
+package palapuzzle
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"image"
+	"image/draw"
+	"image/jpeg"
+	"io"
+	"sort"
+	"strconv"
+	"time"
+)
+
+// A MergeLayout says where MergePuzzles puts the second puzzle's picture.
+type MergeLayout int
+
+const (
+	SideBySide MergeLayout = iota // To the right of the first
+	Stacked                       // Below the first
+)
+
+// MergePuzzles writes a "double puzzle" to dst: the puzzles a and b as one,
+// with b's picture next to a's, as layout says, both at the top left of
+// where they go (any space left over, where one is smaller, is white). The
+// pieces of a come first, then those of b, numbered from 0 with no gaps
+// (as Repair would number them), and b's offsets are moved with its
+// picture. The combined pala.desktop has both titles, authors and so on,
+// joined by "&" or ";" where they differ, but no slicer settings beyond
+// PieceCount, as the two may have been cut in different ways.
+//
+// Both puzzles need an image.jpg that can be decoded, as the new one is
+// drawn from them. Any other members are copied, from a and then b; only
+// the first of any name is kept. CHECKSUMS and SIGNATURE are left out, as
+// neither would match. MergePuzzles heeds the writing options (see Option).
+func MergePuzzles(dst, a, b string, layout MergeLayout, opts ...Option) error {
+	if layout != SideBySide && layout != Stacked {
+		return &Error{"merge puzzles into", dst, fmt.Errorf("palapuzzle: unknown MergeLayout %d", layout)}
+	}
+	var srcs [2]*mergeSource
+	for i, path := range []string{a, b} {
+		s, err := openMergeSource(path)
+		if err != nil {
+			return err
+		}
+		srcs[i] = s
+	}
+	ra, rb := srcs[0].img.Bounds(), srcs[1].img.Bounds()
+	shift := image.Pt(ra.Dx(), 0)
+	size := image.Pt(ra.Dx()+rb.Dx(), max(ra.Dy(), rb.Dy()))
+	if layout == Stacked {
+		shift = image.Pt(0, ra.Dy())
+		size = image.Pt(max(ra.Dx(), rb.Dx()), ra.Dy()+rb.Dy())
+	}
+	canvas := image.NewRGBA(image.Rectangle{Max: size})
+	draw.Draw(canvas, canvas.Bounds(), image.White, image.Point{}, draw.Src)
+	draw.Draw(canvas, ra.Sub(ra.Min), srcs[0].img, ra.Min, draw.Src)
+	draw.Draw(canvas, rb.Sub(rb.Min).Add(shift), srcs[1].img, rb.Min, draw.Src)
+	var jpg bytes.Buffer
+	if err := jpeg.Encode(&jpg, canvas, &jpeg.Options{Quality: imageQuality}); err != nil {
+		return &Error{"encode member image.jpg of", dst, err}
+	}
+	srcs[1].shift, srcs[1].first = shift, len(srcs[0].nums)
+
+	var offsets []image.Point
+	for _, s := range srcs {
+		off := s.info.desktop.pieceOffsets()
+		for _, n := range s.nums {
+			offsets = append(offsets, off[n].Add(s.shift))
+		}
+	}
+	ia, ib := srcs[0].info, srcs[1].info
+	desk := newDesktop(Metadata{
+		Title:   joinDistinct(ia.Title, ib.Title, " & "),
+		Author:  joinDistinct(ia.Author, ib.Author, " & "),
+		Comment: joinDistinct(ia.Comment, ib.Comment, "; "),
+		AltText: joinDistinct(ia.AltText, ib.AltText, "; "),
+	}, offsets)
+	return writePuzzle(dst, gzip.DefaultCompression, getOptions(opts),
+		func() ([]memberSummary, error) { return summarizeExisting(dst) },
+		func(out io.Writer, level int, o *options) error {
+			return mergeTo(out, dst, srcs[:], jpg.Bytes(), desk, level, o)
+		})
+}
+
+// A mergeSource is one of the puzzles MergePuzzles merges, or one of the
+// parts SplitPuzzle splits a puzzle into.
+type mergeSource struct {
+	path  string
+	info  *PuzzleInfo
+	img   image.Image
+	nums  []int       // Its pieces' numbers, in order (only these are kept)
+	first int         // The new number of its first piece
+	shift image.Point // How far its picture is moved
+}
+
+// openMergeSource reads what MergePuzzles needs from the puzzle at path
+// before it starts writing.
+func openMergeSource(path string) (*mergeSource, error) {
+	p, err := OpenPuzzle(path)
+	if err != nil {
+		return nil, err
+	}
+	defer p.Close()
+	pi, err := p.Info()
+	if err != nil {
+		return nil, err
+	}
+	if pi.desktop == nil {
+		return nil, &Error{"find member pala.desktop in", path, nil}
+	}
+	img, err := p.Image()
+	if err != nil {
+		return nil, err
+	}
+	s := &mergeSource{path: path, info: pi, img: img}
+	for n := range pi.PieceSizes {
+		s.nums = append(s.nums, n)
+	}
+	sort.Ints(s.nums)
+	return s, nil
+}
+
+// joinDistinct returns x and y joined by sep, or just one of them if they
+// are the same or the other is empty (or, as authors often are, "?").
+func joinDistinct(x, y, sep string) string {
+	switch {
+	case x == y || y == "" || y == "?":
+		return x
+	case x == "" || x == "?":
+		return y
+	}
+	return x + sep + y
+}
+
+// mergeTo does the work of MergePuzzles, writing the merged image jpg, the
+// pieces and other members of srcs, and desk, the new pala.desktop, to out.
+func mergeTo(out io.Writer, dst string, srcs []*mergeSource, jpg, desk []byte, level int, o *options) error {
+	zw, err := newGzipWriter(out, level, o)
+	if err != nil {
+		return &Error{"create", dst, err}
+	}
+	tw := tar.NewWriter(zw)
+	tmpl := &tar.Header{Typeflag: tar.TypeReg, Mode: 0644, ModTime: time.Now()}
+	err = writeMember(tw, "image.jpg", jpg, tmpl)
+	if err != nil {
+		err = &Error{"write member image.jpg of", dst, err}
+	}
+	seen := map[string]bool{
+		"pala.desktop": true, "image.jpg": true, checksumsMember: true, signatureMember: true,
+	}
+	for _, s := range srcs {
+		if err != nil {
+			break
+		}
+		renumber := make(map[int]int, len(s.nums))
+		for i, n := range s.nums {
+			renumber[n] = s.first + i
+		}
+		err = walkPuzzle(s.path, func(hdr *tar.Header, r io.Reader) error {
+			h := hdr
+			if m := rePieceName.FindStringSubmatch(hdr.Name); m != nil {
+				if n, err := strconv.Atoi(m[1]); err == nil {
+					to, ok := renumber[n]
+					if !ok {
+						return nil // A second N.png, or one left out
+					}
+					delete(renumber, n)
+					h = resizedHeader(hdr, hdr.Size)
+					h.Name = strconv.Itoa(to) + ".png"
+				}
+			}
+			if h == hdr {
+				if seen[hdr.Name] {
+					return nil
+				}
+				seen[hdr.Name] = true
+			}
+			if err := copyMember(h, r, tw); err != nil {
+				return &Error{"copy member " + hdr.Name + " of", s.path, err}
+			}
+			return nil
+		})
+	}
+	if err == nil {
+		if err = writeMember(tw, "pala.desktop", desk, tmpl); err != nil {
+			err = &Error{"write member pala.desktop of", dst, err}
+		}
+	}
+	if err != nil {
+		zw.Close() // Stop any goroutines; output is discarded anyway
+		return err
+	}
+	if err := tw.Close(); err != nil {
+		zw.Close()
+		return &Error{"write", dst, err}
+	}
+	if err := zw.Close(); err != nil {
+		return &Error{"write", dst, err}
+	}
+	return nil
+}
@@ -0,0 +1,85 @@
+package palapuzzle
+
+import (
+	"image"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"testing"
+
+	"github.com/c12h/palapuzzle/palapuzzletest"
+)
+
+func TestMergePuzzles(t *testing.T) {
+	// A is 2×2 pieces, 64×64 pixels; b is 3×1, 96×32. Both have a
+	// notes.txt, but only a's is kept.
+	specA := palapuzzletest.Spec{Title: "A"}
+	specB := palapuzzletest.Spec{Title: "B", Cols: 3, Rows: 1}
+	ma := readMembers(t, palapuzzletest.File(t, specA))
+	mb := readMembers(t, palapuzzletest.File(t, specB))
+	a := writeTestPuzzle(t, append(ma, testMember{Name: "notes.txt", Body: "from a"}))
+	b := writeTestPuzzle(t, append(mb,
+		testMember{Name: "notes.txt", Body: "from b"},
+		testMember{Name: "only-b.txt", Body: "b"}))
+	pieces := make(map[string]string) // Each new piece's content
+	for i, m := range ma[1:5] {
+		pieces[strconv.Itoa(i)+".png"] = m.Body
+	}
+	for i, m := range mb[1:4] {
+		pieces[strconv.Itoa(4+i)+".png"] = m.Body
+	}
+
+	for _, tc := range []struct {
+		name   string
+		layout MergeLayout
+		size   image.Point
+		shift  image.Point // Where b's picture goes
+	}{
+		{"SideBySide", SideBySide, image.Pt(160, 64), image.Pt(64, 0)},
+		{"Stacked", Stacked, image.Pt(96, 96), image.Pt(0, 64)},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			dst := filepath.Join(t.TempDir(), "merged.puzzle")
+			if err := MergePuzzles(dst, a, b, tc.layout); err != nil {
+				t.Fatal(err)
+			}
+			var names []string
+			for _, m := range readMembers(t, dst) {
+				names = append(names, m.Name)
+				if want, ok := pieces[m.Name]; ok && m.Body != want {
+					t.Errorf("%s is not the piece it was", m.Name)
+				}
+				if m.Name == "notes.txt" && m.Body != "from a" {
+					t.Errorf("notes.txt is %q, want a's", m.Body)
+				}
+			}
+			want := []string{"image.jpg", "0.png", "1.png", "2.png", "3.png", "notes.txt",
+				"4.png", "5.png", "6.png", "only-b.txt", "pala.desktop"}
+			if !reflect.DeepEqual(names, want) {
+				t.Errorf("members %q, want %q", names, want)
+			}
+
+			pi, err := ScanPuzzle(dst)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(pi.Warnings) != 0 {
+				t.Errorf("merged puzzle has warnings %v", pi.Warnings)
+			}
+			if pi.Title != "A & B" || pi.NPiecesDecl != 7 {
+				t.Errorf("merged puzzle has Title %q, PieceCount %d", pi.Title, pi.NPiecesDecl)
+			}
+			if got := image.Pt(pi.ImageWidth, pi.ImageHeight); got != tc.size {
+				t.Errorf("image is %v, want %v", got, tc.size)
+			}
+			offsets := pi.desktop.pieceOffsets()
+			wantOffsets := map[int]image.Point{
+				0: {0, 0}, 1: {32, 0}, 2: {0, 32}, 3: {32, 32},
+				4: tc.shift, 5: tc.shift.Add(image.Pt(32, 0)), 6: tc.shift.Add(image.Pt(64, 0)),
+			}
+			if !reflect.DeepEqual(offsets, wantOffsets) {
+				t.Errorf("offsets %v, want %v", offsets, wantOffsets)
+			}
+		})
+	}
+}
@@ -0,0 +1,50 @@
+package palapuzzle
+
+import "sort"
+
+// A Mismatch is how the pieces a puzzle has differ from the PieceCount its
+// pala.desktop declares, which should number them 0 to PieceCount-1.
+type Mismatch struct {
+	Declared int // PieceCount
+	Found    int // How many different N.png files there are
+	// The numbers below Declared with no N.png, in order; only the first
+	// maxMismatchList are listed, as PieceCount can be absurdly large
+	Missing []int
+	// The numbers of the N.png files at or above Declared, in order
+	Extra []int
+}
+
+// maxMismatchList is the most missing pieces a Mismatch lists.
+const maxMismatchList = 1000
+
+// PieceCountMismatch compares the puzzle's PieceCount with its pieces, and
+// returns how they differ, or nil if they match or there is no PieceCount
+// (or, under the MetadataOnly option, no count of the pieces). The counts
+// can agree and the pieces still not match, as when 0.png, 1.png and 3.png
+// go with a PieceCount of 3.
+func (pi *PuzzleInfo) PieceCountMismatch() *Mismatch {
+	if pi.NPiecesDecl <= 0 || pi.NPieceFiles < 0 {
+		return nil
+	}
+	m := &Mismatch{Declared: pi.NPiecesDecl, Found: len(pi.PieceSizes)}
+	below := 0
+	for n := range pi.PieceSizes {
+		if n >= m.Declared {
+			m.Extra = append(m.Extra, n)
+		} else {
+			below++
+		}
+	}
+	sort.Ints(m.Extra)
+	if below < m.Declared {
+		for n := 0; n < m.Declared && len(m.Missing) < maxMismatchList; n++ {
+			if _, ok := pi.PieceSizes[n]; !ok {
+				m.Missing = append(m.Missing, n)
+			}
+		}
+	}
+	if m.Missing == nil && m.Extra == nil {
+		return nil
+	}
+	return m
+}
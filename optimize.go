@@ -0,0 +1,101 @@
+package palapuzzle
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"image"
+	"image/color"
+	"image/png"
+	"io"
+)
+
+// OptimizePieces re-encodes every N.png member of the puzzle at path with
+// the best PNG compression available, replacing the puzzle in place, and
+// returns how many bytes the pieces shrank by. The pieces look exactly the
+// same afterwards, and a piece is only replaced if re-encoding makes it
+// smaller. Pieces which cannot be decoded are left alone.
+//
+// With the ReducePalettes option, pieces with few enough distinct colours
+// are also converted to paletted PNGs, which often helps with the output of
+// simple slicers. OptimizePieces also heeds the writing options; under DryRun
+// it still returns how much it would save.
+func OptimizePieces(path string, opts ...Option) (int64, error) {
+	o := getOptions(opts)
+	var saved int64
+	err := rewritePuzzle(path, path, gzip.DefaultCompression, o,
+		func(hdr *tar.Header, r io.Reader, tw *tar.Writer) error {
+			if hdr.Typeflag != tar.TypeReg || !rePieceName.MatchString(hdr.Name) {
+				return copyMember(hdr, r, tw)
+			}
+			data, err := io.ReadAll(r)
+			if err != nil {
+				return err
+			}
+			if better := optimizePNG(data, o.reducePalettes); better != nil {
+				saved += int64(len(data) - len(better))
+				data = better
+			}
+			return writeMember(tw, hdr.Name, data, hdr)
+		})
+	if err != nil {
+		return 0, err
+	}
+	return saved, nil
+}
+
+// optimizePNG returns a smaller encoding of the PNG image in data, or nil if
+// it cannot find one.
+func optimizePNG(data []byte, reducePalette bool) []byte {
+	img, err := png.Decode(bytes.NewReader(data))
+	if err != nil {
+		return nil
+	}
+	if reducePalette {
+		if p := toPaletted(img); p != nil {
+			img = p
+		}
+	}
+	var buf bytes.Buffer
+	enc := png.Encoder{CompressionLevel: png.BestCompression}
+	if err := enc.Encode(&buf, img); err != nil || buf.Len() >= len(data) {
+		return nil
+	}
+	return buf.Bytes()
+}
+
+// toPaletted returns img as an image.Paletted with exactly the same pixels,
+// or nil if that is not possible (too many colours, or colours which need
+// more than 8 bits per channel).
+func toPaletted(img image.Image) *image.Paletted {
+	if _, ok := img.(*image.Paletted); ok {
+		return nil
+	}
+	b := img.Bounds()
+	var palette color.Palette
+	index := make(map[color.NRGBA]uint8)
+	pix := make([]uint8, 0, b.Dx()*b.Dy())
+	for y := b.Min.Y; y < b.Max.Y; y++ {
+		for x := b.Min.X; x < b.Max.X; x++ {
+			c := color.NRGBA64Model.Convert(img.At(x, y)).(color.NRGBA64)
+			if c.R%0x101 != 0 || c.G%0x101 != 0 || c.B%0x101 != 0 || c.A%0x101 != 0 {
+				return nil
+			}
+			c8 := color.NRGBA{uint8(c.R >> 8), uint8(c.G >> 8), uint8(c.B >> 8), uint8(c.A >> 8)}
+			if c8.A == 0 {
+				c8 = color.NRGBA{} // All transparent pixels look alike
+			}
+			i, ok := index[c8]
+			if !ok {
+				if len(palette) == 256 {
+					return nil
+				}
+				i = uint8(len(palette))
+				index[c8] = i
+				palette = append(palette, c8)
+			}
+			pix = append(pix, i)
+		}
+	}
+	return &image.Paletted{Pix: pix, Stride: b.Dx(), Rect: b, Palette: palette}
+}
@@ -0,0 +1,289 @@
+package palapuzzle
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"runtime"
+)
+
+// An Option changes how a function in this package goes about its work.
+// Each function documents which options it heeds; others are ignored.
+//
+// Functions which write puzzles all heed the same writing options: Parallel,
+// CompressionLevel, Compression, Reproducible, DryRun, Backup and
+// InTransaction. Some heed options of their own too, like ShrinkImage and
+// StripEXIF (Repack) and ReducePalettes (OptimizePieces). Functions which
+// scan puzzles, like ScanPuzzle, heed the scanning options: MaxWarnings,
+// MetadataOnly, ScanLimits, BestEffort, Strict, Lenient, RequireDesktop and
+// RejectTrailingData, which change what is read and what is an error, and
+// ReportUnknownMembers, PieceDimensions, ReadEXIF, HashMembers,
+// PerceptualHash, KeepDesktopText and DeepCheck, which find out more.
+type Option func(*options)
+
+// options holds the settings made by Options.
+type options struct {
+	parallel       int          // Number of goroutines compressing output; 0 means one
+	reducePalettes bool         // Convert pieces with few colours to paletted PNGs
+	dryRun         *Plan        // If not nil, change nothing; describe it here
+	backup         bool         // Back up puzzles before replacing them
+	backupDir      string       // Where to, if not beside them
+	backupKeep     int          // How many backups of each to keep; 0 means all
+	tx             *Transaction // If not nil, stage new puzzles in it
+	level          int          // Compression level instead of the default; 0 means none set
+	reproducible   bool         // Write members in canonical order, with canonical headers
+	compression    string       // The format to write, if not gzip
+	shrinkImage    bool         // Have Repack re-encode image.jpg
+	imageSize      int          // How far across it may be; 0 means keep its size
+	imageQuality   int          // The JPEG quality to encode it at; 0 means imageQuality
+	stripEXIF      bool         // Remove image.jpg's EXIF, XMP and IPTC metadata
+	maxWarnings    int          // How many warnings scanning keeps; 0 means all
+	metadataOnly   bool         // Stop scanning once pala.desktop is read
+	limits         *Limits      // If not nil, scan within these, not DefaultLimits
+	bestEffort     bool         // Scan damaged archives as far as they go
+	mode           scanMode     // How fussy scanning is
+	reportUnknown  bool         // Warn of members scanning does not understand
+	pieceDims      bool         // Decode the pieces' headers for their sizes
+	exif           bool         // Read image.jpg's EXIF details
+	hashes         bool         // Hash the file, image.jpg and the pieces
+	pictureHash    bool         // Decode image.jpg for its perceptual hashes
+	keepDesktop    bool         // Keep the text of pala.desktop
+	deepCheck      bool         // Decode every piece, to find corrupt ones
+	rejectTrailing bool         // Fail on data after the end of the archive
+	requireDesktop bool         // Fail on puzzles without pala.desktop
+
+	// If not nil, scanning calls this for each member (see WalkPuzzle)
+	visit func(hdr *tar.Header, r io.Reader) error
+	// If not nil, scanning calls this with where each member's content
+	// starts in the tar stream, for formats whose tar stream it can see
+	index func(name string, offset int64)
+}
+
+func getOptions(opts []Option) *options {
+	o := &options{}
+	for _, opt := range opts {
+		opt(o)
+	}
+	return o
+}
+
+// Parallel makes functions which write puzzles compress their output using
+// n goroutines, or runtime.GOMAXPROCS(0) of them if n <= 0. The output is
+// still an ordinary gzip stream, readable by Palapeli and by other tools,
+// though it may be very slightly larger.
+func Parallel(n int) Option {
+	if n <= 0 {
+		n = runtime.GOMAXPROCS(0)
+	}
+	return func(o *options) { o.parallel = n }
+}
+
+// CompressionLevel makes functions which write puzzles at gzip's default
+// compression level use level instead, from 1 (fastest) to 9 (smallest).
+// Functions which choose some other level, like Recompress, are unaffected,
+// but for Repack, which uses level in place of its own.
+func CompressionLevel(level int) Option {
+	return func(o *options) { o.level = level }
+}
+
+// Reproducible makes functions which write puzzles write the same bytes
+// whenever the members are the same, for content-addressed storage and
+// finding duplicates: the members are sorted (pala.desktop, image.jpg, the
+// pieces by number, and then the rest by name, with any CHECKSUMS and
+// SIGNATURE first), and their headers keep only their names, types and
+// permissions, with no owners and a modification time of 1970-01-01. The
+// gzip header records no time or name either. The same compression level
+// must be used each time, and Parallel either used each time or never (how
+// many goroutines it uses makes no difference). The whole puzzle is held in
+// memory, uncompressed, to sort it.
+func Reproducible() Option {
+	return func(o *options) { o.reproducible = true }
+}
+
+// ShrinkImage makes Repack re-encode image.jpg, which is often a photo at
+// full resolution that takes up most of the puzzle, to be no more than
+// maxSize pixels across either way (or at its own size, if maxSize is 0), at
+// the given JPEG quality, from 1 to 100 (or 90, if quality is 0). The image
+// is only Palapeli's preview of the puzzle, so the pieces are unaffected. It
+// is kept as it is if shrinking it would make it no smaller, or it cannot be
+// decoded.
+func ShrinkImage(maxSize, quality int) Option {
+	return func(o *options) { o.shrinkImage, o.imageSize, o.imageQuality = true, maxSize, quality }
+}
+
+// StripEXIF makes Repack, and PuzzleWriters, remove the metadata from
+// image.jpg which cameras and photo editors write: EXIF, which can give
+// where a photo was taken and the camera's serial number, and XMP and IPTC,
+// which can name the people in it. People share their own photos as
+// puzzles without knowing that these go with them. The picture itself is
+// not re-encoded. EXIF also says which way up a photo goes, so one taken
+// sideways may be shown so.
+func StripEXIF() Option {
+	return func(o *options) { o.stripEXIF = true }
+}
+
+// ReducePalettes makes OptimizePieces convert pieces which use no more than
+// 256 distinct colours to paletted PNGs.
+func ReducePalettes() Option {
+	return func(o *options) { o.reducePalettes = true }
+}
+
+// MaxWarnings makes functions which scan puzzles keep only the first n
+// warnings about each, for puzzles so broken that they have thousands.
+func MaxWarnings(n int) Option {
+	return func(o *options) { o.maxWarnings = n }
+}
+
+// MetadataOnly makes functions which scan puzzles stop reading as soon as
+// they have read pala.desktop, which for big puzzles is much faster, when
+// only the details it gives (Title, Author, NPiecesDecl and so on) are
+// needed. The pieces are not counted, so NPieceFiles is -1 and there are no
+// warnings about them, and ImageFileSize is only set if image.jpg comes
+// before pala.desktop. Neither is PuzzleFileSize known when the file's size
+// is not given in advance (as by some web servers); it is -1 then.
+func MetadataOnly() Option {
+	return func(o *options) { o.metadataOnly = true }
+}
+
+// BestEffort makes functions which scan puzzles return what they can from
+// archives which are cut short (as by an interrupted download) or corrupt,
+// instead of an error: the PuzzleInfo has Truncated set and a WarnTruncated
+// warning saying where reading stopped. Fields from later members are left
+// unset, and pieces after that point are not counted. Archives which cannot
+// be opened at all are still errors.
+func BestEffort() Option {
+	return func(o *options) { o.bestEffort = true }
+}
+
+// A scanMode says how fussy scanning is.
+type scanMode int
+
+const (
+	normalMode scanMode = iota
+	strictMode
+	lenientMode
+)
+
+// salvage reports whether scanning should make the best of damaged
+// archives, as BestEffort and Lenient say.
+func (o *options) salvage() bool {
+	return o.bestEffort || o.mode == lenientMode
+}
+
+// Strict makes functions which scan puzzles fail on anything this package
+// would otherwise only warn about, or pass over in silence: a warning (the
+// error is the first Warning, so errors.Is(err, WarnMissingPiece) and so on
+// work), a missing pala.desktop, or a member other than pala.desktop,
+// image.jpg and the pieces. It is for validators, which should reject what
+// Palapeli might not cope with. Strict and Lenient undo each other.
+func Strict() Option {
+	return func(o *options) { o.mode = strictMode }
+}
+
+// Lenient makes functions which scan puzzles put up with as much as they
+// can, for viewers which would rather show something than nothing. As well
+// as doing what BestEffort does, members named like pieces whose numbers
+// cannot be used (being too large for an int, or beyond
+// Limits.MaxPieceIndex) are ignored with a WarnBadPieceName warning. Strict
+// and Lenient undo each other.
+func Lenient() Option {
+	return func(o *options) { o.mode = lenientMode }
+}
+
+// ReportUnknownMembers makes functions which scan puzzles warn of each
+// member other than N.png, image.jpg and pala.desktop, with a
+// WarnUnknownMember warning, as well as listing it in
+// PuzzleInfo.OtherMembers.
+func ReportUnknownMembers() Option {
+	return func(o *options) { o.reportUnknown = true }
+}
+
+// PieceDimensions makes functions which scan puzzles read the header of
+// each N.png for the piece's size in pixels, summarized in
+// PuzzleInfo.PieceWidths and PieceHeights. That gives an idea of how hard
+// the puzzle is, and shows up pieces cut at inconsistent scales, but takes
+// a little longer.
+func PieceDimensions() Option {
+	return func(o *options) { o.pieceDims = true }
+}
+
+// ReadEXIF makes functions which scan puzzles read the photographer,
+// copyright, camera and date recorded in image.jpg into PuzzleInfo.EXIF.
+func ReadEXIF() Option {
+	return func(o *options) { o.exif = true }
+}
+
+// HashMembers makes functions which scan puzzles work out the SHA-256 hashes
+// of the whole file, image.jpg and each piece, into PuzzleInfo.Hashes, for
+// finding exact duplicates and checking copies; pieces with the same hash get
+// a WarnIdenticalPieces warning. Under MetadataOnly, the file's hash is left
+// out, and so are any members after pala.desktop.
+func HashMembers() Option {
+	return func(o *options) { o.hashes = true }
+}
+
+// PerceptualHash makes functions which scan puzzles decode image.jpg for its
+// perceptual hashes, into PuzzleInfo.PictureHash, so that puzzles of the
+// same picture can be found with PictureHash.Distance. Decoding the picture
+// takes much longer than the rest of the scan.
+func PerceptualHash() Option {
+	return func(o *options) { o.pictureHash = true }
+}
+
+// KeepDesktopText makes functions which scan puzzles keep the text of
+// pala.desktop, unparsed, in PuzzleInfo.DesktopText, for tracking down
+// parsing problems and for tools which write it back.
+func KeepDesktopText() Option {
+	return func(o *options) { o.keepDesktop = true }
+}
+
+// DeepCheck makes functions which scan puzzles decode every N.png, with a
+// WarnBadPiece warning for each that is corrupt or cut short, as Palapeli
+// would fail on it when loading the puzzle. A JPEG image.jpg is decoded
+// too, and checked for its start and end markers, with a WarnBadImage
+// warning if it is damaged. It takes much longer.
+func DeepCheck() Option {
+	return func(o *options) { o.deepCheck = true }
+}
+
+// RejectTrailingData makes functions which scan puzzles fail, with an error
+// satisfying errors.Is(err, ErrTrailingData), on puzzles with data after the
+// end of their archive, instead of warning of it with WarnTrailingData.
+func RejectTrailingData() Option {
+	return func(o *options) { o.rejectTrailing = true }
+}
+
+// RequireDesktop makes functions which scan puzzles fail on puzzles with no
+// pala.desktop, as Strict does, instead of warning of it with WarnNoDesktop;
+// unlike Strict, it lets everything else pass.
+func RequireDesktop() Option {
+	return func(o *options) { o.requireDesktop = true }
+}
+
+// Compression makes functions which write puzzles compress them in the
+// named format instead of gzip: "tar", for none, or one registered with
+// RegisterCompression, such as zstd, which decompresses much faster. Only
+// gzip is the real thing; Palapeli cannot load puzzles in any other format,
+// so this is for puzzles kept for other programs. Writing fails with an
+// error wrapping ErrFormat if the format cannot be written.
+func Compression(name string) Option {
+	return func(o *options) { o.compression = name }
+}
+
+// newGzipWriter returns a writer that gzips its input at the given level,
+// in parallel if o says so; or that compresses it as the Compression option
+// says, if it is given.
+func newGzipWriter(w io.Writer, level int, o *options) (io.WriteCloser, error) {
+	if o.compression != "" && o.compression != "gzip" {
+		compress := compressor(o.compression)
+		if compress == nil {
+			return nil, fmt.Errorf("%w: cannot write %s", ErrFormat, o.compression)
+		}
+		return compress(w)
+	}
+	if o.parallel > 1 {
+		return newParallelGzipWriter(w, level, o.parallel)
+	}
+	return gzip.NewWriterLevel(w, level)
+}
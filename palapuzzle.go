@@ -4,150 +4,801 @@ package palapuzzle
 
 import (
 	"archive/tar"
-	"bufio"
-	"compress/gzip"
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
 	"fmt"
+	"image"
+	"image/png"
 	"io"
 	"os"
-	"path/filepath"
 	"regexp"
+	"sort"
 	"strconv"
 	"strings"
+	"time"
 )
 
 // A PuzzleInfo holds the interesting details from a .puzzle file
 type PuzzleInfo struct {
 	// Which directory the file was found in (from filepath.Split)
-	Dir            string
+	Dir              string
 	// The name of the file itself
-	Filename       string
+	Filename         string
 	// The title specified when the puzzle was created
-	Title          string
+	Title            string
 	// The "author" specified when the puzzle was created (name of painter
 	// or photographer etc; "?" if unknown)
-	Author         string
+	Author           string
 	// The comment field from puzzle creation; usually empty
-	Comment        string
-	// Any warnings about missing N.png files
-	Warnings       []string
+	Comment          string
+	// A description of the picture for people who cannot see it, from
+	// an X-Palapuzzle-AltText key (see SetAltText); usually empty
+	AltText          string
+	// Translations of the title and comment (from keys like "Name[de]"),
+	// by locale; nil if there are none. See TitleFor and CommentFor.
+	Titles           map[string]string
+	Comments         map[string]string
+	// The members of the archive other than N.png, image.jpg,
+	// pala.desktop, CHECKSUMS and SIGNATURE, in order; nil if there are
+	// none
+	OtherMembers     []MemberInfo
+	// Any warnings about missing N.png files and so on
+	Warnings         []Warning
+	// Which slicer plugin cut the puzzle, like "palapeli_jigsawslicer" or
+	// "palapeli_rectslicer", and in which of its modes (often none)
+	Slicer           string
+	SlicerMode       string
 	// The number of N.png files in the tarball
-	NPieceFiles    int
+	NPieceFiles      int
 	// The number of pieces specified in the tarball's pala.desktop file
-	NPiecesDecl    int
+	NPiecesDecl      int
+	// The size in bytes of each N.png file, by N (the first, if there
+	// are several); see PieceSizeStats
+	PieceSizes       map[int]int64
+	// The pieces' sizes in pixels, from their headers (the first N.png,
+	// if there are several), under the PieceDimensions option
+	PieceWidths      Stats
+	PieceHeights     Stats
 	// The size of the tarball's image.jpg in bytes
-	ImageFileSize  int64
+	ImageFileSize    int64
+	// The size of the image in pixels, from the header of image.jpg;
+	// zero if it has none, or it cannot be decoded
+	ImageWidth       int
+	ImageHeight      int
+	// What image.jpg really holds, as named by the image package: "jpeg",
+	// "png" and so on, or "other" if it is none that can be decoded
+	// (a damaged JPEG is still "jpeg"); "" if there is no image.jpg.
+	// Anything but "jpeg" gets a WarnImageFormat warning.
+	ImageFormat      string
+	// What the camera recorded in image.jpg, under the ReadEXIF option;
+	// nil if the option is not given or the image records nothing
+	EXIF             *EXIF
+	// SHA-256 hashes of the file and its members, under the HashMembers
+	// option; nil otherwise
+	Hashes           *Hashes
+	// Perceptual hashes of image.jpg, under the PerceptualHash option; nil
+	// otherwise, or if it cannot be decoded
+	PictureHash      *PictureHash
 	// The size of the .puzzle file in bytes
-	PuzzleFileSize int64
+	PuzzleFileSize   int64
+	// The total size of the archive's members in bytes, which is how much
+	// unpacking it takes; with PuzzleFileSize, this gives the compression
+	// ratio. Under MetadataOnly or BestEffort, only the members read count.
+	UncompressedSize int64
+	// When the puzzle was probably made, for sorting puzzles whose files
+	// have lost their own times: the earliest modification time of any
+	// member, as the archive records them. LastModTime is the latest, and
+	// DesktopModTime pala.desktop's, which is often the last to change.
+	// Each is zero if the archive does not say.
+	CreatedAt        time.Time
+	LastModTime      time.Time
+	DesktopModTime   time.Time
+	// The container format found, as named by RegisterFormat: "gzip",
+	// "bzip2", "tar" (uncompressed) and so on
+	Compression      string
+	// Whether reading stopped early because the archive is damaged, as
+	// a WarnTruncated warning says; only under the BestEffort option
+	Truncated        bool
+	// Whether the puzzle has a CHECKSUMS member, which its other members
+	// were checked against (see WriteChecksums)
+	Checksummed      bool
+	// Whether the puzzle has a SIGNATURE member; scanning cannot tell
+	// whether it is valid, which needs Verify and the signer's key
+	Signed           bool
+	// Whether Palapeli is to keep the puzzle from being changed, as it
+	// does with the puzzles it comes with: not deleted, nor re-sliced
+	ModifyProtection bool
+	// Every flag of the puzzle, by key: the keys of [Desktop Entry] and
+	// [Job] which are set to true or false (or yes, no, on or off, as
+	// KConfig also allows), like ModifyProtection or Hidden
+	Flags            map[string]bool
+	// Which generation of Palapeli the puzzle's layout comes from
+	FormatVersion    FormatVersion
+	// Which key of pala.desktop supplied each of the fields above that
+	// comes from there, by field name ("Title", "NPiecesDecl" ...)
+	Sources          map[string]KeySource
+	// Every key of pala.desktop, by group and then by key as named in the
+	// file (like "Name[de]"); the first, if a key is repeated in a group.
+	// Keys before the first group header are in group "". Values are as
+	// in the file, escapes and all. See also DesktopValue.
+	Desktop          map[string]map[string]string
+	// The keys of Desktop which no other field comes from, nor
+	// SlicerProperties, and which are not piece offsets: those of other
+	// programs, say. Nil if there are none.
+	Extras           map[string]map[string]string
+	// The text of pala.desktop, exactly as it is in the archive, under
+	// the KeepDesktopText option; nil otherwise
+	DesktopText      []byte
+
+	desktop *desktopFile // The parsed pala.desktop, if there was one
 }
 
 var rePieceName = regexp.MustCompile(`^(\d+)\.png$`)
-var reKeyValue = regexp.MustCompile(`^([^[=]+)=(.*)$`)
+var reKeyValue = regexp.MustCompile(`^([^=]+)=(.*)$`)
+var reLocalizedKey = regexp.MustCompile(`^([^[]+)\[([^]]+)\]$`)
 
 // ScanPuzzle() reads a .puzzle file, does some checking and returns a
-// PuzzleInfo or an error (but not both).
-func ScanPuzzle(fs string) (*PuzzleInfo, error) {
-	var ret = &PuzzleInfo{}
+// PuzzleInfo or an error (but not both). It heeds the scanning options (see
+// Option).
+//
+// As well as local paths, ScanPuzzle accepts file:// URLs and http:// or
+// https:// URLs; the latter are fetched using DefaultHTTPBackend.
+func ScanPuzzle(fs string, opts ...Option) (*PuzzleInfo, error) {
+	b, name, err := backendFor(fs)
+	if err != nil {
+		return nil, &Error{"open", fs, err}
+	}
+	return ScanBackend(b, name, opts...)
+}
 
-	f, err := os.Open(fs)
+// ScanPuzzleContext is like ScanPuzzle, but gives up as soon as ctx is
+// done, returning ctx.Err(), so that long scans can be cancelled or given a
+// deadline. Requests for http:// and https:// URLs are made with ctx.
+func ScanPuzzleContext(ctx context.Context, fs string, opts ...Option) (*PuzzleInfo, error) {
+	b, name, err := backendFor(fs)
 	if err != nil {
-		return nil, &Error{"cannot open", fs, err}
+		return nil, &Error{"open", fs, err}
 	}
-	defer f.Close()
-	ret.Dir, ret.Filename = filepath.Split(fs)
-	fi, err := f.Stat()
+	if hb, ok := b.(*HTTPBackend); ok {
+		b = contextHTTPBackend{hb, ctx}
+	}
+	return scanBackend(ctx, b, name, getOptions(opts))
+}
+
+// WalkPuzzle is like ScanPuzzle, but also calls fn for each member of the
+// puzzle's archive, in order, with its header and content, so that callers
+// can make their own analyses as the puzzle is scanned. Errors from fn stop
+// the walk and are returned unchanged. WalkPuzzle heeds the scanning options
+// (see Option).
+func WalkPuzzle(fs string, fn func(hdr *tar.Header, r io.Reader) error, opts ...Option) (*PuzzleInfo, error) {
+	b, name, err := backendFor(fs)
 	if err != nil {
-		return nil, &Error{"cannot examine", fs, err}	// Should never happen
+		return nil, &Error{"open", fs, err}
+	}
+	o := getOptions(opts)
+	o.visit = fn
+	return scanBackend(context.Background(), b, name, o)
+}
+
+// ScanReader is like ScanPuzzle, but reads the puzzle from r, such as a
+// network connection or an embedded fixture; name is used for the Dir and
+// Filename fields and in errors. All of r is read, so that PuzzleFileSize
+// can be counted, except under the MetadataOnly option.
+func ScanReader(r io.Reader, name string, opts ...Option) (*PuzzleInfo, error) {
+	ret := &PuzzleInfo{}
+	ret.Dir, ret.Filename = splitName(name)
+	cr := &countingReader{r: r}
+	o := getOptions(opts)
+	if err := scanArchive(context.Background(), cr, name, ret, o); err != nil {
+		return nil, err
+	}
+	if o.metadataOnly {
+		ret.PuzzleFileSize = -1
+		return ret, nil
 	}
-	ret.PuzzleFileSize = fi.Size()
+	if _, err := io.Copy(io.Discard, cr); err != nil && !o.salvage() {
+		return nil, &Error{"read", name, err}
+	}
+	ret.PuzzleFileSize = cr.n
+	return ret, nil
+}
+
+// ScanBytes is like ScanPuzzle, but reads a puzzle already in memory, such
+// as a file picked by the user of a web page; name is used for the Dir and
+// Filename fields and in errors. It needs no filesystem, so it works under
+// js/wasm.
+func ScanBytes(name string, data []byte, opts ...Option) (*PuzzleInfo, error) {
+	ret := &PuzzleInfo{PuzzleFileSize: int64(len(data))}
+	ret.Dir, ret.Filename = splitName(name)
+	if err := scanArchive(context.Background(), bytes.NewReader(data), name, ret, getOptions(opts)); err != nil {
+		return nil, err
+	}
+	return ret, nil
+}
 
-	zr, err := gzip.NewReader(f)
+// scanArchive reads the container in r, whose name is fs, into ret. If ctx
+// is done first, it returns ctx.Err(); it is checked between members, and
+// after errors in case r gave up because of it (as a ctxReader does).
+func scanArchive(ctx context.Context, r io.Reader, fs string, ret *PuzzleInfo, o *options) error {
+	tr, compression, cr, err := openCounted(r)
 	if err != nil {
-		return nil, &Error{"cannot decompress", fs, err}
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		return &Error{"open archive", fs, err}
+	}
+	ret.Compression = compression
+	if o.hashes {
+		ret.Hashes = &Hashes{Pieces: make(map[int]string)}
 	}
-	defer zr.Close()
 
-	tr := tar.NewReader(zr)
 	var maxPieceNum = -1
-	var piecesFound = make([]byte, 512)
+	// How many members there are of each piece number found. A map, so that
+	// its size depends on the members there are, not on their numbers.
+	var piecesFound = make(map[int]int)
+	limits := o.scanLimits()
+	var nMembers int
+	var nBytes int64
+	tooBig := func(limit string, max int64) error {
+		return &Error{"scan", fs, &LimitError{limit, max}}
+	}
+	var last string // The last member read, for BestEffort's warning
+	var sums *checksums // From CHECKSUMS, once it is read
+	var sumsAt int      // Which member it was, counting from 1
+	var sumsFirst bool  // Whether it came before all but SIGNATURE
+	damaged := func(where string, err error) {
+		ret.Truncated = true
+		ret.warn(WarnTruncated, fmt.Sprintf("archive damaged %s: %v", where, err),
+			"member", last, "error", err.Error())
+	}
 	for {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
 		header, err := tr.Next()
 		if err == io.EOF {
+			if cr == nil {
+				break
+			}
+			if where := trailingData(cr, compression, limits.MaxBytes); where != "" {
+				if o.rejectTrailing {
+					return &Error{"scan", fs, fmt.Errorf("%w %s", ErrTrailingData, where)}
+				}
+				ret.warn(WarnTrailingData, "data "+where, "where", where)
+			}
 			break
 		}
 		if err != nil {
-			return nil, &Error{"cannot read decompressed TAR file", fs, err}
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			if o.salvage() {
+				where := "at its start"
+				if last != "" {
+					where = fmt.Sprintf("after member %q", last)
+				}
+				damaged(where, err)
+				break
+			}
+			return &Error{"read archive", fs, err}
 		}
-		if m := rePieceName.FindStringSubmatch(header.Name); m != nil {
-			i, err := strconv.Atoi(m[1])
-			if err != nil {
-				text := fmt.Sprintf("bad member name %q", header.Name)
-				return nil, &Error{text, fs, err}
+		last = header.Name
+		if o.index != nil && cr != nil {
+			o.index(header.Name, cr.n)
+		}
+		if why := unsafeMember(header); why != "" {
+			ret.warn(WarnUnsafeMember, fmt.Sprintf("unsafe member %q: %s", header.Name, why),
+				"member", header.Name, "reason", why)
+		}
+		nMembers++
+		nBytes += header.Size
+		ret.UncompressedSize = nBytes
+		if t := header.ModTime; t.Unix() > 0 { // 0 means none was recorded
+			if ret.CreatedAt.IsZero() || t.Before(ret.CreatedAt) {
+				ret.CreatedAt = t
+			}
+			if t.After(ret.LastModTime) {
+				ret.LastModTime = t
 			}
-			length := len(piecesFound)
-			if i >= length {
-				newSlice := make([]byte, 2*i)
-				copy(newSlice, piecesFound)
-				piecesFound = newSlice
+			if header.Name == "pala.desktop" {
+				ret.DesktopModTime = t
 			}
-			piecesFound[i]++
-			if i > maxPieceNum {
-				maxPieceNum = i
+		}
+		if limits.MaxMembers > 0 && nMembers > limits.MaxMembers {
+			return tooBig("MaxMembers", int64(limits.MaxMembers))
+		}
+		if header.Size < 0 {
+			err := fmt.Errorf("member %q has a negative size, %d", header.Name, header.Size)
+			if o.salvage() {
+				damaged(fmt.Sprintf("in member %q", header.Name), err)
+				break
+			}
+			return &Error{"scan", fs, err}
+		}
+		if limits.MaxMemberSize > 0 && header.Size > limits.MaxMemberSize {
+			return tooBig("MaxMemberSize", limits.MaxMemberSize)
+		}
+		if limits.MaxBytes > 0 && nBytes > limits.MaxBytes {
+			return tooBig("MaxBytes", limits.MaxBytes)
+		}
+		// The member's content, counted to check it against header.Size
+		body := &countingReader{r: tr}
+		var member io.Reader = body // What o.visit reads
+		// What else needs all of the member's content, and what to do once
+		// they have it
+		var sinks []io.Writer
+		var done []func()
+		if m := rePieceName.FindStringSubmatch(header.Name); m != nil {
+			i, err := strconv.Atoi(m[1])
+			tooHigh := err == nil && limits.MaxPieceIndex > 0 && i > limits.MaxPieceIndex
+			switch {
+			case (err != nil || tooHigh) && o.mode == lenientMode:
+				ret.warn(WarnBadPieceName,
+					fmt.Sprintf("%q ignored: its number is too large", header.Name),
+					"member", header.Name)
+			case err != nil:
+				text := fmt.Sprintf("parse member name %q in", header.Name)
+				return &Error{text, fs, err}
+			case tooHigh:
+				return tooBig("MaxPieceIndex", int64(limits.MaxPieceIndex))
+			default:
+				piecesFound[i]++
+				if o.deepCheck {
+					var data bytes.Buffer
+					sinks = append(sinks, &data)
+					done = append(done, func() {
+						if _, err := png.Decode(&data); err != nil {
+							ret.warn(WarnBadPiece,
+								fmt.Sprintf("%q cannot be decoded: %v", header.Name, err),
+								"piece", strconv.Itoa(i), "error", err.Error())
+						}
+					})
+				}
+				if piecesFound[i] == 1 {
+					if ret.PieceSizes == nil {
+						ret.PieceSizes = make(map[int]int64)
+					}
+					ret.PieceSizes[i] = header.Size
+					if ret.Hashes != nil {
+						sum := sha256.New()
+						sinks = append(sinks, sum)
+						done = append(done, func() { ret.Hashes.Pieces[i] = hex.EncodeToString(sum.Sum(nil)) })
+					}
+					if o.pieceDims {
+						var head bytes.Buffer
+						if cfg, _, err := image.DecodeConfig(io.TeeReader(body, &head)); err == nil {
+							ret.PieceWidths.add(int64(cfg.Width))
+							ret.PieceHeights.add(int64(cfg.Height))
+						}
+						member = io.MultiReader(&head, body)
+					}
+				}
+				if i > maxPieceNum {
+					maxPieceNum = i
+				}
 			}
 		} else if header.Name == "image.jpg" {
 			ret.ImageFileSize = header.Size
+			// Only the header is read, and kept for o.visit.
+			var head bytes.Buffer
+			cfg, format, err := image.DecodeConfig(io.TeeReader(body, &head))
+			if err == nil {
+				ret.ImageWidth, ret.ImageHeight = cfg.Width, cfg.Height
+			} else if bytes.HasPrefix(head.Bytes(), []byte("\xff\xd8\xff")) {
+				format = "jpeg" // But a damaged one
+			} else {
+				format = "other"
+			}
+			ret.ImageFormat = format
+			if format != "jpeg" {
+				ret.warn(WarnImageFormat,
+					fmt.Sprintf(`"image.jpg" holds %s data, not JPEG`, format),
+					"format", format)
+			}
+			if o.exif {
+				ret.EXIF = parseEXIF(head.Bytes())
+			}
+			member = io.MultiReader(&head, body)
+			if o.pictureHash {
+				// Decoding reads it all, so keep it all for o.visit.
+				var all bytes.Buffer
+				if img, _, err := image.Decode(io.TeeReader(member, &all)); err == nil {
+					ret.PictureHash = &PictureHash{pHash(img), dHash(img)}
+				}
+				member = io.MultiReader(&all, member)
+			}
+			if o.deepCheck && format == "jpeg" {
+				var data bytes.Buffer
+				sinks = append(sinks, &data)
+				done = append(done, func() {
+					if err := checkJPEG(data.Bytes()); err != nil {
+						ret.warn(WarnBadImage, fmt.Sprintf(`"image.jpg" is damaged: %v`, err),
+							"error", err.Error())
+					}
+				})
+			}
+			if ret.Hashes != nil && ret.Hashes.Image == "" {
+				sum := sha256.New()
+				sinks = append(sinks, sum)
+				done = append(done, func() { ret.Hashes.Image = hex.EncodeToString(sum.Sum(nil)) })
+			}
 		} else if header.Name == "pala.desktop" {
-			e := scanPalaDesktopFile(tr, ret)
-			if e != nil {
+			if limits.MaxDesktopSize > 0 && header.Size > limits.MaxDesktopSize {
+				return tooBig("MaxDesktopSize", limits.MaxDesktopSize)
+			}
+			// More than one may need the content, so keep a copy.
+			data, err := io.ReadAll(body)
+			err = checkSize(header, body.n, err)
+			if err != nil && o.salvage() {
+				damaged(`in member "pala.desktop"`, err)
+				break
+			} else if err != nil {
+				return &Error{`read "pala.desktop" member in`, fs, err}
+			}
+			member = bytes.NewReader(data)
+			if o.keepDesktop {
+				ret.DesktopText = data
+			}
+			e := scanPalaDesktopFile(bytes.NewReader(data), ret)
+			if e != nil && o.salvage() {
+				damaged(`in member "pala.desktop"`, e.BaseError)
+				break
+			} else if e != nil {
 				e.FilePath = fs
-				return nil, e
+				return e
+			}
+		} else if header.Name == checksumsMember && sums == nil {
+			data, err := io.ReadAll(body)
+			err = checkSize(header, body.n, err)
+			if err != nil && o.salvage() {
+				damaged(`in member "`+checksumsMember+`"`, err)
+				break
+			} else if err != nil {
+				return &Error{`read "` + checksumsMember + `" member in`, fs, err}
+			}
+			member = bytes.NewReader(data)
+			var bad int
+			sums, bad = parseChecksums(data)
+			sumsAt = nMembers
+			ret.Checksummed = true
+			if bad > 0 {
+				ret.warn(WarnChecksum,
+					fmt.Sprintf("%d malformed lines in %q", bad, checksumsMember),
+					"member", checksumsMember, "reason", "malformed")
+			}
+			sumsFirst = nMembers == 1 || (nMembers == 2 && ret.Signed)
+			if !sumsFirst {
+				ret.warn(WarnChecksum,
+					fmt.Sprintf("%q is not the first member, so those before it were not checked", checksumsMember),
+					"member", checksumsMember, "reason", "not first")
+			}
+		} else if header.Name == signatureMember {
+			ret.Signed = true
+		} else if o.mode == strictMode {
+			return &Error{"scan", fs, fmt.Errorf("unknown member %q", header.Name)}
+		} else {
+			ret.OtherMembers = append(ret.OtherMembers,
+				MemberInfo{header.Name, header.Size, header.ModTime, header.Typeflag})
+			if o.reportUnknown {
+				ret.warn(WarnUnknownMember,
+					fmt.Sprintf("unknown member %q (%d bytes)", header.Name, header.Size),
+					"member", header.Name, "size", strconv.FormatInt(header.Size, 10))
+			}
+		}
+		if sums != nil && nMembers != sumsAt {
+			name := header.Name
+			if want, ok := sums.want[name]; ok && !sums.checked[name] {
+				sums.checked[name] = true
+				sum := sha256.New()
+				sinks = append(sinks, sum)
+				done = append(done, func() {
+					if hex.EncodeToString(sum.Sum(nil)) != want {
+						ret.warn(WarnChecksum, fmt.Sprintf("%q does not match its checksum", name),
+							"member", name, "reason", "mismatch")
+					}
+				})
+			} else if !ok && header.Typeflag == tar.TypeReg && name != signatureMember {
+				ret.warn(WarnChecksum, fmt.Sprintf("%q is not in %q", name, checksumsMember),
+					"member", name, "reason", "unlisted")
 			}
 		}
+		if len(sinks) > 0 {
+			member = io.TeeReader(member, io.MultiWriter(sinks...))
+		}
+		if o.visit != nil {
+			if err := o.visit(header, member); err != nil {
+				return err
+			}
+		}
+		// Read whatever o.visit left unread, so that sinks get it all and
+		// the member's size can be checked.
+		_, err = io.Copy(io.Discard, member)
+		if err = checkSize(header, body.n, err); err != nil {
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			if o.salvage() {
+				damaged(fmt.Sprintf("in member %q", header.Name), err)
+				break
+			}
+			return &Error{fmt.Sprintf("read %q member in", header.Name), fs, err}
+		}
+		for _, f := range done {
+			f()
+		}
+		if o.metadataOnly && ret.desktop != nil {
+			break // The pieces, and so on, are not read
+		}
+	}
+	// Under MetadataOnly, the pieces are not all read, so they are not
+	// checked, and NPieceFiles is -1.
+	counted := !(o.metadataOnly && ret.desktop != nil)
+	if counted {
+		ret.warnPieces(piecesFound)
 	}
-	for i := 0; i < maxPieceNum; i++ {
-		if piecesFound[i] == 0 {
-			ret.Warnings = append(ret.Warnings,
-				fmt.Sprintf(`missing "%d.png"`, i))
-		} else if piecesFound[i] > 1 {
-			ret.Warnings = append(ret.Warnings,
-				fmt.Sprintf(`%d members named "%d.png"`,
-					piecesFound[i], i))
+	if ret.Hashes != nil && counted {
+		ret.Hashes.IdenticalPieces = ret.Hashes.identicalPieces()
+		for _, ns := range ret.Hashes.IdenticalPieces {
+			names := make([]string, len(ns))
+			nums := make([]string, len(ns))
+			for i, n := range ns {
+				names[i] = fmt.Sprintf("%q", strconv.Itoa(n)+".png")
+				nums[i] = strconv.Itoa(n)
+			}
+			ret.warn(WarnIdenticalPieces,
+				fmt.Sprintf("pieces %s are identical", strings.Join(names, ", ")),
+				"pieces", strings.Join(nums, ","))
+		}
+	}
+	if sums != nil && sumsFirst && !ret.Truncated && counted {
+		for _, name := range sums.names {
+			if !sums.checked[name] {
+				ret.warn(WarnChecksum, fmt.Sprintf("missing %q, listed in %q", name, checksumsMember),
+					"member", name, "reason", "missing")
+			}
 		}
 	}
 	ret.NPieceFiles = maxPieceNum + 1
+	if !counted {
+		ret.NPieceFiles = -1
+	}
+	if ret.desktop == nil {
+		if o.mode == strictMode || o.requireDesktop {
+			return &Error{"find member pala.desktop in", fs, nil}
+		}
+		if !ret.Truncated { // Else it may be past the damage
+			ret.warn(WarnNoDesktop, "no pala.desktop, so no title, author or piece offsets")
+		}
+	}
+	if o.mode == strictMode {
+		if len(ret.Warnings) > 0 {
+			return &Error{"scan", fs, ret.Warnings[0]}
+		}
+	}
+	if o.maxWarnings > 0 && len(ret.Warnings) > o.maxWarnings {
+		ret.Warnings = ret.Warnings[:o.maxWarnings]
+	}
 
-	return ret, nil
+	return nil
+}
+
+// walkPuzzle opens fs (a path or URL, as for ScanPuzzle) and calls fn for each
+// member of its archive. Errors from fn are returned unchanged.
+func walkPuzzle(fs string, fn func(hdr *tar.Header, r io.Reader) error) error {
+	b, name, err := backendFor(fs)
+	if err != nil {
+		return &Error{"open", fs, err}
+	}
+	f, err := b.Open(name)
+	if err != nil {
+		return &Error{"open", fs, err}
+	}
+	defer f.Close()
+	tr, _, err := openArchive(f)
+	if err != nil {
+		return &Error{"open archive", fs, err}
+	}
+	for {
+		header, err := tr.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return &Error{"read archive", fs, err}
+		}
+		if err := fn(header, tr); err != nil {
+			return err
+		}
+	}
 }
 
 func scanPalaDesktopFile(tr io.Reader, out *PuzzleInfo) *Error {
-	s := bufio.NewScanner(tr) // Process one line at a time
-	for s.Scan() {
-		if m := reKeyValue.FindStringSubmatch(s.Text()); m != nil {
-			key, value := m[1], strings.TrimSpace(m[2])
+	data, err := io.ReadAll(tr)
+	if err != nil {
+		// Caller will fixup .FilePath in Error struct.
+		return &Error{`read "pala.desktop" member in`, "?", err}
+	}
+	out.desktop = parseDesktop(data)
+	out.Desktop = out.desktop.groups()
+	type found struct {
+		rank   int // Index in desktopAliases' keys, after all of those in its group
+		value  string
+		source KeySource
+	}
+	best := make(map[string]found)
+	for _, l := range out.desktop.lines {
+		if !l.isKey {
+			continue
+		}
+		key, value := l.key, l.value
+		if m := reLocalizedKey.FindStringSubmatch(key); m != nil {
+			key, locale := m[1], m[2]
+			if l.group != mainGroup {
+				continue
+			}
 			switch key {
 			case "Name":
-				out.Title = value
-			case "X-KDE-PluginInfo-Author":
-				out.Author = value
+				out.Titles = setLocalized(out.Titles, locale, unescapeValue(value))
 			case "Comment":
-				out.Comment = value
-			case "PieceCount", "020_PieceCount":
-				n, err := strconv.Atoi(value)
-				if err != nil {
-					n = -1
-					out.Warnings = append(out.Warnings,
-						fmt.Sprintf("bad PieceCount %q", value))
+				out.Comments = setLocalized(out.Comments, locale, unescapeValue(value))
+			}
+			continue
+		}
+		if m := reNumberedKey.FindStringSubmatch(key); m != nil {
+			key = m[1]
+		}
+		for _, fa := range desktopAliases {
+			for rank, alias := range fa.keys {
+				if alias != key {
+					continue
+				}
+				if l.group != fa.group {
+					rank += len(fa.keys)
+				}
+				if b, ok := best[fa.field]; !ok || rank <= b.rank {
+					best[fa.field] = found{rank, value, KeySource{l.group, l.key}}
 				}
-				out.NPiecesDecl = n
 			}
 		}
 	}
-	if s.Err() != nil {
-		// Caller will fixup .FilePath in Error struct.
-		return &Error{`cannot read "pala.desktop" member in `, "?", s.Err()}
+	for field, f := range best {
+		switch field {
+		case "Title":
+			out.Title = unescapeValue(f.value)
+		case "Author":
+			out.Author = unescapeValue(f.value)
+		case "Comment":
+			out.Comment = unescapeValue(f.value)
+		case "AltText":
+			out.AltText = unescapeValue(f.value)
+		case "Slicer":
+			out.Slicer = unescapeValue(f.value)
+		case "SlicerMode":
+			out.SlicerMode = unescapeValue(f.value)
+		case "ModifyProtection":
+			out.ModifyProtection, _ = parseBool(f.value)
+		case "NPiecesDecl":
+			n, err := strconv.Atoi(f.value)
+			if err != nil {
+				n = -1
+				out.warn(WarnBadPieceCount,
+					fmt.Sprintf("bad PieceCount %q", f.value),
+					"value", f.value)
+			}
+			out.NPiecesDecl = n
+		}
+		if out.Sources == nil {
+			out.Sources = make(map[string]KeySource)
+		}
+		out.Sources[field] = f.source
 	}
+	out.Extras = out.desktop.extras(out.Sources)
+	out.Flags = out.desktop.flags()
+	out.FormatVersion = out.desktop.formatVersion()
 	return nil
 }
 
+// maxMissingRun is the longest run of missing pieces that gets a warning for
+// each piece; a longer one gets a single warning for the lot, so that a
+// member like "2000000000.png" cannot make billions of them.
+const maxMissingRun = 100
+
+// warnPieces adds warnings about missing and duplicate pieces to pi, from
+// how many members there are of each piece number.
+func (pi *PuzzleInfo) warnPieces(found map[int]int) {
+	nums := make([]int, 0, len(found))
+	for n := range found {
+		nums = append(nums, n)
+	}
+	sort.Ints(nums)
+	next := 0 // The lowest number not yet accounted for
+	for _, n := range nums {
+		if n-next > maxMissingRun {
+			pi.warn(WarnMissingPiece,
+				fmt.Sprintf(`missing "%d.png" to "%d.png"`, next, n-1),
+				"piece", strconv.Itoa(next), "last", strconv.Itoa(n-1))
+		} else {
+			for i := next; i < n; i++ {
+				pi.warn(WarnMissingPiece,
+					fmt.Sprintf(`missing "%d.png"`, i),
+					"piece", strconv.Itoa(i))
+			}
+		}
+		if c := found[n]; c > 1 {
+			pi.warn(WarnDuplicatePiece,
+				fmt.Sprintf(`%d members named "%d.png"`, c, n),
+				"piece", strconv.Itoa(n), "count", strconv.Itoa(c))
+		}
+		next = n + 1
+	}
+}
+
+// desktopAliases lists the keys of pala.desktop that can supply each field
+// of PuzzleInfo, best first; old versions of Palapeli, and other programs,
+// used some different names. Keys may also have a position prefix, like
+// "020_PieceCount", as slicer settings did in Palapeli 1.x. Only the best
+// key found is used. Keys in the field's own group come first, so that
+// (say) a Name in some other program's group cannot clobber the puzzle's
+// title; the same keys elsewhere are only used if it has none of them.
+var desktopAliases = []struct {
+	field string
+	group string
+	keys  []string
+}{
+	{"Title", mainGroup, []string{"Name"}},
+	{"Author", mainGroup, []string{"X-KDE-PluginInfo-Author", "Author", "X-KDE-Author"}},
+	{"Comment", mainGroup, []string{"Comment"}},
+	{"NPiecesDecl", slicerGroup, []string{"PieceCount"}},
+	{"AltText", mainGroup, []string{altTextKey}},
+	{"Slicer", jobGroup, []string{"Slicer"}},
+	{"SlicerMode", jobGroup, []string{"SlicerMode"}},
+	{"ModifyProtection", mainGroup, []string{"ModifyProtection"}},
+}
+
+// A KeySource is a key of pala.desktop, in its group.
+type KeySource struct {
+	Group, Key string
+}
+
+func (ks KeySource) String() string {
+	return "[" + ks.Group + "] " + ks.Key
+}
+
+// DesktopValue returns the value of key in the given group of the puzzle's
+// pala.desktop file, and whether it was there at all. This gives access to
+// keys which PuzzleInfo has no field for, such as Icon, Type or X- keys of
+// other programs. Keys before the first group header are in group "".
+// Translated keys are named as in the file, like "Name[de]".
+func (pi *PuzzleInfo) DesktopValue(group, key string) (string, bool) {
+	if pi.desktop == nil {
+		return "", false
+	}
+	return pi.desktop.get(group, key)
+}
+
+// DesktopList is like DesktopValue, for keys whose values are lists, like
+// Keywords: it splits the value at semicolons, as the Desktop Entry
+// Specification says, and decodes the escapes in each item ("\;" for a
+// semicolon within one). It returns nil if the key is not there.
+func (pi *PuzzleInfo) DesktopList(group, key string) []string {
+	v, ok := pi.DesktopValue(group, key)
+	if !ok {
+		return nil
+	}
+	return splitList(v)
+}
+
+// setLocalized sets m[locale] to value, making m if need be, and returns m.
+func setLocalized(m map[string]string, locale, value string) map[string]string {
+	if m == nil {
+		m = make(map[string]string)
+	}
+	m[locale] = value
+	return m
+}
+
 type Error struct { // Order must match ‘return &Error{"what", which, e}’ above
 	Action    string // What we were trying to do
 	FilePath  string // Which file we were trying to parse
@@ -164,3 +815,9 @@ func (e *Error) Error() string {
 	}
 	return `cannot ` + e.Action + ` "` + e.FilePath + `"` + baseErrStr
 }
+
+// Unwrap returns the underlying error, so that errors.Is and errors.As can
+// look through an Error.
+func (e *Error) Unwrap() error {
+	return e.BaseError
+}
@@ -0,0 +1,154 @@
+package palapuzzle
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/c12h/palapuzzle/palapuzzletest"
+)
+
+// A testMember is a member of a puzzle made by testPuzzle, or read back by
+// readMembers.
+type testMember struct {
+	Name     string
+	Body     string
+	Type     byte   // Default tar.TypeReg
+	Linkname string // For links
+	Mode     int64  // Default 0644
+	ModTime  time.Time
+}
+
+// testPuzzle writes a valid synthetic puzzle (see palapuzzletest) with the
+// given members to a temporary file, and returns its path. Each member
+// replaces one of the same name, or is added at the end.
+func testPuzzle(t testing.TB, ms ...testMember) string {
+	t.Helper()
+	zr, err := gzip.NewReader(bytes.NewReader(palapuzzletest.Bytes(palapuzzletest.Spec{})))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var all []testMember
+	tr := tar.NewReader(zr)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		body, _ := io.ReadAll(tr)
+		all = append(all, testMember{Name: hdr.Name, Body: string(body)})
+	}
+	for _, m := range ms {
+		replaced := false
+		for i := range all {
+			if all[i].Name == m.Name && !replaced {
+				all[i], replaced = m, true
+			}
+		}
+		if !replaced {
+			all = append(all, m)
+		}
+	}
+	return writeTestPuzzle(t, all)
+}
+
+// writeTestPuzzle writes a puzzle with exactly the members ms, in order, to
+// a temporary file, and returns its path.
+func writeTestPuzzle(t testing.TB, ms []testMember) string {
+	t.Helper()
+	var buf bytes.Buffer
+	zw := gzip.NewWriter(&buf)
+	tw := tar.NewWriter(zw)
+	for _, m := range ms {
+		hdr := &tar.Header{Name: m.Name, Typeflag: m.Type, Linkname: m.Linkname, Mode: m.Mode, ModTime: m.ModTime}
+		if hdr.Typeflag == 0 {
+			hdr.Typeflag = tar.TypeReg
+		}
+		if hdr.Mode == 0 {
+			hdr.Mode = 0644
+		}
+		if hdr.Typeflag == tar.TypeReg {
+			hdr.Size = int64(len(m.Body))
+		}
+		if err := tw.WriteHeader(hdr); err != nil {
+			t.Fatal(err)
+		}
+		tw.Write([]byte(m.Body))
+	}
+	tw.Close()
+	zw.Close()
+	p := filepath.Join(t.TempDir(), "test.puzzle")
+	if err := os.WriteFile(p, buf.Bytes(), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return p
+}
+
+// readMembers returns the members of the puzzle at path, in order.
+func readMembers(t testing.TB, path string) []testMember {
+	t.Helper()
+	var ret []testMember
+	err := walkPuzzle(path, func(hdr *tar.Header, r io.Reader) error {
+		body, err := io.ReadAll(r)
+		ret = append(ret, testMember{hdr.Name, string(body), hdr.Typeflag, hdr.Linkname, hdr.Mode, hdr.ModTime})
+		return err
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return ret
+}
+
+// desktopFirst returns the members of the synthetic puzzle s with
+// pala.desktop moved to the front, so that MetadataOnly stops before the
+// pieces.
+func desktopFirst(t testing.TB, s palapuzzletest.Spec) []testMember {
+	t.Helper()
+	ms := readMembers(t, palapuzzletest.File(t, s))
+	for i, m := range ms {
+		if m.Name == "pala.desktop" {
+			return append([]testMember{m}, append(ms[:i:i], ms[i+1:]...)...)
+		}
+	}
+	t.Fatal("no pala.desktop")
+	return nil
+}
+
+func TestScanMetadataOnly(t *testing.T) {
+	p := writeTestPuzzle(t, desktopFirst(t, palapuzzletest.Spec{Cols: 3, Variant: palapuzzletest.MissingPiece}))
+	pi, err := ScanPuzzle(p, MetadataOnly(), Strict())
+	if err != nil {
+		t.Fatalf("MetadataOnly, Strict: %v (the missing piece is not read)", err)
+	}
+	if pi.NPieceFiles != -1 || len(pi.Warnings) != 0 {
+		t.Errorf("NPieceFiles = %d, warnings %v; want -1 and none", pi.NPieceFiles, pi.Warnings)
+	}
+
+	ms := desktopFirst(t, palapuzzletest.Spec{Variant: palapuzzletest.BadDesktop})
+	if _, err := ScanPuzzle(writeTestPuzzle(t, ms), MetadataOnly(), Strict()); err == nil {
+		t.Error("MetadataOnly, Strict: no error for a bad pala.desktop")
+	}
+	bad := writeTestPuzzle(t, append([]testMember{{Name: "notes.txt", Body: "x"}}, ms...))
+	pi, err = ScanPuzzle(bad, MetadataOnly(), ReportUnknownMembers())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(pi.Warnings) < 2 {
+		t.Fatalf("got %d warnings, want 2 or more", len(pi.Warnings))
+	}
+	pi, err = ScanPuzzle(bad, MetadataOnly(), ReportUnknownMembers(), MaxWarnings(1))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(pi.Warnings) != 1 {
+		t.Errorf("MetadataOnly, MaxWarnings(1): %d warnings, want 1", len(pi.Warnings))
+	}
+}
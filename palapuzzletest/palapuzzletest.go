@@ -0,0 +1,172 @@
+// Package palapuzzletest builds synthetic .puzzle files, valid and broken,
+// for testing programs that use package palapuzzle without shipping binary
+// fixtures.
+package palapuzzletest
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
+	"image/jpeg"
+	"image/png"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// A Variant is a way in which a synthetic puzzle is broken, or not.
+type Variant int
+
+const (
+	// A well-formed puzzle, which scans without warnings
+	Valid Variant = iota
+	// Piece 1.png is left out, so scanning warns of a missing piece
+	// (palapuzzle.WarnMissingPiece); a puzzle needs at least 3 pieces
+	// for this to show
+	MissingPiece
+	// The gzip stream is cut off half way, so the puzzle cannot be read
+	CorruptGzip
+	// The pala.desktop has no piece offsets, a PieceCount which is not a
+	// number (palapuzzle.WarnBadPieceCount) and a line which is not a key,
+	// group header or comment
+	BadDesktop
+)
+
+func (v Variant) String() string {
+	switch v {
+	case Valid:
+		return "valid"
+	case MissingPiece:
+		return "missing-piece"
+	case CorruptGzip:
+		return "corrupt-gzip"
+	case BadDesktop:
+		return "bad-desktop"
+	}
+	return fmt.Sprintf("Variant(%d)", int(v))
+}
+
+// A Spec describes a synthetic puzzle: an image cut into a grid of
+// rectangular pieces, each a different colour. Zero fields get defaults.
+type Spec struct {
+	Title   string // Default "Test puzzle"
+	Author  string // Default "palapuzzletest"
+	Cols    int    // Default 2
+	Rows    int    // Default 2
+	PieceW  int    // The pieces' size in pixels; default 32 by 32
+	PieceH  int
+	NoImage bool // Leave out image.jpg, as palapuzzle.SlimPuzzle does
+	Variant Variant
+}
+
+func (s Spec) withDefaults() Spec {
+	def := func(p *int, v int) {
+		if *p <= 0 {
+			*p = v
+		}
+	}
+	if s.Title == "" {
+		s.Title = "Test puzzle"
+	}
+	if s.Author == "" {
+		s.Author = "palapuzzletest"
+	}
+	def(&s.Cols, 2)
+	def(&s.Rows, 2)
+	def(&s.PieceW, 32)
+	def(&s.PieceH, 32)
+	return s
+}
+
+// Bytes returns the content of the .puzzle file s describes.
+func Bytes(s Spec) []byte {
+	s = s.withDefaults()
+	var buf bytes.Buffer
+	zw := gzip.NewWriter(&buf)
+	tw := tar.NewWriter(zw)
+	mtime := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC) // So output is reproducible
+	add := func(name string, data []byte) {
+		hdr := &tar.Header{Name: name, Typeflag: tar.TypeReg, Mode: 0644, Size: int64(len(data)), ModTime: mtime}
+		if err := tw.WriteHeader(hdr); err != nil {
+			panic(err) // Writing to memory cannot fail
+		}
+		tw.Write(data)
+	}
+
+	n := s.Cols * s.Rows
+	if !s.NoImage {
+		img := image.NewRGBA(image.Rect(0, 0, s.Cols*s.PieceW, s.Rows*s.PieceH))
+		for i := 0; i < n; i++ {
+			draw.Draw(img, pieceRect(s, i), image.NewUniform(pieceColour(i)), image.Point{}, draw.Src)
+		}
+		var jpg bytes.Buffer
+		jpeg.Encode(&jpg, img, nil)
+		add("image.jpg", jpg.Bytes())
+	}
+	for i := 0; i < n; i++ {
+		if s.Variant == MissingPiece && i == 1 {
+			continue
+		}
+		img := image.NewNRGBA(image.Rect(0, 0, s.PieceW, s.PieceH))
+		draw.Draw(img, img.Bounds(), image.NewUniform(pieceColour(i)), image.Point{}, draw.Src)
+		var pc bytes.Buffer
+		png.Encode(&pc, img)
+		add(fmt.Sprintf("%d.png", i), pc.Bytes())
+	}
+	add("pala.desktop", desktop(s))
+
+	tw.Close()
+	zw.Close()
+	data := buf.Bytes()
+	if s.Variant == CorruptGzip {
+		data = data[:len(data)/2]
+	}
+	return data
+}
+
+// File writes the .puzzle file s describes to a new temporary directory
+// from t.TempDir, named after its variant (like "missing-piece.puzzle"),
+// and returns its path.
+func File(t testing.TB, s Spec) string {
+	t.Helper()
+	p := filepath.Join(t.TempDir(), s.Variant.String()+".puzzle")
+	if err := os.WriteFile(p, Bytes(s), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return p
+}
+
+// desktop returns the pala.desktop for s.
+func desktop(s Spec) []byte {
+	var b bytes.Buffer
+	fmt.Fprintf(&b, "[Desktop Entry]\nName=%s\nType=X-Palapeli-Puzzle\nX-KDE-PluginInfo-Author=%s\n", s.Title, s.Author)
+	n := s.Cols * s.Rows
+	if s.Variant == BadDesktop {
+		fmt.Fprintf(&b, "this line is not a key\n\n[SlicerArgs]\nPieceCount=lots\n")
+		return b.Bytes()
+	}
+	fmt.Fprintf(&b, "\n[PieceOffsets]\n")
+	for i := 0; i < n; i++ {
+		r := pieceRect(s, i)
+		fmt.Fprintf(&b, "%d=%d,%d\n", i, r.Min.X, r.Min.Y)
+	}
+	fmt.Fprintf(&b, "\n[SlicerArgs]\nPieceCount=%d\n", n)
+	return b.Bytes()
+}
+
+// pieceRect returns where piece i of s goes in the solved puzzle.
+func pieceRect(s Spec, i int) image.Rectangle {
+	x, y := i%s.Cols*s.PieceW, i/s.Cols*s.PieceH
+	return image.Rect(x, y, x+s.PieceW, y+s.PieceH)
+}
+
+// pieceColour returns the colour of piece i, which differs from its
+// neighbours'.
+func pieceColour(i int) color.NRGBA {
+	return color.NRGBA{uint8(37 * i), uint8(255 - 53*i), uint8(101 * i), 255}
+}
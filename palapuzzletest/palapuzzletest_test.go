@@ -0,0 +1,68 @@
+package palapuzzletest_test
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/c12h/palapuzzle"
+	"github.com/c12h/palapuzzle/palapuzzletest"
+)
+
+func TestVariants(t *testing.T) {
+	for _, c := range []struct {
+		spec    palapuzzletest.Spec
+		want    palapuzzle.WarningKind // Zero for none
+		wantErr bool
+	}{
+		{spec: palapuzzletest.Spec{}},
+		{spec: palapuzzletest.Spec{NoImage: true, Cols: 3, Rows: 1}},
+		{spec: palapuzzletest.Spec{Variant: palapuzzletest.MissingPiece}, want: palapuzzle.WarnMissingPiece},
+		{spec: palapuzzletest.Spec{Variant: palapuzzletest.BadDesktop}, want: palapuzzle.WarnBadPieceCount},
+		{spec: palapuzzletest.Spec{Variant: palapuzzletest.CorruptGzip}, wantErr: true},
+	} {
+		name := c.spec.Variant.String()
+		pi, err := palapuzzle.ScanPuzzle(palapuzzletest.File(t, c.spec))
+		if c.wantErr {
+			if err == nil {
+				t.Errorf("%s: no error", name)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: %v", name, err)
+			continue
+		}
+		if c.want == 0 {
+			if len(pi.Warnings) != 0 {
+				t.Errorf("%s: warnings %v", name, pi.Warnings)
+			}
+		} else if !palapuzzle.HasWarning(pi, c.want) {
+			t.Errorf("%s: no %v warning in %v", name, c.want, pi.Warnings)
+		}
+	}
+}
+
+func TestSpecDefaults(t *testing.T) {
+	pi, err := palapuzzle.ScanPuzzle(palapuzzletest.File(t, palapuzzletest.Spec{}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if pi.Title != "Test puzzle" || pi.Author != "palapuzzletest" || pi.NPieceFiles != 4 || pi.NPiecesDecl != 4 ||
+		pi.ImageWidth != 64 || pi.ImageHeight != 64 {
+		t.Errorf("%+v", pi)
+	}
+	pi, err = palapuzzle.ScanPuzzle(palapuzzletest.File(t, palapuzzletest.Spec{NoImage: true}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if pi.ImageFileSize != 0 {
+		t.Errorf("NoImage puzzle has image.jpg of %d bytes", pi.ImageFileSize)
+	}
+}
+
+func TestBytesReproducible(t *testing.T) {
+	s := palapuzzletest.Spec{Cols: 3, Rows: 2}
+	if !bytes.Equal(palapuzzletest.Bytes(s), palapuzzletest.Bytes(s)) {
+		t.Error("Bytes differs between calls")
+	}
+}
@@ -0,0 +1,202 @@
+package palapuzzle
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
+	"image/jpeg"
+	"io"
+	"math"
+)
+
+// A Paper is a paper size, in millimetres.
+type Paper struct {
+	Width, Height float64
+}
+
+// Common paper sizes.
+var (
+	A4     = Paper{210, 297}
+	A3     = Paper{297, 420}
+	Letter = Paper{215.9, 279.4}
+)
+
+// A PDFLayout says how ExportPDF lays out a puzzle's picture.
+type PDFLayout struct {
+	// The paper to print on; the zero Paper means A4
+	Paper Paper
+	// Print across the paper's long side rather than its short one
+	Landscape bool
+	// The margin around each page, in millimetres; zero means 10
+	Margin float64
+	// How wide the picture should be when printed, in millimetres; zero
+	// means as big as fits on one page. A picture too big for one page
+	// is split across as many as it needs, to be glued together.
+	Width float64
+	// Draw the outlines of the pieces on the picture, as a guide for
+	// cutting it up
+	Outlines bool
+}
+
+// ExportPDF writes a PDF document of the picture of the puzzle at path to w,
+// laid out as layout says, so that the puzzle can be printed, stuck to card
+// and cut up by hand. The picture is the puzzle's image.jpg, or if that is
+// missing or unreadable, the pieces composited at their offsets; piece
+// outlines need the pieces' offsets.
+func ExportPDF(path string, w io.Writer, layout PDFLayout) error {
+	img, _, err := puzzleImage(path)
+	if err != nil {
+		return err
+	}
+	if layout.Outlines {
+		pc, err := readContent(path)
+		if err != nil {
+			return err
+		}
+		if img, err = pc.drawOutlines(img); err != nil {
+			return &Error{"draw outlines for", path, err}
+		}
+	}
+	var jpg bytes.Buffer
+	if err := jpeg.Encode(&jpg, img, &jpeg.Options{Quality: imageQuality}); err != nil {
+		return &Error{"encode image of", path, err}
+	}
+	space := "DeviceRGB"
+	if _, ok := img.(*image.Gray); ok {
+		space = "DeviceGray" // jpeg.Encode writes one component for these
+	}
+
+	paper := layout.Paper
+	if paper == (Paper{}) {
+		paper = A4
+	}
+	if layout.Landscape != (paper.Width > paper.Height) {
+		paper.Width, paper.Height = paper.Height, paper.Width
+	}
+	margin := layout.Margin
+	if margin == 0 {
+		margin = 10
+	}
+	areaW, areaH := paper.Width-2*margin, paper.Height-2*margin
+	if areaW <= 0 || areaH <= 0 {
+		return &Error{"lay out", path, fmt.Errorf("margin of %gmm leaves no room", margin)}
+	}
+	b := img.Bounds()
+	aspect := float64(b.Dy()) / float64(b.Dx())
+	width := layout.Width
+	if width <= 0 {
+		width = math.Min(areaW, areaH/aspect)
+	}
+	height := width * aspect
+	cols := int(math.Ceil(width/areaW - 1e-9))
+	rows := int(math.Ceil(height/areaH - 1e-9))
+
+	// Each page shows the whole picture, moved so that the right part of
+	// it lands in the page's printable area, and clipped to that area.
+	var pages []string
+	for r := 0; r < rows; r++ {
+		for c := 0; c < cols; c++ {
+			x := margin - float64(c)*areaW
+			y := paper.Height - margin - height + float64(r)*areaH
+			pages = append(pages, fmt.Sprintf("q %s %s %s %s re W n %s 0 0 %s %s %s cm /Im0 Do Q\n",
+				pt(margin), pt(margin), pt(areaW), pt(areaH),
+				pt(width), pt(height), pt(x), pt(y)))
+		}
+	}
+	return writePDF(w, paper, b.Dx(), b.Dy(), space, jpg.Bytes(), pages)
+}
+
+// pt converts millimetres to PDF points, formatted for a content stream.
+func pt(mm float64) string {
+	return fmt.Sprintf("%.2f", mm*72/25.4)
+}
+
+// writePDF writes a PDF document with one page of the given size for each
+// content stream in pages, all of which can draw the JPEG image jpg (of w×h
+// pixels, in the PDF colour space named space) as /Im0.
+func writePDF(out io.Writer, paper Paper, w, h int, space string, jpg []byte, pages []string) error {
+	bw := bufio.NewWriter(out)
+	var offsets []int
+	n := 0
+	obj := func(format string, args ...interface{}) {
+		offsets = append(offsets, n)
+		k, _ := fmt.Fprintf(bw, "%d 0 obj\n"+format+"\nendobj\n", append([]interface{}{len(offsets)}, args...)...)
+		n += k
+	}
+	k, _ := fmt.Fprint(bw, "%PDF-1.4\n%\xe2\xe3\xcf\xd3\n")
+	n += k
+
+	// Objects 1 and 2 are the catalog and page tree, 3 the image; then
+	// each page and its content stream.
+	kids := ""
+	for i := range pages {
+		kids += fmt.Sprintf("%d 0 R ", 4+2*i)
+	}
+	obj("<< /Type /Catalog /Pages 2 0 R >>")
+	obj("<< /Type /Pages /Kids [%s] /Count %d >>", kids, len(pages))
+	obj("<< /Type /XObject /Subtype /Image /Width %d /Height %d /ColorSpace /%s"+
+		" /BitsPerComponent 8 /Filter /DCTDecode /Length %d >>\nstream\n%s\nendstream",
+		w, h, space, len(jpg), jpg)
+	for i, content := range pages {
+		obj("<< /Type /Page /Parent 2 0 R /MediaBox [0 0 %s %s]"+
+			" /Resources << /XObject << /Im0 3 0 R >> >> /Contents %d 0 R >>",
+			pt(paper.Width), pt(paper.Height), 5+2*i)
+		obj("<< /Length %d >>\nstream\n%s\nendstream", len(content), content)
+	}
+
+	fmt.Fprintf(bw, "xref\n0 %d\n0000000000 65535 f \n", len(offsets)+1)
+	for _, off := range offsets {
+		fmt.Fprintf(bw, "%010d 00000 n \n", off)
+	}
+	fmt.Fprintf(bw, "trailer\n<< /Size %d /Root 1 0 R >>\nstartxref\n%d\n%%%%EOF\n", len(offsets)+1, n)
+	return bw.Flush()
+}
+
+// drawOutlines returns a copy of img with the outline of every piece drawn
+// on it. The picture is taken to cover the area the pieces do, so where its
+// size differs (as a shrunken image.jpg's does), the outlines are scaled to
+// fit it.
+func (pc *puzzleContent) drawOutlines(img image.Image) (image.Image, error) {
+	area, err := pc.bounds()
+	if err != nil {
+		return nil, err
+	}
+	w, h := area.Dx(), area.Dy()
+	b := img.Bounds()
+	W, H := b.Dx(), b.Dy()
+	owner := pc.owners(area)
+	// at returns the piece which pixel (x, y) of the picture shows.
+	at := func(x, y int) int32 {
+		return owner[(y*h/H)*w+x*w/W]
+	}
+	out := image.NewRGBA(image.Rect(0, 0, W, H))
+	draw.Draw(out, out.Bounds(), img, b.Min, draw.Src)
+	for y := 0; y < H; y++ {
+		for x := 0; x < W; x++ {
+			o := at(x, y)
+			if (x+1 < W && at(x+1, y) != o) || (y+1 < H && at(x, y+1) != o) {
+				out.Set(x, y, color.Black)
+			}
+		}
+	}
+	return out, nil
+}
+
+// owners returns, for each pixel of a row-major bitmap of area, the number of
+// the piece it belongs to, or -1 if none. Where anti-aliased pieces overlap,
+// a pixel belongs to the last piece which is more opaque than not there.
+func (pc *puzzleContent) owners(area image.Rectangle) []int32 {
+	owner := make([]int32, area.Dx()*area.Dy())
+	for i := range owner {
+		owner[i] = -1
+	}
+	pc.eachPixel(area, func(n, i int, a uint8) {
+		if a >= coverageAlpha {
+			owner[i] = int32(n)
+		}
+	})
+	return owner
+}
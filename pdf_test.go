@@ -0,0 +1,72 @@
+package palapuzzle
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"image/draw"
+	"image/jpeg"
+	"strings"
+	"testing"
+)
+
+// pdfImage returns the image /Im0 of a PDF written by ExportPDF, and its
+// dictionary.
+func pdfImage(t *testing.T, pdf []byte) (image.Image, string) {
+	t.Helper()
+	s := string(pdf)
+	i := strings.Index(s, "/Subtype /Image")
+	j := strings.Index(s[i:], ">>\nstream\n")
+	if i < 0 || j < 0 {
+		t.Fatal("no image in the PDF")
+	}
+	dict := s[i : i+j]
+	data := s[i+j+len(">>\nstream\n"):]
+	img, err := jpeg.Decode(strings.NewReader(data[:strings.Index(data, "\nendstream")]))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return img, dict
+}
+
+func TestExportPDFGreyShrunk(t *testing.T) {
+	// A quarter of the size of the pieces' 64×64 area, and grey
+	grey := image.NewGray(image.Rect(0, 0, 32, 32))
+	draw.Draw(grey, grey.Bounds(), image.NewUniform(color.Gray{200}), image.Point{}, draw.Src)
+	var jpg bytes.Buffer
+	if err := jpeg.Encode(&jpg, grey, nil); err != nil {
+		t.Fatal(err)
+	}
+	p := testPuzzle(t, testMember{Name: "image.jpg", Body: jpg.String()})
+
+	var out bytes.Buffer
+	if err := ExportPDF(p, &out, PDFLayout{}); err != nil {
+		t.Fatal(err)
+	}
+	if _, dict := pdfImage(t, out.Bytes()); !strings.Contains(dict, "/ColorSpace /DeviceGray") {
+		t.Errorf("image dictionary %q, want /DeviceGray", dict)
+	}
+
+	out.Reset()
+	if err := ExportPDF(p, &out, PDFLayout{Outlines: true}); err != nil {
+		t.Fatal(err)
+	}
+	img, dict := pdfImage(t, out.Bytes())
+	if !strings.Contains(dict, "/ColorSpace /DeviceRGB") {
+		t.Errorf("image dictionary %q with outlines, want /DeviceRGB", dict)
+	}
+	if b := img.Bounds(); b.Dx() != 32 || b.Dy() != 32 {
+		t.Fatalf("image is %v, want the 32×32 of image.jpg", b)
+	}
+	// The outlines, scaled to fit, run between pixels 15 and 16 each way
+	lum := func(x, y int) uint8 { return color.GrayModel.Convert(img.At(x, y)).(color.Gray).Y }
+	if y := lum(15, 8); y > 80 {
+		t.Errorf("pixel (15, 8) on the outline has luminance %d, want black", y)
+	}
+	if y := lum(8, 15); y > 80 {
+		t.Errorf("pixel (8, 15) on the outline has luminance %d, want black", y)
+	}
+	if y := lum(8, 8); y < 150 {
+		t.Errorf("pixel (8, 8) inside a piece has luminance %d, want grey", y)
+	}
+}
@@ -0,0 +1,154 @@
+package palapuzzle
+
+import (
+	"bytes"
+	"compress/flate"
+	"compress/gzip"
+	"encoding/binary"
+	"hash/crc32"
+	"io"
+)
+
+// The size of the blocks that a parallelGzipWriter compresses separately,
+// and how much of each block's end serves as the next block's dictionary.
+const (
+	pgzipBlockSize = 1 << 20
+	pgzipDictSize  = 32 << 10
+)
+
+// A parallelGzipWriter produces an ordinary gzip stream, but compresses
+// blocks of its input concurrently. Each block is compressed with the end of
+// the previous block as its dictionary and finished with a sync flush, so
+// the concatenated blocks form one valid deflate stream and compress almost
+// as well as a single gzip.Writer would.
+type parallelGzipWriter struct {
+	w      io.Writer
+	level  int
+	crc    uint32
+	size   uint32 // Input size mod 2^32, as gzip records it
+	buf    []byte // The block being filled
+	dict   []byte // End of the previous block
+	queue  chan chan pgzipResult
+	done   chan error // Result of the goroutine writing to w
+	closed bool
+}
+
+type pgzipResult struct {
+	data []byte
+	err  error
+}
+
+// newParallelGzipWriter returns a parallelGzipWriter which compresses at
+// the given level using up to n goroutines.
+func newParallelGzipWriter(w io.Writer, level, n int) (*parallelGzipWriter, error) {
+	if level < gzip.HuffmanOnly || level > gzip.BestCompression {
+		_, err := gzip.NewWriterLevel(w, level) // For its error
+		return nil, err
+	}
+	if n < 1 {
+		n = 1
+	}
+	z := &parallelGzipWriter{
+		w:     w,
+		level: level,
+		buf:   make([]byte, 0, pgzipBlockSize),
+		queue: make(chan chan pgzipResult, n),
+		done:  make(chan error, 1),
+	}
+	xfl := byte(0)
+	if level == gzip.BestCompression {
+		xfl = 2
+	} else if level == gzip.BestSpeed {
+		xfl = 4
+	}
+	header := []byte{0x1f, 0x8b, 8, 0, 0, 0, 0, 0, xfl, 255}
+	if _, err := w.Write(header); err != nil {
+		return nil, err
+	}
+	go z.writeBlocks()
+	return z, nil
+}
+
+// writeBlocks writes the compressed blocks to z.w in order, then reports
+// the first error (if any) on z.done.
+func (z *parallelGzipWriter) writeBlocks() {
+	var err error
+	for ch := range z.queue {
+		res := <-ch
+		if err == nil {
+			err = res.err
+		}
+		if err == nil {
+			_, err = z.w.Write(res.data)
+		}
+	}
+	z.done <- err
+}
+
+// dispatch starts compressing z.buf, which is the final block if last.
+func (z *parallelGzipWriter) dispatch(last bool) {
+	block, dict := z.buf, z.dict
+	ch := make(chan pgzipResult, 1)
+	z.queue <- ch // Blocks while n compressions are outstanding
+	go func() {
+		var out bytes.Buffer
+		fw, err := flate.NewWriterDict(&out, z.level, dict)
+		if err == nil {
+			_, err = fw.Write(block)
+		}
+		if err == nil {
+			if last {
+				err = fw.Close()
+			} else {
+				err = fw.Flush()
+			}
+		}
+		ch <- pgzipResult{out.Bytes(), err}
+	}()
+	if len(block) > pgzipDictSize {
+		z.dict = block[len(block)-pgzipDictSize:]
+	} else {
+		z.dict = append(z.dict, block...)
+		if len(z.dict) > pgzipDictSize {
+			z.dict = z.dict[len(z.dict)-pgzipDictSize:]
+		}
+	}
+	z.buf = make([]byte, 0, pgzipBlockSize)
+}
+
+func (z *parallelGzipWriter) Write(p []byte) (int, error) {
+	if z.closed {
+		return 0, io.ErrClosedPipe
+	}
+	z.crc = crc32.Update(z.crc, crc32.IEEETable, p)
+	z.size += uint32(len(p))
+	written := len(p)
+	for len(p) > 0 {
+		n := copy(z.buf[len(z.buf):cap(z.buf)], p)
+		z.buf = z.buf[:len(z.buf)+n]
+		p = p[n:]
+		if len(z.buf) == cap(z.buf) {
+			z.dispatch(false)
+		}
+	}
+	return written, nil
+}
+
+// Close compresses any remaining input and writes the gzip trailer. It does
+// not close the underlying writer.
+func (z *parallelGzipWriter) Close() error {
+	if z.closed {
+		return nil
+	}
+	z.closed = true
+	z.dispatch(true)
+	close(z.queue)
+	if err := <-z.done; err != nil {
+		return err
+	}
+	var trailer [8]byte
+	binary.LittleEndian.PutUint32(trailer[:4], z.crc)
+	binary.LittleEndian.PutUint32(trailer[4:], z.size)
+	_, err := z.w.Write(trailer[:])
+	return err
+}
@@ -0,0 +1,63 @@
+package palapuzzle
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// gunzip returns the content of the gzip stream in data, failing t if it is
+// not one valid gzip member.
+func gunzip(t *testing.T, data []byte) []byte {
+	t.Helper()
+	r := bytes.NewReader(data)
+	zr, err := gzip.NewReader(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	zr.Multistream(false)
+	out, err := io.ReadAll(zr) // Checks the CRC and size too
+	if err != nil {
+		t.Fatal(err)
+	}
+	if r.Len() != 0 {
+		t.Fatalf("%d bytes after the gzip member", r.Len())
+	}
+	return out
+}
+
+func TestParallelRecompress(t *testing.T) {
+	// A piece of random bytes, and a member that compresses well, together
+	// several blocks long
+	rng := rand.New(rand.NewSource(1))
+	noise := make([]byte, 3*pgzipBlockSize/2)
+	rng.Read(noise)
+	text := bytes.Repeat([]byte("the quick brown fox jumps over the lazy dog\n"), 2*pgzipBlockSize/44)
+	src := testPuzzle(t,
+		testMember{Name: "noise.bin", Body: string(noise)},
+		testMember{Name: "notes.txt", Body: string(text)})
+
+	dir := t.TempDir()
+	serial, parallel := filepath.Join(dir, "serial.puzzle"), filepath.Join(dir, "parallel.puzzle")
+	if err := Recompress(src, serial); err != nil {
+		t.Fatal(err)
+	}
+	if err := Recompress(src, parallel, Parallel(4)); err != nil {
+		t.Fatal(err)
+	}
+	s, _ := os.ReadFile(serial)
+	p, _ := os.ReadFile(parallel)
+	if len(p) > len(s)+len(s)/100 {
+		t.Errorf("parallel output is %d bytes, serial %d", len(p), len(s))
+	}
+	if !bytes.Equal(gunzip(t, p), gunzip(t, s)) {
+		t.Error("parallel output does not unpack to the same tarball as serial")
+	}
+	if pi, err := ScanPuzzle(parallel); err != nil || len(pi.Warnings) != 0 {
+		t.Errorf("ScanPuzzle of parallel output: %v, %v", err, pi.Warnings)
+	}
+}
@@ -0,0 +1,64 @@
+package palapuzzle
+
+import "math"
+
+// A PieceCountOption is one sensible choice of piece count for an image.
+type PieceCountOption struct {
+	// The piece count to ask the slicer for
+	Requested int
+	// The grid the slicer will make: Columns×Rows = Pieces pieces
+	Columns, Rows, Pieces int
+	// The approximate size of each piece in pixels, not counting tabs
+	PieceWidth, PieceHeight int
+}
+
+// The piece counts SuggestPieceCounts chooses from.
+var commonPieceCounts = []int{
+	12, 24, 48, 70, 100, 150, 200, 300, 400, 500, 750,
+	1000, 1500, 2000, 3000, 4000, 5000, 7500, 10000,
+}
+
+// MinPieceSize is the smallest width or height of a piece, in pixels, that
+// SuggestPieceCounts considers playable.
+const MinPieceSize = 24
+
+// SuggestPieceCounts returns the common piece counts that suit an image of
+// the given size, smallest first, with the grid each would produce. Like
+// Palapeli's slicers, it lays the pieces out in a grid whose aspect ratio
+// matches the image's, so that pieces are roughly square: there are about
+// sqrt(n×width/height) columns. Counts which would make pieces smaller than
+// MinPieceSize, or which give the same grid as a smaller count, are left out.
+func SuggestPieceCounts(imgW, imgH int) []PieceCountOption {
+	if imgW <= 0 || imgH <= 0 {
+		return nil
+	}
+	var ret []PieceCountOption
+	for _, n := range commonPieceCounts {
+		cols, rows := pieceGrid(n, imgW, imgH)
+		o := PieceCountOption{
+			Requested:   n,
+			Columns:     cols,
+			Rows:        rows,
+			Pieces:      cols * rows,
+			PieceWidth:  imgW / cols,
+			PieceHeight: imgH / rows,
+		}
+		if o.PieceWidth < MinPieceSize || o.PieceHeight < MinPieceSize {
+			break
+		}
+		if len(ret) > 0 && ret[len(ret)-1].Pieces == o.Pieces {
+			continue
+		}
+		ret = append(ret, o)
+	}
+	return ret
+}
+
+// pieceGrid returns the number of columns and rows of roughly square pieces
+// that come closest to n pieces for an image of the given size.
+func pieceGrid(n, imgW, imgH int) (cols, rows int) {
+	aspect := float64(imgW) / float64(imgH)
+	cols = int(math.Max(1, math.Round(math.Sqrt(float64(n)*aspect))))
+	rows = int(math.Max(1, math.Round(float64(n)/float64(cols))))
+	return cols, rows
+}
@@ -0,0 +1,136 @@
+package palapuzzle
+
+import (
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// A Plan describes what a function which modifies puzzles would do, as
+// worked out under the DryRun option.
+type Plan struct {
+	Files   []FileChange // The files that would be written or removed
+	Members []Difference // How their members would change
+	Keys    []KeyChange  // How the keys of pala.desktop would change
+}
+
+// A FileChange is a file that would be written.
+type FileChange struct {
+	Path   string
+	Action string // "create", "replace" or "remove"
+}
+
+// A KeyChange is a change to one key of pala.desktop. Old is "" for a key
+// that would be added, New is "" for one that would be removed.
+type KeyChange struct {
+	Group, Key string
+	Old, New   string
+}
+
+func (kc KeyChange) String() string {
+	switch {
+	case kc.Old == "":
+		return fmt.Sprintf("[%s] %s: add %q", kc.Group, kc.Key, kc.New)
+	case kc.New == "":
+		return fmt.Sprintf("[%s] %s: remove %q", kc.Group, kc.Key, kc.Old)
+	}
+	return fmt.Sprintf("[%s] %s: %q becomes %q", kc.Group, kc.Key, kc.Old, kc.New)
+}
+
+// DryRun makes functions which modify puzzles work out what they would do,
+// and describe it in *p (replacing anything already there), without
+// changing any file. Apart from that they behave as usual, returning the
+// same results and errors they would have.
+func DryRun(p *Plan) Option {
+	return func(o *options) { o.dryRun = p }
+}
+
+// planWrite does what writePuzzle would, but only fills in o.dryRun. The
+// new puzzle is summarized as it is made, so it is never held in memory.
+func planWrite(dst string, o *options, before func() ([]memberSummary, error), write puzzleWriter) error {
+	b, name, err := backendFor(dst)
+	if err != nil {
+		return &Error{"create", dst, err}
+	}
+	old, err := before()
+	if err != nil {
+		return err
+	}
+
+	pr, pw := io.Pipe()
+	type result struct {
+		after []memberSummary
+		err   error
+	}
+	done := make(chan result, 1)
+	go func() {
+		after, err := summarizeArchive(pr, dst)
+		if err == nil {
+			_, err = io.Copy(io.Discard, pr) // The gzip trailer
+		}
+		pr.CloseWithError(errors.Join(err, io.ErrClosedPipe))
+		done <- result{after, err}
+	}()
+	err = write(pw, gzip.NoCompression, &options{})
+	pw.CloseWithError(err)
+	res := <-done
+	if err != nil {
+		return err
+	}
+	if res.err != nil {
+		return res.err
+	}
+
+	action := "create"
+	if _, err := b.Stat(name); err == nil {
+		action = "replace"
+	}
+	bp, err := planBackup(b, name, o)
+	if err != nil {
+		return &Error{"back up", dst, err}
+	}
+	*o.dryRun = Plan{
+		Files:   []FileChange{{dst, action}},
+		Members: compareSummaries(old, res.after),
+		Keys:    diffDesktops(desktopOf(old), desktopOf(res.after)),
+	}
+	if bp != nil {
+		o.dryRun.Files = append(bp.changes(), o.dryRun.Files...)
+	}
+	return nil
+}
+
+// desktopOf returns the parsed pala.desktop among members, if any.
+func desktopOf(members []memberSummary) *desktopFile {
+	for _, ms := range members {
+		if ms.name == "pala.desktop" {
+			return parseDesktop(ms.desktop)
+		}
+	}
+	return &desktopFile{}
+}
+
+// diffDesktops lists the keys which differ between before and after.
+func diffDesktops(before, after *desktopFile) []KeyChange {
+	var ret []KeyChange
+	type gk struct{ group, key string }
+	seen := make(map[gk]bool)
+	for _, l := range before.lines {
+		if !l.isKey || seen[gk{l.group, l.key}] {
+			continue
+		}
+		seen[gk{l.group, l.key}] = true
+		if v, _ := after.get(l.group, l.key); v != l.value {
+			ret = append(ret, KeyChange{l.group, l.key, l.value, v})
+		}
+	}
+	for _, l := range after.lines {
+		if !l.isKey || seen[gk{l.group, l.key}] {
+			continue
+		}
+		seen[gk{l.group, l.key}] = true
+		ret = append(ret, KeyChange{l.group, l.key, "", l.value})
+	}
+	return ret
+}
@@ -0,0 +1,216 @@
+package palapuzzle
+
+import (
+	"archive/tar"
+	"context"
+	"image"
+	"image/jpeg"
+	"image/png"
+	"io"
+	"io/fs"
+	"strconv"
+)
+
+// A Puzzle is a .puzzle file opened for reading parts of it, such as a
+// single piece, without unpacking the rest. What it reads is read when it
+// is first asked for, and kept until Close: one pass over the archive
+// gives both Info and Members, and the image is decoded only once. A
+// Puzzle is not safe for concurrent use.
+//
+// The first pass also notes where in the archive each member's content is.
+// After it, a member of an uncompressed tarball is read straight from where
+// it is, if the Backend's files are io.ReaderAts (as Local's are); one of a
+// compressed puzzle is still decompressed from the start, but without
+// walking the tar headers along the way.
+type Puzzle struct {
+	b    Backend
+	name string // The file's name in b
+	fs   string // How the caller named it, for errors
+
+	info    *PuzzleInfo           // From the first pass, if made
+	members []MemberInfo          // Likewise
+	image   image.Image           // The decoded image.jpg, once read
+	index   map[string]memberSpan // Where the first pass found members' content
+	closed  bool
+}
+
+// OpenPuzzle opens the puzzle at path (or URL, as for ScanPuzzle).
+func OpenPuzzle(path string) (*Puzzle, error) {
+	b, name, err := backendFor(path)
+	if err != nil {
+		return nil, &Error{"open", path, err}
+	}
+	if _, err := b.Stat(name); err != nil {
+		return nil, &Error{"open", path, err}
+	}
+	return &Puzzle{b: b, name: name, fs: path}, nil
+}
+
+// OpenPiece returns a reader for the PNG data of piece n (the member n.png)
+// alone. Unless the first pass has found it in an uncompressed tarball, the
+// archive is read from its start up to that member, which is as far as gzip
+// allows, but nothing is unpacked or kept along the way. If
+// there is no such piece, the error satisfies errors.Is(err,
+// fs.ErrNotExist).
+func (p *Puzzle) OpenPiece(n int) (io.ReadCloser, error) {
+	return p.openMember(strconv.Itoa(n) + ".png")
+}
+
+// Info returns what ScanPuzzle would.
+func (p *Puzzle) Info() (*PuzzleInfo, error) {
+	if err := p.scan(); err != nil {
+		return nil, err
+	}
+	return p.info, nil
+}
+
+// Members returns what ListMembers would.
+func (p *Puzzle) Members() ([]MemberInfo, error) {
+	if err := p.scan(); err != nil {
+		return nil, err
+	}
+	return p.members, nil
+}
+
+// scan makes the first pass over p, if it has not been made.
+func (p *Puzzle) scan() error {
+	if p.closed {
+		return &Error{"read", p.fs, fs.ErrClosed}
+	}
+	if p.info != nil {
+		return nil
+	}
+	var members []MemberInfo
+	index := make(map[string]memberSpan)
+	var offset int64
+	o := &options{
+		visit: func(hdr *tar.Header, r io.Reader) error {
+			members = append(members, MemberInfo{hdr.Name, hdr.Size, hdr.ModTime, hdr.Typeflag})
+			if _, ok := index[hdr.Name]; !ok {
+				index[hdr.Name] = memberSpan{offset, hdr.Size}
+			}
+			return nil
+		},
+		index: func(name string, off int64) { offset = off },
+	}
+	info, err := scanBackend(context.Background(), p.b, p.name, o)
+	if err != nil {
+		return err
+	}
+	if decompressor(info.Compression) == nil {
+		index = nil // Offsets are only known in the built-in formats
+	}
+	p.info, p.members, p.index = info, members, index
+	return nil
+}
+
+// Image returns the puzzle's picture, decoded from its image.jpg.
+func (p *Puzzle) Image() (image.Image, error) {
+	if p.image != nil {
+		return p.image, nil
+	}
+	r, err := p.openMember("image.jpg")
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+	img, err := jpeg.Decode(r)
+	if err != nil {
+		return nil, &Error{"decode member image.jpg of", p.fs, err}
+	}
+	p.image = img
+	return img, nil
+}
+
+// Piece returns piece n, decoded from its PNG data. Pieces are not kept, as
+// there can be thousands of them; see also OpenPiece.
+func (p *Puzzle) Piece(n int) (image.Image, error) {
+	r, err := p.OpenPiece(n)
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+	img, err := png.Decode(r)
+	if err != nil {
+		return nil, &Error{"decode member " + strconv.Itoa(n) + ".png of", p.fs, err}
+	}
+	return img, nil
+}
+
+// Close releases what p has kept. Readers from OpenPiece are unaffected, but
+// p's methods fail from then on.
+func (p *Puzzle) Close() error {
+	p.closed = true
+	p.info, p.members, p.image, p.index = nil, nil, nil, nil
+	return nil
+}
+
+// openMember returns a reader for the first member of p with the given
+// name.
+func (p *Puzzle) openMember(member string) (io.ReadCloser, error) {
+	if p.closed {
+		return nil, &Error{"read", p.fs, fs.ErrClosed}
+	}
+	f, err := p.b.Open(p.name)
+	if err != nil {
+		return nil, &Error{"open", p.fs, err}
+	}
+	if span, ok := p.index[member]; ok {
+		r, err := span.open(f, p.info.Compression)
+		if err != nil {
+			f.Close()
+			return nil, &Error{"read member " + member + " of", p.fs, err}
+		}
+		return memberReader{r, f}, nil
+	}
+	a, _, err := openArchive(f)
+	if err != nil {
+		f.Close()
+		return nil, &Error{"open archive", p.fs, err}
+	}
+	for {
+		hdr, err := a.Next()
+		if err == io.EOF {
+			f.Close()
+			return nil, &Error{"find member " + member + " in", p.fs, fs.ErrNotExist}
+		}
+		if err != nil {
+			f.Close()
+			return nil, &Error{"read archive", p.fs, err}
+		}
+		if hdr.Name == member {
+			return memberReader{a, f}, nil
+		}
+	}
+}
+
+// A memberReader reads one member of an archive, and closes the file it is
+// in.
+type memberReader struct {
+	io.Reader
+	io.Closer
+}
+
+// A memberSpan is where a member's content is in an archive's tar stream.
+type memberSpan struct {
+	offset, size int64
+}
+
+// open returns a reader for the content at s in f, an archive in the named
+// built-in format.
+func (s memberSpan) open(f io.Reader, format string) (io.Reader, error) {
+	if ra, ok := f.(io.ReaderAt); ok && format == "tar" {
+		return io.NewSectionReader(ra, s.offset, s.size), nil
+	}
+	d, err := decompressor(format)(f)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := io.CopyN(io.Discard, d, s.offset); err != nil {
+		if err == io.EOF {
+			err = io.ErrUnexpectedEOF
+		}
+		return nil, err
+	}
+	return io.LimitReader(d, s.size), nil
+}
@@ -0,0 +1,178 @@
+package palapuzzle
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"image"
+	"io"
+	"strconv"
+	"time"
+)
+
+// Metadata is what a PuzzleWriter records about a puzzle in its
+// pala.desktop.
+type Metadata struct {
+	Title   string
+	Author  string
+	Comment string
+	AltText string // See SetAltText
+}
+
+// A PuzzleWriter writes a puzzle, as a gzipped tarball in the layout of
+// FormatModern, to an io.Writer, member by member as they are added: for
+// programs which make puzzles as they go, where WritePuzzle wants them to
+// say up front how many pieces there are. The image and pieces are written
+// as they are added, and pala.desktop by Close, once the pieces' offsets
+// are all known. Each member is held in memory while it is written, as a
+// tarball needs its size first.
+//
+// Once a method has failed, the rest fail with the same error, and after
+// Close they all fail.
+type PuzzleWriter struct {
+	zw      io.WriteCloser
+	tw      *tar.Writer
+	tmpl    *tar.Header // For every member
+	meta    Metadata
+	image   bool                // Whether AddImage has been called
+	strip   bool                // Whether to strip its metadata
+	offsets map[int]image.Point // The pieces added, by number
+	buf     bytes.Buffer        // Reused for every member
+	err     error
+}
+
+// NewWriter returns a PuzzleWriter which writes to w. Of the writing
+// options (see Option), CompressionLevel, Compression, Parallel and
+// Reproducible are heeded, and StripEXIF too; the others are about files,
+// which w need not be. Under Reproducible, the members' headers are
+// canonical, but they are still written in the order they are added, with
+// pala.desktop last, so that the same puzzle written the same way gives the
+// same bytes. The caller must call Close, which does not close w.
+func NewWriter(w io.Writer, opts ...Option) *PuzzleWriter {
+	o := getOptions(opts)
+	level := gzip.DefaultCompression
+	if o.level != 0 {
+		level = o.level
+	}
+	pw := &PuzzleWriter{
+		tmpl:    &tar.Header{Typeflag: tar.TypeReg, Mode: 0644, ModTime: time.Now()},
+		offsets: make(map[int]image.Point),
+		strip:   o.stripEXIF,
+	}
+	if o.reproducible {
+		pw.tmpl.ModTime = canonicalTime
+	}
+	pw.zw, pw.err = newGzipWriter(w, level, o)
+	if pw.err == nil {
+		pw.tw = tar.NewWriter(pw.zw)
+	}
+	return pw
+}
+
+// errWriterClosed is the error from a PuzzleWriter's methods after Close.
+var errWriterClosed = errors.New("palapuzzle: PuzzleWriter is closed")
+
+// SetMetadata sets the title, author and so on which Close writes in
+// pala.desktop. It can be called at any time before Close; the last call
+// wins.
+func (pw *PuzzleWriter) SetMetadata(m Metadata) error {
+	if pw.err != nil {
+		return pw.err
+	}
+	pw.meta = m
+	return nil
+}
+
+// AddImage adds the puzzle's image.jpg, with the content read from r. A
+// puzzle has at most one; without one, it has no preview (see SlimPuzzle).
+func (pw *PuzzleWriter) AddImage(r io.Reader) error {
+	if pw.err != nil {
+		return pw.err
+	}
+	if pw.image {
+		pw.err = errors.New("palapuzzle: the puzzle already has an image.jpg")
+		return pw.err
+	}
+	pw.image = true
+	if pw.strip {
+		return pw.add("image.jpg", r, stripEXIF)
+	}
+	return pw.add("image.jpg", r, nil)
+}
+
+// AddPiece adds piece n: the member n.png, with the PNG data read from r,
+// whose top-left corner goes at offset in the solved puzzle. Pieces may be
+// added in any order, but each only once, and by Close they must be
+// numbered from 0 with none missing.
+func (pw *PuzzleWriter) AddPiece(n int, r io.Reader, offset image.Point) error {
+	if pw.err != nil {
+		return pw.err
+	}
+	if n < 0 {
+		pw.err = fmt.Errorf("palapuzzle: no piece can be numbered %d", n)
+		return pw.err
+	}
+	if _, ok := pw.offsets[n]; ok {
+		pw.err = fmt.Errorf("palapuzzle: piece %d is already added", n)
+		return pw.err
+	}
+	pw.offsets[n] = offset
+	return pw.add(strconv.Itoa(n)+".png", r, nil)
+}
+
+// add writes a member with the given name and the content read from r,
+// passed through edit if it is not nil.
+func (pw *PuzzleWriter) add(name string, r io.Reader, edit func([]byte) []byte) error {
+	pw.buf.Reset()
+	if _, err := pw.buf.ReadFrom(r); err != nil {
+		pw.err = fmt.Errorf("palapuzzle: cannot read member %s: %w", name, err)
+		return pw.err
+	}
+	data := pw.buf.Bytes()
+	if edit != nil {
+		data = edit(data)
+	}
+	if err := writeMember(pw.tw, name, data, pw.tmpl); err != nil {
+		pw.err = fmt.Errorf("palapuzzle: cannot write member %s: %w", name, err)
+	}
+	return pw.err
+}
+
+// Close writes pala.desktop, and finishes off the puzzle. It fails if no
+// pieces have been added, or some are missing.
+func (pw *PuzzleWriter) Close() error {
+	if pw.err == errWriterClosed {
+		return nil
+	}
+	if pw.err == nil {
+		pw.err = pw.finish()
+	}
+	if pw.zw != nil {
+		if err := pw.zw.Close(); pw.err == nil && err != nil {
+			pw.err = err
+		}
+	}
+	err := pw.err
+	pw.err = errWriterClosed
+	return err
+}
+
+// finish does the work of Close, up to closing the gzip writer.
+func (pw *PuzzleWriter) finish() error {
+	if len(pw.offsets) == 0 {
+		return errors.New("palapuzzle: a puzzle needs pieces")
+	}
+	offsets := make([]image.Point, len(pw.offsets))
+	for n, off := range pw.offsets {
+		if n >= len(offsets) {
+			return fmt.Errorf("palapuzzle: there is a piece %d, but only %d pieces", n, len(offsets))
+		}
+		offsets[n] = off
+	}
+	if err := writeMember(pw.tw, "pala.desktop", newDesktop(pw.meta, offsets), pw.tmpl); err != nil {
+		return err
+	}
+	return pw.tw.Close()
+}
@@ -0,0 +1,124 @@
+package palapuzzle
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"io"
+	"sort"
+	"strconv"
+)
+
+// A RepairReport says what Repair changed.
+type RepairReport struct {
+	// The pieces given new numbers, from their old numbers to their new
+	Renumbered map[int]int
+	// The numbers of pieces of which there was more than one N.png; all but
+	// the first were dropped
+	Dropped []int
+	// What PieceCount was, zero if there was none, and what it is now
+	OldPieceCount, NewPieceCount int
+}
+
+// Changed reports whether Repair changed anything.
+func (r *RepairReport) Changed() bool {
+	return len(r.Renumbered) > 0 || len(r.Dropped) > 0 || r.OldPieceCount != r.NewPieceCount
+}
+
+// Repair writes a copy of the puzzle src to dst with its pieces numbered
+// from 0 with no gaps and no duplicates, as Palapeli needs them: pieces
+// keep their order, but are renumbered to close any gaps, and only the
+// first N.png of each number is kept. Their offsets in pala.desktop are
+// renumbered with them (offsets for pieces which are not there are
+// removed), and PieceCount is set to how many pieces there are. So pieces
+// 0, 1, 3, 3 and 4 become 0 to 3. Every other member is copied unchanged.
+//
+// Src and dst may be the same file, in which case it is only rewritten if
+// anything needs changing. Repair heeds the writing options (see Option).
+func Repair(src, dst string, opts ...Option) (*RepairReport, error) {
+	pi, err := ScanPuzzle(src)
+	if err != nil {
+		return nil, err
+	}
+	if pi.desktop == nil {
+		return nil, &Error{"find member pala.desktop in", src, nil}
+	}
+	nums := make([]int, 0, len(pi.PieceSizes))
+	for n := range pi.PieceSizes {
+		nums = append(nums, n)
+	}
+	sort.Ints(nums)
+	r := &RepairReport{
+		Renumbered:    make(map[int]int),
+		OldPieceCount: pi.NPiecesDecl,
+		NewPieceCount: len(nums),
+	}
+	renumber := make(map[int]int, len(nums)) // For every piece
+	for i, n := range nums {
+		renumber[n] = i
+		if i != n {
+			r.Renumbered[n] = i
+		}
+	}
+	for _, w := range pi.WarningsOf(WarnDuplicatePiece) {
+		if n, err := strconv.Atoi(w.Params["piece"]); err == nil {
+			r.Dropped = append(r.Dropped, n)
+		}
+	}
+	if !r.Changed() && src == dst {
+		return r, nil
+	}
+
+	d := pi.desktop
+	d.renumberOffsets(renumber)
+	if ks, ok := pi.Sources["NPiecesDecl"]; ok {
+		d.set(ks.Group, ks.Key, strconv.Itoa(len(nums)))
+	} else {
+		d.set(slicerGroup, "PieceCount", strconv.Itoa(len(nums)))
+	}
+	seen := make(map[int]bool)
+	err = rewritePuzzle(src, dst, gzip.DefaultCompression, getOptions(opts),
+		rewriteDesktop(d, func(hdr *tar.Header, rd io.Reader, tw *tar.Writer) error {
+			m := rePieceName.FindStringSubmatch(hdr.Name)
+			if m == nil {
+				return copyMember(hdr, rd, tw)
+			}
+			n, err := strconv.Atoi(m[1])
+			if _, ok := renumber[n]; err != nil || !ok {
+				return copyMember(hdr, rd, tw) // Too big a number to be a piece
+			}
+			if seen[n] {
+				return nil
+			}
+			seen[n] = true
+			if renumber[n] == n {
+				return copyMember(hdr, rd, tw)
+			}
+			h := resizedHeader(hdr, hdr.Size)
+			h.Name = strconv.Itoa(renumber[n]) + ".png"
+			return copyMember(h, rd, tw)
+		}))
+	if err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// renumberOffsets renumbers the pieces' offsets in d, by renumber; those of
+// pieces not in it are removed.
+func (d *desktopFile) renumberOffsets(renumber map[int]int) {
+	kept := d.lines[:0]
+	for _, l := range d.lines {
+		if n, err := strconv.Atoi(l.key); err == nil && l.isKey && l.group == offsetsGroup {
+			to, ok := renumber[n]
+			if !ok {
+				continue
+			}
+			if to != n {
+				l.key = strconv.Itoa(to)
+				l.text = d.eol(l.key + "=" + l.value)
+			}
+		}
+		kept = append(kept, l)
+	}
+	d.lines = kept
+}
@@ -0,0 +1,118 @@
+package palapuzzle
+
+import (
+	"bytes"
+	"image"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"testing"
+
+	"github.com/c12h/palapuzzle/palapuzzletest"
+)
+
+func TestRepair(t *testing.T) {
+	// Five pieces in a row, 32 pixels wide
+	spec := palapuzzletest.Spec{Cols: 5, Rows: 1}
+	for _, tc := range []struct {
+		name    string
+		variant palapuzzletest.Variant
+		drop    string // A piece to leave out
+		inPlace bool
+		want    map[int]int // Renumbered
+		from    []int       // The old number of each piece kept
+	}{
+		// The example from the doc: 0, 1, 3, 3 and 4 become 0 to 3
+		{"doc", palapuzzletest.Valid, "2.png", false, map[int]int{3: 2, 4: 3}, []int{0, 1, 3, 4}},
+		{"doc in place", palapuzzletest.Valid, "2.png", true, map[int]int{3: 2, 4: 3}, []int{0, 1, 3, 4}},
+		// 0, 2, 3, 3 and 4
+		{"MissingPiece in place", palapuzzletest.MissingPiece, "", true, map[int]int{2: 1, 3: 2, 4: 3}, []int{0, 2, 3, 4}},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			spec.Variant = tc.variant
+			var ms []testMember
+			old := make(map[string]string) // Pieces' content, by name
+			for _, m := range readMembers(t, palapuzzletest.File(t, spec)) {
+				if m.Name == tc.drop {
+					continue
+				}
+				ms = append(ms, m)
+				old[m.Name] = m.Body
+				if m.Name == "3.png" {
+					ms = append(ms, testMember{Name: "3.png", Body: "a second 3.png"})
+				}
+			}
+			src := writeTestPuzzle(t, ms)
+			dst := filepath.Join(t.TempDir(), "repaired.puzzle")
+			if tc.inPlace {
+				dst = src
+			}
+
+			r, err := Repair(src, dst)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(r.Renumbered, tc.want) {
+				t.Errorf("Renumbered = %v, want %v", r.Renumbered, tc.want)
+			}
+			if !reflect.DeepEqual(r.Dropped, []int{3}) {
+				t.Errorf("Dropped = %v, want [3]", r.Dropped)
+			}
+			if r.OldPieceCount != 5 || r.NewPieceCount != 4 {
+				t.Errorf("PieceCount %d => %d, want 5 => 4", r.OldPieceCount, r.NewPieceCount)
+			}
+
+			pi, err := ScanPuzzle(dst)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(pi.Warnings) != 0 {
+				t.Errorf("repaired puzzle has warnings %v", pi.Warnings)
+			}
+			if pi.NPieceFiles != 4 || pi.NPiecesDecl != 4 {
+				t.Errorf("repaired puzzle has %d pieces, PieceCount %d; want 4 and 4", pi.NPieceFiles, pi.NPiecesDecl)
+			}
+			offsets := pi.desktop.pieceOffsets()
+			if len(offsets) != 4 {
+				t.Errorf("repaired puzzle has offsets %v, want 4", offsets)
+			}
+			var pieces []string
+			for _, m := range readMembers(t, dst) {
+				if rePieceName.MatchString(m.Name) {
+					pieces = append(pieces, m.Name)
+				}
+			}
+			if want := []string{"0.png", "1.png", "2.png", "3.png"}; !reflect.DeepEqual(pieces, want) {
+				t.Errorf("repaired puzzle has pieces %v, want %v", pieces, want)
+			}
+			got := make(map[string]string)
+			for _, m := range readMembers(t, dst) {
+				got[m.Name] = m.Body
+			}
+			for i, n := range tc.from {
+				name, oldName := strconv.Itoa(i)+".png", strconv.Itoa(n)+".png"
+				if got[name] != old[oldName] {
+					t.Errorf("%s is not the first %s", name, oldName)
+				}
+				// Each piece is 32 pixels right of the one numbered before
+				if want := image.Pt(32*n, 0); offsets[i] != want {
+					t.Errorf("%s has offset %v, want %v", name, offsets[i], want)
+				}
+			}
+
+			// Nothing is left to repair, so it is not rewritten again
+			before, _ := os.ReadFile(dst)
+			r, err = Repair(dst, dst)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if r.Changed() {
+				t.Errorf("second Repair reports %+v", r)
+			}
+			if after, _ := os.ReadFile(dst); !bytes.Equal(before, after) {
+				t.Error("second Repair rewrote the puzzle")
+			}
+		})
+	}
+}
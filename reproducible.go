@@ -0,0 +1,139 @@
+package palapuzzle
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"io"
+	"sort"
+	"strconv"
+	"time"
+)
+
+// canonicalTime is the modification time of every member of a puzzle
+// written under the Reproducible option; scanning takes it to mean none.
+var canonicalTime = time.Unix(0, 0)
+
+// A heldMember is a member of a puzzle held in memory.
+type heldMember struct {
+	hdr  *tar.Header
+	data []byte
+}
+
+// reproducibly returns a puzzleWriter which writes what write does, but
+// reproducibly, as the Reproducible option describes: it has write write the
+// puzzle to memory, barely compressed, and then writes the members from
+// there in canonical order, with canonical headers. Dst is only used in
+// error messages.
+func reproducibly(dst string, write puzzleWriter) puzzleWriter {
+	return func(out io.Writer, level int, o *options) error {
+		var raw bytes.Buffer
+		if err := write(&raw, gzip.NoCompression, &options{}); err != nil {
+			return err
+		}
+		members, err := holdMembers(&raw)
+		if err != nil {
+			return &Error{"write", dst, err}
+		}
+		sort.SliceStable(members, func(i, j int) bool {
+			return canonicalLess(members[i].hdr.Name, members[j].hdr.Name)
+		})
+
+		zw, err := newGzipWriter(out, level, o)
+		if err != nil {
+			return &Error{"create", dst, err}
+		}
+		if gw, ok := zw.(*gzip.Writer); ok {
+			gw.Header = gzip.Header{OS: 255} // As parallelGzipWriter writes it
+		}
+		tw := tar.NewWriter(zw)
+		for _, m := range members {
+			if err := writeMember(tw, m.hdr.Name, m.data, canonicalHeader(m.hdr)); err != nil {
+				zw.Close() // Stop any goroutines; output is discarded anyway
+				return &Error{"write member " + m.hdr.Name + " of", dst, err}
+			}
+		}
+		if err := tw.Close(); err != nil {
+			zw.Close()
+			return &Error{"write", dst, err}
+		}
+		if err := zw.Close(); err != nil {
+			return &Error{"write", dst, err}
+		}
+		return nil
+	}
+}
+
+// holdMembers reads every member of the gzipped tarball in r into memory.
+func holdMembers(r io.Reader) ([]heldMember, error) {
+	zr, err := gzip.NewReader(r)
+	if err != nil {
+		return nil, err
+	}
+	tr := tar.NewReader(zr)
+	var ret []heldMember
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			return ret, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		data, err := io.ReadAll(tr)
+		if err != nil {
+			return nil, err
+		}
+		ret = append(ret, heldMember{hdr, data})
+	}
+}
+
+// canonicalRank says where members go in a reproducible puzzle: SIGNATURE
+// and CHECKSUMS first, where scanning looks for them, then pala.desktop,
+// image.jpg, the pieces by number and everything else by name. Piece
+// returns the piece number of a piece, and is otherwise zero.
+func canonicalRank(name string) (rank, piece int) {
+	switch name {
+	case signatureMember:
+		return 0, 0
+	case checksumsMember:
+		return 1, 0
+	case "pala.desktop":
+		return 2, 0
+	case "image.jpg":
+		return 3, 0
+	}
+	if m := rePieceName.FindStringSubmatch(name); m != nil {
+		if n, err := strconv.Atoi(m[1]); err == nil {
+			return 4, n
+		}
+	}
+	return 5, 0
+}
+
+// canonicalLess reports whether the member named a goes before the one named
+// b in a reproducible puzzle.
+func canonicalLess(a, b string) bool {
+	ra, pa := canonicalRank(a)
+	rb, pb := canonicalRank(b)
+	if ra != rb {
+		return ra < rb
+	}
+	if pa != pb {
+		return pa < pb
+	}
+	return a < b
+}
+
+// canonicalHeader returns a header for a member like the one hdr describes,
+// with nothing in it which depends on who wrote the puzzle, or when: only
+// its name, type, permissions and (for links) target are kept.
+func canonicalHeader(hdr *tar.Header) *tar.Header {
+	return &tar.Header{
+		Typeflag: hdr.Typeflag,
+		Name:     hdr.Name,
+		Linkname: hdr.Linkname,
+		Mode:     hdr.Mode & 0777,
+		ModTime:  canonicalTime,
+	}
+}
@@ -0,0 +1,187 @@
+package palapuzzle
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"io"
+)
+
+// Recompress rewrites the puzzle src to dst as a gzipped tarball compressed
+// as hard as the compress/flate package can manage. Every member is copied
+// unchanged. Src and dst may be the same file; dst is only replaced once the
+// new copy has been completely written.
+//
+// This is intended for archival copies: it is slow, but puzzles made with a
+// low compression level usually shrink by a few percent without any loss.
+// The Parallel option makes it much faster on multi-core machines. Recompress
+// heeds all the writing options (see Option).
+func Recompress(src, dst string, opts ...Option) error {
+	return rewritePuzzle(src, dst, gzip.BestCompression, getOptions(opts), copyMember)
+}
+
+// Repack rewrites the puzzle src to dst as a gzipped tarball, like
+// Recompress, but at the level which the CompressionLevel option gives, or
+// gzip.BestCompression without it. Many puzzles in the wild were packed at
+// level 1, and shrink by a fifth or more when repacked; a lower level is for
+// repacking a whole collection quickly. The ShrinkImage option makes Repack
+// shrink image.jpg too, and StripEXIF strip its metadata. Repack heeds all
+// the writing options (see Option).
+func Repack(src, dst string, opts ...Option) error {
+	o := getOptions(opts)
+	level := gzip.BestCompression
+	if o.level != 0 {
+		level = o.level
+	}
+	edit := copyMember
+	if o.shrinkImage || o.stripEXIF {
+		edit = func(hdr *tar.Header, r io.Reader, tw *tar.Writer) error {
+			if hdr.Name != "image.jpg" {
+				return copyMember(hdr, r, tw)
+			}
+			jpg, err := io.ReadAll(r)
+			if err != nil {
+				return err
+			}
+			if o.shrinkImage {
+				jpg = shrinkJPEG(jpg, o.imageSize, o.imageQuality)
+			}
+			if o.stripEXIF {
+				jpg = stripEXIF(jpg)
+			}
+			return writeMember(tw, hdr.Name, jpg, hdr)
+		}
+	}
+	return rewritePuzzle(src, dst, level, o, edit)
+}
+
+// A memberEditor is called by rewritePuzzle for each member of the source
+// puzzle that this package recognises (see isKnownMember), with the member's
+// header and content. It writes whatever should replace the member (often
+// the member itself) to tw.
+type memberEditor func(hdr *tar.Header, r io.Reader, tw *tar.Writer) error
+
+// copyMember is the memberEditor which keeps every member as it is.
+func copyMember(hdr *tar.Header, r io.Reader, tw *tar.Writer) error {
+	if err := tw.WriteHeader(hdr); err != nil {
+		return err
+	}
+	_, err := io.Copy(tw, r)
+	return err
+}
+
+// isKnownMember reports whether name is one of the members of a puzzle that
+// this package understands: the manifest, the image or a piece.
+func isKnownMember(name string) bool {
+	return name == "pala.desktop" || name == "image.jpg" || rePieceName.MatchString(name)
+}
+
+// rewritePuzzle reads the puzzle src and writes a gzipped tarball, compressed
+// at the given level (and perhaps in parallel, per o), to dst, passing each
+// member of src that isKnownMember through edit.
+//
+// Every other member (such as an attribution file added by hand) is copied
+// byte for byte, header and all, in its original position. Editors never see
+// such members, so no rewriting operation can drop or alter them.
+//
+// Under the DryRun option, nothing is written; the plan is filled in instead.
+// Under Backup, dst is backed up before it is replaced. Under InTransaction,
+// it is only replaced when the Transaction is committed.
+func rewritePuzzle(src, dst string, level int, o *options, edit memberEditor) error {
+	return writePuzzle(dst, level, o,
+		func() ([]memberSummary, error) { return summarize(src) },
+		func(out io.Writer, level int, o *options) error {
+			return rewriteTo(out, src, dst, level, o, edit)
+		})
+}
+
+// rewriteDesktop returns the memberEditor which writes d in place of
+// pala.desktop and passes every other member to edit, or keeps it as it is
+// if edit is nil.
+func rewriteDesktop(d *desktopFile, edit memberEditor) memberEditor {
+	if edit == nil {
+		edit = copyMember
+	}
+	return func(hdr *tar.Header, r io.Reader, tw *tar.Writer) error {
+		if hdr.Name == "pala.desktop" {
+			return writeMember(tw, hdr.Name, d.bytes(), hdr)
+		}
+		return edit(hdr, r, tw)
+	}
+}
+
+// A puzzleWriter writes a whole new puzzle to out as a gzipped tarball,
+// compressed at level (in parallel, if o says so).
+type puzzleWriter func(out io.Writer, level int, o *options) error
+
+// writePuzzle does the work of rewritePuzzle, and of anything else which
+// writes a puzzle to dst, heeding the writing options in o. Before returns
+// what a dry run compares the new puzzle with.
+func writePuzzle(dst string, level int, o *options, before func() ([]memberSummary, error), write puzzleWriter) error {
+	if o.reproducible {
+		write = reproducibly(dst, write)
+	}
+	if o.dryRun != nil {
+		return planWrite(dst, o, before, write)
+	}
+	if level == gzip.DefaultCompression && o.level != 0 {
+		level = o.level
+	}
+	if o.tx != nil {
+		if err := o.tx.check(dst); err != nil {
+			return &Error{"write", dst, err}
+		}
+	}
+	b, name, err := backendFor(dst)
+	if err != nil {
+		return &Error{"create", dst, err}
+	}
+	out, err := b.Write(name)
+	if err != nil {
+		return &Error{"create", dst, err}
+	}
+	if err := write(out, level, o); err != nil {
+		abort(out)
+		return err
+	}
+	bp, err := planBackup(b, name, o)
+	if err == nil && bp != nil {
+		err = bp.run()
+	}
+	if err != nil {
+		abort(out)
+		return &Error{"back up", dst, err}
+	}
+	return finishWrite(out, dst, o)
+}
+
+// rewriteTo does the work of rewritePuzzle, writing to out; dst is only used
+// in error messages.
+func rewriteTo(out io.Writer, src, dst string, level int, o *options, edit memberEditor) error {
+	zw, err := newGzipWriter(out, level, o)
+	if err != nil {
+		return &Error{"create", dst, err}
+	}
+	tw := tar.NewWriter(zw)
+	err = walkPuzzle(src, func(hdr *tar.Header, r io.Reader) error {
+		e := edit
+		if !isKnownMember(hdr.Name) {
+			e = copyMember
+		}
+		if err := e(hdr, r, tw); err != nil {
+			return &Error{"rewrite member " + hdr.Name + " of", src, err}
+		}
+		return nil
+	})
+	if err != nil {
+		zw.Close() // Stop any goroutines; output is discarded anyway
+		return err
+	}
+	if err := tw.Close(); err != nil {
+		zw.Close()
+		return &Error{"write", dst, err}
+	}
+	if err := zw.Close(); err != nil {
+		return &Error{"write", dst, err}
+	}
+	return nil
+}
@@ -0,0 +1,113 @@
+package palapuzzle
+
+import (
+	"crypto/ed25519"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+// unknownMembers are members of a puzzle which this package does not
+// recognise, which every rewrite must keep as they are.
+var unknownMembers = []testMember{
+	{Name: "ATTRIBUTION.txt", Body: "Photo by someone, CC-BY 4.0\r\n", Mode: 0600,
+		ModTime: time.Date(2019, 3, 4, 5, 6, 7, 0, time.UTC)},
+	{Name: "extras/notes.bin", Body: "\x00\xff\x1f\x8b binary\n",
+		ModTime: time.Date(2021, 1, 2, 3, 4, 5, 0, time.UTC)},
+}
+
+func TestRewritesKeepUnknownMembers(t *testing.T) {
+	_, key, _ := ed25519.GenerateKey(nil)
+	// Each rewrites src to dst, which (for those working in place) starts
+	// as a copy of it.
+	for _, c := range []struct {
+		name    string
+		rewrite func(src, dst string) error
+	}{
+		{"Recompress", func(src, dst string) error { return Recompress(src, dst) }},
+		{"Repack", func(src, dst string) error { return Repack(src, dst, StripEXIF(), ShrinkImage(16, 80)) }},
+		{"Repair", func(src, dst string) error { _, err := Repair(src, dst); return err }},
+		{"ExportLegacy", func(src, dst string) error { return ExportLegacy(src, dst) }},
+		{"UpgradePuzzle", func(src, dst string) error {
+			if err := ExportLegacy(src, dst); err != nil {
+				return err
+			}
+			_, err := UpgradePuzzle(dst)
+			return err
+		}},
+		{"UpdateMember", func(_, dst string) error { return UpdateMember(dst, "0.png", strings.NewReader("new")) }},
+		{"WriteChecksums", func(_, dst string) error { return WriteChecksums(dst) }},
+		{"Sign", func(_, dst string) error { return Sign(dst, key) }},
+		{"SetAltText", func(_, dst string) error { return SetAltText(dst, "A grid of colours") }},
+		{"OptimizePieces", func(_, dst string) error { _, err := OptimizePieces(dst); return err }},
+		{"SlimPuzzle", func(_, dst string) error { return SlimPuzzle(dst) }},
+		{"UnslimPuzzle", func(_, dst string) error {
+			if err := SlimPuzzle(dst); err != nil {
+				return err
+			}
+			return UnslimPuzzle(dst)
+		}},
+		{"Recompress in parallel", func(src, dst string) error { return Recompress(src, dst, Parallel(2)) }},
+	} {
+		t.Run(c.name, func(t *testing.T) {
+			src := testPuzzle(t, unknownMembers...)
+			dst := filepath.Join(t.TempDir(), "out.puzzle")
+			data, err := os.ReadFile(src)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := os.WriteFile(dst, data, 0644); err != nil {
+				t.Fatal(err)
+			}
+			if err := c.rewrite(src, dst); err != nil {
+				t.Fatal(err)
+			}
+			checkUnknownMembers(t, dst)
+		})
+	}
+}
+
+func TestMergeSplitKeepUnknownMembers(t *testing.T) {
+	src := testPuzzle(t, unknownMembers...)
+	dst := filepath.Join(t.TempDir(), "merged.puzzle")
+	if err := MergePuzzles(dst, src, testPuzzle(t), SideBySide); err != nil {
+		t.Fatal(err)
+	}
+	checkUnknownMembers(t, dst)
+	parts, err := SplitPuzzle(src, 2, SplitColumns)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, p := range parts {
+		checkUnknownMembers(t, p)
+	}
+}
+
+// checkUnknownMembers checks that the puzzle at path has unknownMembers,
+// exactly as they were, in their original order.
+func checkUnknownMembers(t *testing.T, path string) {
+	t.Helper()
+	var got []testMember
+	for _, m := range readMembers(t, path) {
+		if !isKnownMember(m.Name) && m.Name != checksumsMember && m.Name != signatureMember {
+			got = append(got, m)
+		}
+	}
+	if len(got) != len(unknownMembers) {
+		t.Fatalf("unknown members are %+v, want %+v", got, unknownMembers)
+	}
+	for i, want := range unknownMembers {
+		want.Type = '0'
+		if want.Mode == 0 {
+			want.Mode = 0644
+		}
+		g := got[i]
+		g.ModTime = g.ModTime.UTC()
+		if !reflect.DeepEqual(g, want) {
+			t.Errorf("member %d is %+v, want %+v", i, g, want)
+		}
+	}
+}
@@ -0,0 +1,214 @@
+package palapuzzle
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"crypto/sha256"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+)
+
+// A Difference is a discrepancy found by RoundTripCheck.
+type Difference struct {
+	Member string // The member concerned, or "" for the archive as a whole
+	What   string // What differs, like "size" or "content"
+	Before string // The original value
+	After  string // The value after rewriting
+}
+
+func (d Difference) String() string {
+	if d.Member == "" {
+		return fmt.Sprintf("%s: %s became %s", d.What, d.Before, d.After)
+	}
+	return fmt.Sprintf("%s: %s: %s became %s", d.Member, d.What, d.Before, d.After)
+}
+
+// RoundTripCheck reads the puzzle at path, rewrites it in memory through the
+// same pipeline that this package's editing functions use, asking for no
+// changes, and reports every difference between the two that could matter:
+// in the list of members, their headers or content, or in the text of
+// pala.desktop when re-serialized by the editor. The puzzle itself is not
+// modified.
+//
+// An empty result means the editing functions can be trusted with that
+// puzzle; any difference is a bug in this package.
+func RoundTripCheck(path string) ([]Difference, error) {
+	before, err := summarize(path)
+	if err != nil {
+		return nil, err
+	}
+	var buf bytes.Buffer
+	err = rewriteTo(&buf, path, "(memory)", gzip.DefaultCompression, &options{},
+		func(hdr *tar.Header, r io.Reader, tw *tar.Writer) error {
+			if hdr.Name != "pala.desktop" {
+				return copyMember(hdr, r, tw)
+			}
+			data, err := io.ReadAll(r)
+			if err != nil {
+				return err
+			}
+			return writeMember(tw, hdr.Name, parseDesktop(data).bytes(), hdr)
+		})
+	if err != nil {
+		return nil, err
+	}
+	after, err := summarizeArchive(&buf, path)
+	if err != nil {
+		return nil, err
+	}
+	return compareSummaries(before, after), nil
+}
+
+// A memberSummary holds what RoundTripCheck compares about a member.
+type memberSummary struct {
+	name, linkname string
+	typeflag       byte
+	size, mode     int64
+	uid, gid       int
+	uname, gname   string
+	modTime        time.Time
+	sum            [sha256.Size]byte
+	desktop        []byte // The content, for pala.desktop only
+}
+
+func summarize(path string) ([]memberSummary, error) {
+	var ret []memberSummary
+	err := walkPuzzle(path, func(hdr *tar.Header, r io.Reader) error {
+		ms, err := summarizeMember(hdr, r)
+		if err != nil {
+			return &Error{"read member " + hdr.Name + " of", path, err}
+		}
+		ret = append(ret, ms)
+		return nil
+	})
+	return ret, err
+}
+
+func summarizeArchive(r io.Reader, path string) ([]memberSummary, error) {
+	tr, _, err := openArchive(r)
+	if err != nil {
+		return nil, &Error{"reread rewritten copy of", path, err}
+	}
+	var ret []memberSummary
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			return ret, nil
+		}
+		if err == nil {
+			var ms memberSummary
+			ms, err = summarizeMember(hdr, tr)
+			ret = append(ret, ms)
+		}
+		if err != nil {
+			return nil, &Error{"reread rewritten copy of", path, err}
+		}
+	}
+}
+
+func summarizeMember(hdr *tar.Header, r io.Reader) (memberSummary, error) {
+	ms := memberSummary{
+		name: hdr.Name, linkname: hdr.Linkname, typeflag: hdr.Typeflag,
+		size: hdr.Size, mode: hdr.Mode, uid: hdr.Uid, gid: hdr.Gid,
+		uname: hdr.Uname, gname: hdr.Gname, modTime: hdr.ModTime,
+	}
+	h := sha256.New()
+	var buf bytes.Buffer
+	if hdr.Name == "pala.desktop" {
+		r = io.TeeReader(r, &buf)
+	}
+	if _, err := io.Copy(h, r); err != nil {
+		return ms, err
+	}
+	copy(ms.sum[:], h.Sum(nil))
+	if hdr.Name == "pala.desktop" {
+		ms.desktop = buf.Bytes()
+	}
+	return ms, nil
+}
+
+// compareSummaries compares two lists of members, matching them by name
+// (and, for duplicated names, by which occurrence they are).
+func compareSummaries(before, after []memberSummary) []Difference {
+	type key struct {
+		name string
+		n    int
+	}
+	keys := func(list []memberSummary) []key {
+		seen := make(map[string]int)
+		ret := make([]key, len(list))
+		for i, ms := range list {
+			ret[i] = key{ms.name, seen[ms.name]}
+			seen[ms.name]++
+		}
+		return ret
+	}
+	bkeys, akeys := keys(before), keys(after)
+	afterAt := make(map[key]int)
+	for i, k := range akeys {
+		afterAt[k] = i
+	}
+	beforeAt := make(map[key]bool)
+	for _, k := range bkeys {
+		beforeAt[k] = true
+	}
+
+	var diffs []Difference
+	var bOrder, aOrder []string // Common members, in before and after order
+	for i, k := range bkeys {
+		j, ok := afterAt[k]
+		if !ok {
+			diffs = append(diffs, Difference{k.name, "presence", "present", "missing"})
+			continue
+		}
+		bOrder = append(bOrder, fmt.Sprint(k))
+		diffs = append(diffs, compareMembers(before[i], after[j])...)
+	}
+	for _, k := range akeys {
+		if !beforeAt[k] {
+			diffs = append(diffs, Difference{k.name, "presence", "missing", "present"})
+		} else {
+			aOrder = append(aOrder, fmt.Sprint(k))
+		}
+	}
+	if strings.Join(bOrder, "\x00") != strings.Join(aOrder, "\x00") {
+		diffs = append(diffs, Difference{"", "member order", "original", "changed"})
+	}
+	return diffs
+}
+
+// compareMembers compares two members with the same name.
+func compareMembers(b, a memberSummary) []Difference {
+	var diffs []Difference
+	add := func(what string, bv, av interface{}) {
+		diffs = append(diffs, Difference{b.name, what, fmt.Sprint(bv), fmt.Sprint(av)})
+	}
+	if b.typeflag != a.typeflag {
+		add("type", string(b.typeflag), string(a.typeflag))
+	}
+	if b.linkname != a.linkname {
+		add("link target", b.linkname, a.linkname)
+	}
+	if b.size != a.size {
+		add("size", b.size, a.size)
+	}
+	if b.mode != a.mode {
+		add("mode", fmt.Sprintf("%o", b.mode), fmt.Sprintf("%o", a.mode))
+	}
+	if b.uid != a.uid || b.gid != a.gid {
+		add("owner", fmt.Sprintf("%d:%d", b.uid, b.gid), fmt.Sprintf("%d:%d", a.uid, a.gid))
+	}
+	if b.uname != a.uname || b.gname != a.gname {
+		add("owner name", b.uname+":"+b.gname, a.uname+":"+a.gname)
+	}
+	if !b.modTime.Equal(a.modTime) {
+		add("modification time", b.modTime, a.modTime)
+	}
+	if b.sum != a.sum {
+		add("content", fmt.Sprintf("%x", b.sum[:8]), fmt.Sprintf("%x", a.sum[:8]))
+	}
+	return diffs
+}
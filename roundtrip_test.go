@@ -0,0 +1,123 @@
+package palapuzzle
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/c12h/palapuzzle/palapuzzletest"
+)
+
+func TestRoundTripVariants(t *testing.T) {
+	for _, s := range []palapuzzletest.Spec{
+		{Variant: palapuzzletest.Valid},
+		{Variant: palapuzzletest.Valid, NoImage: true},
+		{Variant: palapuzzletest.MissingPiece, Cols: 3},
+		{Variant: palapuzzletest.BadDesktop},
+	} {
+		p := palapuzzletest.File(t, s)
+		diffs, err := RoundTripCheck(p)
+		if err != nil {
+			t.Errorf("%v: %v", s.Variant, err)
+		} else if len(diffs) != 0 {
+			t.Errorf("%v: differences %v", s.Variant, diffs)
+		}
+	}
+	if _, err := RoundTripCheck(palapuzzletest.File(t, palapuzzletest.Spec{Variant: palapuzzletest.CorruptGzip})); err == nil {
+		t.Error("corrupt-gzip: no error")
+	}
+}
+
+// TestRoundTripHeaders checks that headers, duplicate members, links and
+// odd pala.desktop text come through a rewrite unchanged.
+func TestRoundTripHeaders(t *testing.T) {
+	mtime := time.Date(2015, 6, 7, 8, 9, 10, 0, time.UTC)
+	var buf bytes.Buffer
+	zw := gzip.NewWriter(&buf)
+	tw := tar.NewWriter(zw)
+	for _, m := range []struct {
+		hdr  tar.Header
+		body string
+	}{
+		{tar.Header{Name: "pala.desktop", Mode: 0640, Uid: 1000, Gid: 100, Uname: "jo", Gname: "users"},
+			"# A comment\r\n[Desktop Entry]\r\nName = Odd  spacing\r\nName[de]=Seltsam\r\n\r\n[SlicerArgs]\r\n020_PieceCount=2\r\nX-Custom=\\s keep\r\n"},
+		{tar.Header{Name: "image.jpg", Mode: 0600, Format: tar.FormatPAX, PAXRecords: map[string]string{"comment": "hi"}}, "not really a JPEG"},
+		{tar.Header{Name: "0.png", Mode: 0644}, "a"},
+		{tar.Header{Name: "1.png", Mode: 0755}, "b"},
+		{tar.Header{Name: "0.png", Mode: 0644}, "a second 0.png"},
+		{tar.Header{Name: "link.png", Typeflag: tar.TypeSymlink, Linkname: "0.png", Mode: 0777}, ""},
+		{tar.Header{Name: "extras/", Typeflag: tar.TypeDir, Mode: 0755}, ""},
+	} {
+		hdr := m.hdr
+		if hdr.Typeflag == 0 {
+			hdr.Typeflag = tar.TypeReg
+		}
+		hdr.Size, hdr.ModTime = int64(len(m.body)), mtime
+		if hdr.Typeflag != tar.TypeReg {
+			hdr.Size = 0
+		}
+		if err := tw.WriteHeader(&hdr); err != nil {
+			t.Fatal(err)
+		}
+		tw.Write([]byte(m.body))
+	}
+	tw.Close()
+	zw.Close()
+	p := filepath.Join(t.TempDir(), "headers.puzzle")
+	if err := os.WriteFile(p, buf.Bytes(), 0644); err != nil {
+		t.Fatal(err)
+	}
+	diffs, err := RoundTripCheck(p)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(diffs) != 0 {
+		t.Errorf("differences %v", diffs)
+	}
+}
+
+// TestCompareSummaries checks that compareSummaries notices what
+// RoundTripCheck promises to.
+func TestCompareSummaries(t *testing.T) {
+	before := []memberSummary{
+		{name: "pala.desktop", typeflag: tar.TypeReg, size: 10, mode: 0644},
+		{name: "0.png", typeflag: tar.TypeReg, size: 1, mode: 0644},
+		{name: "0.png", typeflag: tar.TypeReg, size: 2, mode: 0644},
+		{name: "l", typeflag: tar.TypeSymlink, linkname: "0.png"},
+	}
+	change := func(f func(after []memberSummary) []memberSummary) []Difference {
+		after := append([]memberSummary(nil), before...)
+		return compareSummaries(before, f(after))
+	}
+	if d := change(func(a []memberSummary) []memberSummary { return a }); len(d) != 0 {
+		t.Errorf("no change: %v", d)
+	}
+	for what, f := range map[string]func(a []memberSummary) []memberSummary{
+		"member order": func(a []memberSummary) []memberSummary { a[0], a[3] = a[3], a[0]; return a },
+		"size":         func(a []memberSummary) []memberSummary { a[1], a[2] = a[2], a[1]; return a },
+		"mode":         func(a []memberSummary) []memberSummary { a[0].mode = 0600; return a },
+		"owner":        func(a []memberSummary) []memberSummary { a[0].uid = 1; return a },
+		"owner name":   func(a []memberSummary) []memberSummary { a[0].uname = "x"; return a },
+		"link target":  func(a []memberSummary) []memberSummary { a[3].linkname = "1.png"; return a },
+		"type":         func(a []memberSummary) []memberSummary { a[3].typeflag = tar.TypeLink; return a },
+		"modification time": func(a []memberSummary) []memberSummary {
+			a[0].modTime = time.Unix(1, 0)
+			return a
+		},
+		"content":  func(a []memberSummary) []memberSummary { a[1].sum[0] = 1; return a },
+		"presence": func(a []memberSummary) []memberSummary { return a[:3] },
+	} {
+		d := change(f)
+		found := false
+		for _, diff := range d {
+			found = found || diff.What == what
+		}
+		if !found {
+			t.Errorf("%s: differences %v", what, d)
+		}
+	}
+}
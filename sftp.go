@@ -0,0 +1,504 @@
+package palapuzzle
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os/exec"
+	"path"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// An SFTPBackend is a Backend for puzzles on a remote host, accessed using
+// (version 3 of) the SSH file transfer protocol. Names are paths on the
+// remote host.
+//
+// DialSFTP uses the system's ssh command, so that keys, agents, known hosts
+// and ~/.ssh/config all work as usual. NewSFTPBackend can be used instead to
+// run the protocol over some other connection.
+type SFTPBackend struct {
+	mu          sync.Mutex // Held while a request is outstanding
+	conn        io.ReadWriteCloser
+	cmd         *exec.Cmd // If started by DialSFTP
+	nextID      uint32
+	posixRename bool // Server supports posix-rename@openssh.com
+}
+
+// DialSFTP starts "ssh [sshArgs...] -s host sftp" and returns an SFTPBackend
+// using that connection. Host may include a user name, as in "me@nas".
+func DialSFTP(host string, sshArgs ...string) (*SFTPBackend, error) {
+	args := append(append([]string{}, sshArgs...), "-s", host, "sftp")
+	cmd := exec.Command("ssh", args...)
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		return nil, err
+	}
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return nil, err
+	}
+	stderr := &bytes.Buffer{}
+	cmd.Stderr = stderr
+	if err := cmd.Start(); err != nil {
+		return nil, err
+	}
+	b, err := NewSFTPBackend(struct {
+		io.Reader
+		io.WriteCloser
+	}{stdout, stdin})
+	if err != nil {
+		stdin.Close()
+		cmd.Wait()
+		if msg := strings.TrimSpace(stderr.String()); msg != "" {
+			err = fmt.Errorf("%v (ssh: %s)", err, msg)
+		}
+		return nil, err
+	}
+	b.cmd = cmd
+	return b, nil
+}
+
+// NewSFTPBackend returns an SFTPBackend that talks to an SFTP server through
+// conn, which is typically the stdin and stdout of an SSH "sftp" subsystem.
+func NewSFTPBackend(conn io.ReadWriteCloser) (*SFTPBackend, error) {
+	b := &SFTPBackend{conn: conn}
+	if err := b.send(sshFxpInit, func(p *sftpPacket) { p.u32(3) }); err != nil {
+		return nil, err
+	}
+	typ, data, err := b.recv()
+	if err != nil {
+		return nil, err
+	}
+	if typ != sshFxpVersion {
+		return nil, fmt.Errorf("sftp: unexpected packet type %d", typ)
+	}
+	r := &sftpReader{data: data}
+	if v := r.u32(); v < 3 {
+		return nil, fmt.Errorf("sftp: unsupported protocol version %d", v)
+	}
+	for len(r.data) > 0 && r.err == nil {
+		name, _ := r.str(), r.str()
+		if name == "posix-rename@openssh.com" {
+			b.posixRename = true
+		}
+	}
+	return b, nil
+}
+
+// Close ends the SFTP session (and the ssh command, if DialSFTP started it).
+func (b *SFTPBackend) Close() error {
+	err := b.conn.Close()
+	if b.cmd != nil {
+		b.cmd.Wait() // Killed by closing its stdin; don't care how it exits
+	}
+	return err
+}
+
+// SFTP packet types and flags, from draft-ietf-secsh-filexfer-02.
+const (
+	sshFxpInit          = 1
+	sshFxpVersion       = 2
+	sshFxpOpen          = 3
+	sshFxpClose         = 4
+	sshFxpRead          = 5
+	sshFxpWrite         = 6
+	sshFxpOpendir       = 11
+	sshFxpReaddir       = 12
+	sshFxpRemove        = 13
+	sshFxpStat          = 17
+	sshFxpRename        = 18
+	sshFxpStatus        = 101
+	sshFxpHandle        = 102
+	sshFxpData          = 103
+	sshFxpName          = 104
+	sshFxpAttrs         = 105
+	sshFxpExtended      = 200
+	sshFxfRead          = 0x01
+	sshFxfWrite         = 0x02
+	sshFxfCreat         = 0x08
+	sshFxfTrunc         = 0x10
+	sshFxfExcl          = 0x20
+	sshFileXferAttrSize = 0x01
+	sshFileXferAttrIDs  = 0x02
+	sshFileXferAttrPerm = 0x04
+	sshFileXferAttrTime = 0x08
+	sshFileXferAttrExt  = 0x80000000
+	sshFxOK             = 0
+	sshFxEOF            = 1
+	sshFxNoSuchFile     = 2
+	sshFxPermDenied     = 3
+	sshFxOpUnsupported  = 8
+	sftpChunk           = 32 * 1024 // Largest read or write we request
+)
+
+// An sftpPacket accumulates the payload of an outgoing packet.
+type sftpPacket struct{ bytes.Buffer }
+
+func (p *sftpPacket) u32(v uint32) { binary.Write(&p.Buffer, binary.BigEndian, v) }
+func (p *sftpPacket) u64(v uint64) { binary.Write(&p.Buffer, binary.BigEndian, v) }
+func (p *sftpPacket) str(s string) { p.u32(uint32(len(s))); p.WriteString(s) }
+
+// An sftpReader decodes the payload of an incoming packet, remembering the
+// first error so that callers need only check at the end.
+type sftpReader struct {
+	data []byte
+	err  error
+}
+
+func (r *sftpReader) next(n int) []byte {
+	if r.err != nil || len(r.data) < n {
+		r.err = errors.New("sftp: short packet")
+		return make([]byte, n)
+	}
+	b := r.data[:n]
+	r.data = r.data[n:]
+	return b
+}
+
+func (r *sftpReader) u32() uint32 { return binary.BigEndian.Uint32(r.next(4)) }
+func (r *sftpReader) u64() uint64 { return binary.BigEndian.Uint64(r.next(8)) }
+
+func (r *sftpReader) str() string {
+	n := r.u32()
+	if r.err == nil && uint64(n) > uint64(len(r.data)) {
+		r.err = errors.New("sftp: short packet")
+	}
+	if r.err != nil {
+		return ""
+	}
+	return string(r.next(int(n)))
+}
+
+// attrs decodes an ATTRS structure into a FileInfo for the named file.
+func (r *sftpReader) attrs(name string) *sftpFileInfo {
+	fi := &sftpFileInfo{name: name}
+	flags := r.u32()
+	if flags&sshFileXferAttrSize != 0 {
+		fi.size = int64(r.u64())
+	}
+	if flags&sshFileXferAttrIDs != 0 {
+		r.u32()
+		r.u32()
+	}
+	if flags&sshFileXferAttrPerm != 0 {
+		fi.perm = r.u32()
+	}
+	if flags&sshFileXferAttrTime != 0 {
+		r.u32()
+		fi.mtime = time.Unix(int64(r.u32()), 0)
+	}
+	if flags&sshFileXferAttrExt != 0 {
+		for n := r.u32(); n > 0 && r.err == nil; n-- {
+			r.str()
+			r.str()
+		}
+	}
+	return fi
+}
+
+// send writes a packet of the given type, built (after the type) by fill.
+func (b *SFTPBackend) send(typ byte, fill func(*sftpPacket)) error {
+	var p sftpPacket
+	p.Write([]byte{0, 0, 0, 0, typ})
+	fill(&p)
+	buf := p.Bytes()
+	binary.BigEndian.PutUint32(buf, uint32(len(buf)-4))
+	_, err := b.conn.Write(buf)
+	return err
+}
+
+// recv reads a packet, returning its type and the rest of its payload.
+func (b *SFTPBackend) recv() (byte, []byte, error) {
+	var hdr [5]byte
+	if _, err := io.ReadFull(b.conn, hdr[:]); err != nil {
+		return 0, nil, fmt.Errorf("sftp: connection lost: %w", err)
+	}
+	n := binary.BigEndian.Uint32(hdr[:4])
+	if n < 1 || n > 1<<20 {
+		return 0, nil, fmt.Errorf("sftp: bad packet length %d", n)
+	}
+	data := make([]byte, n-1)
+	if _, err := io.ReadFull(b.conn, data); err != nil {
+		return 0, nil, fmt.Errorf("sftp: connection lost: %w", err)
+	}
+	return hdr[4], data, nil
+}
+
+// call sends a request and returns the type and payload (after the request
+// id) of the matching response. A STATUS response other than OK is
+// converted to an error; so is a response whose type is not one of want.
+func (b *SFTPBackend) call(typ byte, fill func(*sftpPacket), want ...byte) (byte, *sftpReader, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.nextID++
+	id := b.nextID
+	err := b.send(typ, func(p *sftpPacket) {
+		p.u32(id)
+		fill(p)
+	})
+	if err != nil {
+		return 0, nil, err
+	}
+	rtyp, data, err := b.recv()
+	if err != nil {
+		return 0, nil, err
+	}
+	r := &sftpReader{data: data}
+	if r.u32() != id {
+		return 0, nil, errors.New("sftp: response out of sequence")
+	}
+	if rtyp == sshFxpStatus {
+		code, msg := r.u32(), r.str()
+		if code != sshFxOK {
+			return 0, nil, statusError(code, msg)
+		}
+	}
+	if bytes.IndexByte(want, rtyp) < 0 {
+		return 0, nil, fmt.Errorf("sftp: unexpected packet type %d", rtyp)
+	}
+	return rtyp, r, r.err
+}
+
+// statusError converts an SFTP status code to an error, using the fs
+// package's errors where they fit so that errors.Is works.
+func statusError(code uint32, msg string) error {
+	switch code {
+	case sshFxOK:
+		return nil
+	case sshFxEOF:
+		return io.EOF
+	case sshFxNoSuchFile:
+		return fs.ErrNotExist
+	case sshFxPermDenied:
+		return fs.ErrPermission
+	case sshFxOpUnsupported:
+		return errors.ErrUnsupported
+	}
+	if msg == "" {
+		msg = fmt.Sprintf("status %d", code)
+	}
+	return errors.New("sftp: " + msg)
+}
+
+func (b *SFTPBackend) openHandle(name string, pflags uint32) (string, error) {
+	_, r, err := b.call(sshFxpOpen, func(p *sftpPacket) {
+		p.str(name)
+		p.u32(pflags)
+		p.u32(0) // No attributes
+	}, sshFxpHandle)
+	if err != nil {
+		return "", err
+	}
+	return r.str(), r.err
+}
+
+func (b *SFTPBackend) closeHandle(handle string) error {
+	_, _, err := b.call(sshFxpClose, func(p *sftpPacket) { p.str(handle) }, sshFxpStatus)
+	return err
+}
+
+// simple performs a request on one or two paths that returns only a status.
+func (b *SFTPBackend) simple(typ byte, names ...string) error {
+	_, _, err := b.call(typ, func(p *sftpPacket) {
+		for _, n := range names {
+			p.str(n)
+		}
+	}, sshFxpStatus)
+	return err
+}
+
+func (b *SFTPBackend) Open(name string) (io.ReadCloser, error) {
+	fi, err := b.Stat(name)
+	if err != nil {
+		return nil, err
+	}
+	h, err := b.openHandle(name, sshFxfRead)
+	if err != nil {
+		return nil, err
+	}
+	return &sftpFile{b: b, handle: h, fi: fi}, nil
+}
+
+func (b *SFTPBackend) Stat(name string) (fs.FileInfo, error) {
+	_, r, err := b.call(sshFxpStat, func(p *sftpPacket) { p.str(name) }, sshFxpAttrs)
+	if err != nil {
+		return nil, err
+	}
+	fi := r.attrs(path.Base(name))
+	return fi, r.err
+}
+
+func (b *SFTPBackend) List(dir string) ([]fs.FileInfo, error) {
+	_, r, err := b.call(sshFxpOpendir, func(p *sftpPacket) { p.str(dir) }, sshFxpHandle)
+	if err != nil {
+		return nil, err
+	}
+	h := r.str()
+	defer b.closeHandle(h)
+	var ret []fs.FileInfo
+	for {
+		_, r, err := b.call(sshFxpReaddir, func(p *sftpPacket) { p.str(h) }, sshFxpName)
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		for n := r.u32(); n > 0 && r.err == nil; n-- {
+			name := r.str()
+			r.str() // The "longname", as from ls -l
+			fi := r.attrs(name)
+			if name != "." && name != ".." {
+				ret = append(ret, fi)
+			}
+		}
+		if r.err != nil {
+			return nil, r.err
+		}
+	}
+	sort.Slice(ret, func(i, j int) bool { return ret[i].Name() < ret[j].Name() })
+	return ret, nil
+}
+
+func (b *SFTPBackend) Remove(name string) error {
+	return b.simple(sshFxpRemove, name)
+}
+
+// Write writes to a temporary file beside name and renames it into place
+// when closed.
+func (b *SFTPBackend) Write(name string) (io.WriteCloser, error) {
+	dir, base := path.Split(name)
+	tmp := fmt.Sprintf("%s.%s.tmp-%d", dir, base, time.Now().UnixNano())
+	h, err := b.openHandle(tmp, sshFxfWrite|sshFxfCreat|sshFxfTrunc|sshFxfExcl)
+	if err != nil {
+		return nil, err
+	}
+	return &sftpWriter{b: b, handle: h, tmp: tmp, target: name}, nil
+}
+
+// rename renames oldName to newName, replacing any existing newName.
+func (b *SFTPBackend) rename(oldName, newName string) error {
+	if b.posixRename {
+		_, _, err := b.call(sshFxpExtended, func(p *sftpPacket) {
+			p.str("posix-rename@openssh.com")
+			p.str(oldName)
+			p.str(newName)
+		}, sshFxpStatus)
+		return err
+	}
+	// Plain SFTP rename will not replace an existing file.
+	if err := b.simple(sshFxpRemove, newName); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return err
+	}
+	return b.simple(sshFxpRename, oldName, newName)
+}
+
+// An sftpFile is a remote file open for reading.
+type sftpFile struct {
+	b      *SFTPBackend
+	handle string
+	fi     fs.FileInfo
+	offset uint64
+}
+
+func (f *sftpFile) Read(p []byte) (int, error) {
+	if len(p) > sftpChunk {
+		p = p[:sftpChunk]
+	}
+	_, r, err := f.b.call(sshFxpRead, func(pkt *sftpPacket) {
+		pkt.str(f.handle)
+		pkt.u64(f.offset)
+		pkt.u32(uint32(len(p)))
+	}, sshFxpData)
+	if err != nil {
+		return 0, err
+	}
+	n := copy(p, r.str())
+	f.offset += uint64(n)
+	return n, r.err
+}
+
+func (f *sftpFile) Close() error { return f.b.closeHandle(f.handle) }
+
+func (f *sftpFile) Stat() (fs.FileInfo, error) { return f.fi, nil }
+
+// An sftpWriter is a temporary remote file open for writing.
+type sftpWriter struct {
+	b           *SFTPBackend
+	handle      string
+	tmp, target string
+	offset      uint64
+}
+
+func (w *sftpWriter) Write(p []byte) (int, error) {
+	written := 0
+	for len(p) > 0 {
+		chunk := p
+		if len(chunk) > sftpChunk {
+			chunk = chunk[:sftpChunk]
+		}
+		_, _, err := w.b.call(sshFxpWrite, func(pkt *sftpPacket) {
+			pkt.str(w.handle)
+			pkt.u64(w.offset)
+			pkt.str(string(chunk))
+		}, sshFxpStatus)
+		if err != nil {
+			return written, err
+		}
+		w.offset += uint64(len(chunk))
+		written += len(chunk)
+		p = p[len(chunk):]
+	}
+	return written, nil
+}
+
+func (w *sftpWriter) Close() error {
+	if err := w.b.closeHandle(w.handle); err != nil {
+		w.b.simple(sshFxpRemove, w.tmp)
+		return err
+	}
+	if err := w.b.rename(w.tmp, w.target); err != nil {
+		w.b.simple(sshFxpRemove, w.tmp)
+		return err
+	}
+	return nil
+}
+
+func (w *sftpWriter) Abort() error {
+	w.b.closeHandle(w.handle)
+	return w.b.simple(sshFxpRemove, w.tmp)
+}
+
+// An sftpFileInfo holds the attributes of a remote file.
+type sftpFileInfo struct {
+	name  string
+	size  int64
+	perm  uint32 // POSIX st_mode
+	mtime time.Time
+}
+
+func (fi *sftpFileInfo) Name() string       { return fi.name }
+func (fi *sftpFileInfo) Size() int64        { return fi.size }
+func (fi *sftpFileInfo) ModTime() time.Time { return fi.mtime }
+func (fi *sftpFileInfo) IsDir() bool        { return fi.perm&0170000 == 0040000 }
+func (fi *sftpFileInfo) Sys() interface{}   { return nil }
+
+func (fi *sftpFileInfo) Mode() fs.FileMode {
+	m := fs.FileMode(fi.perm & 0777)
+	switch fi.perm & 0170000 {
+	case 0040000:
+		m |= fs.ModeDir
+	case 0120000:
+		m |= fs.ModeSymlink
+	case 0100000:
+	default:
+		m |= fs.ModeIrregular
+	}
+	return m
+}
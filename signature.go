@@ -0,0 +1,138 @@
+package palapuzzle
+
+import (
+	"archive/tar"
+	"bytes"
+	"crypto/ed25519"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+)
+
+// signatureMember is the name of the member holding a puzzle's signature,
+// as Sign writes it.
+const signatureMember = "SIGNATURE"
+
+// signaturePrefix starts the content of a SIGNATURE member, naming the
+// algorithm; the signature follows in base64.
+const signaturePrefix = "ed25519 "
+
+// Errors from Verify.
+var (
+	ErrNotSigned    = errors.New("palapuzzle: puzzle is not signed")
+	ErrBadSignature = errors.New("palapuzzle: signature does not match")
+)
+
+// Sign rewrites the puzzle at path, in place, with a SIGNATURE member
+// holding an ed25519 signature, made with key, of every other member (but
+// CHECKSUMS): its position, type, name, link target and content. Any old
+// signature is replaced. Verify checks it with the matching public key, so
+// that someone handing on a pack of puzzles can show they are as its maker
+// signed them. Rewriting the puzzle in any other way (with UpgradePuzzle,
+// or by reordering its members) makes the signature invalid, so sign last;
+// CHECKSUMS is left out, so WriteChecksums can come before or after. Sign
+// heeds the writing options (see Option); under Reproducible, what is
+// signed is the members in the order they are written in.
+func Sign(path string, key ed25519.PrivateKey, opts ...Option) error {
+	if len(key) != ed25519.PrivateKeySize {
+		return &Error{"sign", path, errors.New("palapuzzle: bad ed25519 private key")}
+	}
+	o := getOptions(opts)
+	ms, err := signedMembers(path, nil)
+	if err != nil {
+		return err
+	}
+	if o.reproducible {
+		sort.SliceStable(ms, func(i, j int) bool { return canonicalLess(ms[i].name, ms[j].name) })
+	}
+	sig := signaturePrefix + base64.StdEncoding.EncodeToString(ed25519.Sign(key, signedPayload(ms))) + "\n"
+	return writeFirstMember(path, signatureMember, []byte(sig), o)
+}
+
+// Verify checks the signature which Sign gave the puzzle at path (or URL, as
+// for ScanPuzzle) against key. It returns nil if the puzzle is as it was
+// signed with the matching private key, or else an error satisfying
+// errors.Is(err, ErrNotSigned) or errors.Is(err, ErrBadSignature); other
+// errors mean the puzzle could not be read.
+func Verify(path string, key ed25519.PublicKey) error {
+	if len(key) != ed25519.PublicKeySize {
+		return &Error{"verify", path, errors.New("palapuzzle: bad ed25519 public key")}
+	}
+	var sig []byte
+	found := false
+	ms, err := signedMembers(path, func(hdr *tar.Header, r io.Reader) error {
+		if hdr.Name != signatureMember || found {
+			return nil
+		}
+		found = true
+		data, err := io.ReadAll(io.LimitReader(r, 1024))
+		if err != nil {
+			return &Error{"read member " + signatureMember + " of", path, err}
+		}
+		text, ok := strings.CutPrefix(string(bytes.TrimSpace(data)), signaturePrefix)
+		if ok {
+			sig, err = base64.StdEncoding.DecodeString(text)
+		}
+		if !ok || err != nil || len(sig) != ed25519.SignatureSize {
+			sig = nil // Which no key matches
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	if !found {
+		return &Error{"verify", path, ErrNotSigned}
+	}
+	if sig == nil || !ed25519.Verify(key, signedPayload(ms), sig) {
+		return &Error{"verify", path, ErrBadSignature}
+	}
+	return nil
+}
+
+// A signedMember is what a signature covers of one member.
+type signedMember struct {
+	typeflag       byte
+	name, linkname string
+	sum            [sha256.Size]byte // Of the content
+}
+
+// signedMembers returns what a signature covers of every member of the
+// puzzle at path but CHECKSUMS and SIGNATURE, in order. Those two are
+// passed to other, if it is not nil, in the same pass.
+func signedMembers(path string, other func(hdr *tar.Header, r io.Reader) error) ([]signedMember, error) {
+	var ret []signedMember
+	err := walkPuzzle(path, func(hdr *tar.Header, r io.Reader) error {
+		if hdr.Name == checksumsMember || hdr.Name == signatureMember {
+			if other != nil {
+				return other(hdr, r)
+			}
+			return nil
+		}
+		h := sha256.New()
+		if _, err := io.Copy(h, r); err != nil {
+			return &Error{"read member " + hdr.Name + " of", path, err}
+		}
+		sm := signedMember{typeflag: hdr.Typeflag, name: hdr.Name, linkname: hdr.Linkname}
+		copy(sm.sum[:], h.Sum(nil))
+		ret = append(ret, sm)
+		return nil
+	})
+	return ret, err
+}
+
+// signedPayload returns what is signed for ms: a line for each member,
+// giving its position, type, content's SHA-256 sum, and name and link
+// target, each prefixed with its length, so that no name (with a newline
+// in it, say) can pass for more than one member.
+func signedPayload(ms []signedMember) []byte {
+	var b bytes.Buffer
+	for i, m := range ms {
+		fmt.Fprintf(&b, "%d %d %x %d:%s %d:%s\n", i, m.typeflag, m.sum, len(m.name), m.name, len(m.linkname), m.linkname)
+	}
+	return b.Bytes()
+}
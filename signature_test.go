@@ -0,0 +1,103 @@
+package palapuzzle
+
+import (
+	"archive/tar"
+	"crypto/ed25519"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"testing"
+)
+
+func TestSignVerify(t *testing.T) {
+	pub, priv, _ := ed25519.GenerateKey(nil)
+	other, _, _ := ed25519.GenerateKey(nil)
+	p := testPuzzle(t, testMember{Name: "LICENSE", Body: "CC-BY"})
+	if err := Verify(p, pub); !errors.Is(err, ErrNotSigned) {
+		t.Fatalf("Verify before Sign: %v", err)
+	}
+	if err := Sign(p, priv); err != nil {
+		t.Fatal(err)
+	}
+	if err := Verify(p, pub); err != nil {
+		t.Fatal(err)
+	}
+	if err := Verify(p, other); !errors.Is(err, ErrBadSignature) {
+		t.Fatalf("Verify with another key: %v", err)
+	}
+	if err := WriteChecksums(p); err != nil {
+		t.Fatal(err)
+	}
+	if err := Verify(p, pub); err != nil {
+		t.Fatalf("Verify after WriteChecksums: %v", err)
+	}
+}
+
+// signed returns the members of a puzzle with members ms, once signed with
+// priv.
+func signed(t *testing.T, priv ed25519.PrivateKey, ms []testMember) []testMember {
+	t.Helper()
+	p := writeTestPuzzle(t, ms)
+	if err := Sign(p, priv); err != nil {
+		t.Fatal(err)
+	}
+	return readMembers(t, p)
+}
+
+func TestVerifyAddedLinks(t *testing.T) {
+	pub, priv, _ := ed25519.GenerateKey(nil)
+	ms := signed(t, priv, []testMember{{Name: "pala.desktop", Body: "[Desktop Entry]\n"}, {Name: "0.png", Body: "a"}})
+	for _, extra := range []testMember{
+		{Name: "evil", Type: tar.TypeSymlink, Linkname: "/etc/passwd"},
+		{Name: "evil", Type: tar.TypeLink, Linkname: "0.png"},
+		{Name: "evil", Type: tar.TypeChar},
+		{Name: "evil", Type: tar.TypeDir},
+	} {
+		p := writeTestPuzzle(t, append(append([]testMember(nil), ms...), extra))
+		if err := Verify(p, pub); !errors.Is(err, ErrBadSignature) {
+			t.Errorf("Verify with an added member of type %q: %v", extra.Type, err)
+		}
+	}
+
+	// A link given a new target
+	ms = signed(t, priv, []testMember{{Name: "pala.desktop"}, {Name: "l", Type: tar.TypeSymlink, Linkname: "a"}})
+	ms[2].Linkname = "b"
+	if err := Verify(writeTestPuzzle(t, ms), pub); !errors.Is(err, ErrBadSignature) {
+		t.Errorf("Verify with a new link target: %v", err)
+	}
+}
+
+func TestVerifyForgedName(t *testing.T) {
+	pub, priv, _ := ed25519.GenerateKey(nil)
+	ms := signed(t, priv, []testMember{{Name: "pala.desktop"}, {Name: "x", Body: "C"}, {Name: "y", Body: "D"}})
+	// One member whose name makes it look like x and y, as lines of
+	// sha256sum output would
+	forged := fmt.Sprintf("x\n%x  y", sha256.Sum256([]byte("D")))
+	p := writeTestPuzzle(t, []testMember{ms[0], ms[1], {Name: forged, Body: "C"}})
+	if err := Verify(p, pub); !errors.Is(err, ErrBadSignature) {
+		t.Errorf("Verify with a forged name: %v", err)
+	}
+}
+
+func TestVerifyReordered(t *testing.T) {
+	pub, priv, _ := ed25519.GenerateKey(nil)
+	ms := signed(t, priv, []testMember{
+		{Name: "pala.desktop", Body: "[Desktop Entry]\nName=First\n"},
+		{Name: "pala.desktop", Body: "[Desktop Entry]\nName=Second\n"},
+	})
+	ms[1], ms[2] = ms[2], ms[1]
+	if err := Verify(writeTestPuzzle(t, ms), pub); !errors.Is(err, ErrBadSignature) {
+		t.Errorf("Verify with duplicate members swapped: %v", err)
+	}
+}
+
+func TestSignReproducible(t *testing.T) {
+	pub, priv, _ := ed25519.GenerateKey(nil)
+	p := writeTestPuzzle(t, []testMember{{Name: "z.txt"}, {Name: "1.png"}, {Name: "pala.desktop"}, {Name: "0.png"}})
+	if err := Sign(p, priv, Reproducible()); err != nil {
+		t.Fatal(err)
+	}
+	if err := Verify(p, pub); err != nil {
+		t.Fatal(err)
+	}
+}
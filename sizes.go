@@ -0,0 +1,34 @@
+package palapuzzle
+
+// Stats summarizes a set of measurements, such as the sizes of a puzzle's
+// pieces. All its fields are zero for an empty set.
+type Stats struct {
+	Count    int
+	Min, Max int64
+	Total    int64
+	Mean     float64
+}
+
+// add adds v to s.
+func (s *Stats) add(v int64) {
+	if s.Count == 0 || v < s.Min {
+		s.Min = v
+	}
+	if s.Count == 0 || v > s.Max {
+		s.Max = v
+	}
+	s.Count++
+	s.Total += v
+	s.Mean = float64(s.Total) / float64(s.Count)
+}
+
+// PieceSizeStats summarizes the sizes in bytes of the puzzle's N.png files,
+// from PieceSizes: a Max far above the Mean points to pathologically large
+// pieces, and Total to how much a viewer has to load.
+func (pi *PuzzleInfo) PieceSizeStats() Stats {
+	var s Stats
+	for _, size := range pi.PieceSizes {
+		s.add(size)
+	}
+	return s
+}
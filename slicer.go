@@ -0,0 +1,72 @@
+package palapuzzle
+
+import (
+	"strconv"
+	"strings"
+)
+
+// SlicerProperties are the settings the puzzle was cut with, as its
+// slicer's dialog showed them, from pala.desktop. The standard slicers'
+// settings have fields of their own; every setting, theirs included, is
+// also in Raw, so that other slicers' settings can be shown, and any of them
+// given back to a slicer to cut a puzzle the same way.
+type SlicerProperties struct {
+	PieceCount  int // Zero, in each of these, if not given or not a number
+	Flexibility int // How much the pieces' edges wiggle
+	PlugSize    int // How big the pieces' tabs are
+	// Every setting, by its plain name (without a position prefix, as in
+	// "020_PieceCount", or "SlicerProperty-"), with its value as in the file
+	Raw map[string]string
+}
+
+// slicerPropertyPrefix marks slicer settings outside [SlicerArgs], as some
+// programs write them.
+const slicerPropertyPrefix = "SlicerProperty-"
+
+// SlicerProperties returns the settings the puzzle was cut with, or nil if it
+// records none. They are taken from the [SlicerArgs] group, from the
+// standard settings of legacy puzzles in other groups (see FormatLegacy),
+// and from keys named like "SlicerProperty-PieceCount" in any group; where
+// a setting is given more than once, the one in [SlicerArgs] wins.
+func (pi *PuzzleInfo) SlicerProperties() *SlicerProperties {
+	if pi.desktop == nil {
+		return nil
+	}
+	return pi.desktop.slicerProperties()
+}
+
+// slicerProperties does the work of PuzzleInfo.SlicerProperties.
+func (d *desktopFile) slicerProperties() *SlicerProperties {
+	raw := make(map[string]string)
+	for _, inArgs := range []bool{true, false} { // Best first
+		for _, l := range d.lines {
+			if !l.isKey || (l.group == slicerGroup) != inArgs {
+				continue
+			}
+			name, prefixed := strings.CutPrefix(l.key, slicerPropertyPrefix)
+			if m := reNumberedKey.FindStringSubmatch(name); m != nil {
+				name = m[1]
+			}
+			if !inArgs && !prefixed && !(isSlicerKey(name) && legacyGroups[l.group]) {
+				continue
+			}
+			if _, ok := raw[name]; !ok {
+				raw[name] = l.value
+			}
+		}
+	}
+	if len(raw) == 0 {
+		return nil
+	}
+	sp := &SlicerProperties{Raw: raw}
+	for name, p := range map[string]*int{
+		"PieceCount":  &sp.PieceCount,
+		"Flexibility": &sp.Flexibility,
+		"PlugSize":    &sp.PlugSize,
+	} {
+		if n, err := strconv.Atoi(raw[name]); err == nil {
+			*p = n
+		}
+	}
+	return sp
+}
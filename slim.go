@@ -0,0 +1,105 @@
+package palapuzzle
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"errors"
+	"io"
+)
+
+// ErrNotSlim is returned by UnslimPuzzle for a puzzle that SlimPuzzle has
+// not been applied to.
+var ErrNotSlim = errors.New("palapuzzle: puzzle is not slim")
+
+// SlimPuzzle rewrites the puzzle at path in place without its image.jpg
+// member, which is usually the largest part of a puzzle but can be rebuilt
+// from the pieces and their offsets. The puzzle is marked as slim with an
+// X-Palapuzzle-Slim key in pala.desktop. Palapeli can still play a slim
+// puzzle, but shows no preview for it until UnslimPuzzle is used.
+//
+// SlimPuzzle refuses to remove the image unless every piece has an offset,
+// so that UnslimPuzzle is sure to work. It heeds the writing options (see
+// Option).
+func SlimPuzzle(path string, opts ...Option) error {
+	pc, err := readContent(path)
+	if err != nil {
+		return err
+	}
+	if _, err := pc.bounds(); err != nil {
+		return &Error{"slim", path, err}
+	}
+	pc.desktop.set(mainGroup, slimKey, "true")
+	pc.desktop.remove(mainGroup, rebuiltKey)
+	return rewritePuzzle(path, path, gzip.DefaultCompression, getOptions(opts),
+		func(hdr *tar.Header, r io.Reader, tw *tar.Writer) error {
+			switch hdr.Name {
+			case "image.jpg":
+				return nil
+			case "pala.desktop":
+				return writeMember(tw, hdr.Name, pc.desktop.bytes(), hdr)
+			}
+			return copyMember(hdr, r, tw)
+		})
+}
+
+// UnslimPuzzle undoes SlimPuzzle: it rebuilds image.jpg by compositing the
+// pieces at their offsets and adds it to the puzzle at path, in place. The
+// slim mark is replaced with an X-Palapuzzle-ImageRebuilt key, since the new
+// image is a close copy of the original rather than the original itself.
+// It heeds the writing options.
+func UnslimPuzzle(path string, opts ...Option) error {
+	pc, err := readContent(path)
+	if err != nil {
+		return err
+	}
+	if v, _ := pc.desktop.get(mainGroup, slimKey); v != "true" {
+		return &Error{"unslim", path, ErrNotSlim}
+	}
+	return addImage(path, pc, getOptions(opts))
+}
+
+// RebuildImage repairs the puzzle at path, in place, if its image.jpg is
+// missing or cannot be decoded, by compositing the pieces at their offsets
+// to make a new one. (Palapeli shows a broken preview for such puzzles.) It
+// reports whether it did so. The new image is marked as rebuilt with an
+// X-Palapuzzle-ImageRebuilt key in pala.desktop. RebuildImage heeds the
+// writing options; under DryRun, it reports whether it would have repaired
+// the puzzle.
+func RebuildImage(path string, opts ...Option) (bool, error) {
+	pc, err := readContent(path)
+	if err != nil {
+		return false, err
+	}
+	if pc.imageOK {
+		return false, nil
+	}
+	if err := addImage(path, pc, getOptions(opts)); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// addImage rewrites the puzzle at path (whose content is pc) with an
+// image.jpg composited from its pieces, replacing any existing one, and its
+// pala.desktop marked to say so. The puzzle is no longer slim, if it was.
+func addImage(path string, pc *puzzleContent, o *options) error {
+	jpg, err := pc.compositeJPEG()
+	if err != nil {
+		return &Error{"rebuild image for", path, err}
+	}
+	pc.desktop.remove(mainGroup, slimKey)
+	pc.desktop.set(mainGroup, rebuiltKey, "true")
+	return rewritePuzzle(path, path, gzip.DefaultCompression, o,
+		func(hdr *tar.Header, r io.Reader, tw *tar.Writer) error {
+			switch hdr.Name {
+			case "image.jpg":
+				return nil
+			case "pala.desktop":
+				if err := writeMember(tw, hdr.Name, pc.desktop.bytes(), hdr); err != nil {
+					return err
+				}
+				return writeMember(tw, "image.jpg", jpg, hdr)
+			}
+			return copyMember(hdr, r, tw)
+		})
+}
@@ -0,0 +1,195 @@
+package palapuzzle
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"image"
+	"image/draw"
+	"image/jpeg"
+	"image/png"
+	"io"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// A SplitStrategy says how SplitPuzzle divides a puzzle's picture.
+type SplitStrategy int
+
+const (
+	// A grid of cells as nearly square as the number of parts allows
+	SplitGrid SplitStrategy = iota
+	// Side by side, each the full height of the picture
+	SplitColumns
+	// One above another, each its full width
+	SplitRows
+)
+
+// SplitPuzzle splits the puzzle src into at most parts smaller puzzles, by
+// dividing its picture into that many regions of the same size, as strategy
+// says, and putting each piece in the region which its centre (by its
+// offset and size) is in. Each part is written next to src, with a name
+// like "src-1.puzzle", numbered from 1 across and then down; a region
+// which no piece falls in gets no puzzle, so there may be fewer. SplitPuzzle
+// returns the names of those it wrote.
+//
+// Each part's image.jpg is the region of src's, widened to take in the
+// whole of each of its pieces, and its pieces are numbered from 0 in their
+// old order, with offsets into that image. Its pala.desktop has src's
+// metadata, with "(1 of 4)" and so on after the title, and the new
+// PieceCount. Other members are copied into every part, but CHECKSUMS and
+// SIGNATURE, which would not match. The source needs an image.jpg that can
+// be decoded.
+//
+// SplitPuzzle heeds the writing options (see Option). Under DryRun, the
+// Plan describes all the parts.
+func SplitPuzzle(src string, parts int, strategy SplitStrategy, opts ...Option) ([]string, error) {
+	if parts < 1 {
+		return nil, &Error{"split", src, fmt.Errorf("palapuzzle: %d parts is too few", parts)}
+	}
+	if strategy != SplitGrid && strategy != SplitColumns && strategy != SplitRows {
+		return nil, &Error{"split", src, fmt.Errorf("palapuzzle: unknown SplitStrategy %d", strategy)}
+	}
+	s, err := openMergeSource(src)
+	if err != nil {
+		return nil, err
+	}
+	sizes, err := pieceSizes(src, s.nums)
+	if err != nil {
+		return nil, err
+	}
+	box := s.img.Bounds()
+	cols, rows := splitCells(parts, box.Dx(), box.Dy(), strategy)
+	offsets := s.info.desktop.pieceOffsets()
+	cell := func(col, row int) image.Rectangle {
+		return image.Rect(
+			box.Min.X+col*box.Dx()/cols, box.Min.Y+row*box.Dy()/rows,
+			box.Min.X+(col+1)*box.Dx()/cols, box.Min.Y+(row+1)*box.Dy()/rows)
+	}
+
+	// Each region's pieces, in order, and the area they cover
+	nums := make([][]int, cols*rows)
+	areas := make([]image.Rectangle, cols*rows)
+	for i := range areas {
+		areas[i] = cell(i%cols, i/cols)
+	}
+	for _, n := range s.nums {
+		r := image.Rectangle{Min: offsets[n], Max: offsets[n].Add(sizes[n])}
+		mid := r.Min.Add(r.Max).Div(2).Sub(box.Min)
+		col := min(max(mid.X*cols/max(box.Dx(), 1), 0), cols-1)
+		row := min(max(mid.Y*rows/max(box.Dy(), 1), 0), rows-1)
+		i := row*cols + col
+		nums[i] = append(nums[i], n)
+		areas[i] = areas[i].Union(r)
+	}
+	var used []int
+	for i := range nums {
+		if len(nums[i]) > 0 {
+			used = append(used, i)
+		}
+	}
+
+	o := getOptions(opts)
+	var plan *Plan
+	if o.dryRun != nil {
+		plan = o.dryRun
+		*plan = Plan{}
+	}
+	var ret []string
+	for k, i := range used {
+		dst := strings.TrimSuffix(src, ".puzzle") + "-" + strconv.Itoa(k+1) + ".puzzle"
+		area := areas[i].Intersect(box)
+		if area.Empty() {
+			area = cell(i%cols, i/cols)
+		}
+		crop := image.NewRGBA(image.Rectangle{Max: area.Size()})
+		draw.Draw(crop, crop.Bounds(), s.img, area.Min, draw.Src)
+		var jpg bytes.Buffer
+		if err := jpeg.Encode(&jpg, crop, &jpeg.Options{Quality: imageQuality}); err != nil {
+			return ret, &Error{"encode member image.jpg of", dst, err}
+		}
+		partOffsets := make([]image.Point, len(nums[i]))
+		for j, n := range nums[i] {
+			partOffsets[j] = offsets[n].Sub(area.Min)
+		}
+		pi := s.info
+		desk := newDesktop(Metadata{
+			Title:   strings.TrimSpace(fmt.Sprintf("%s (%d of %d)", pi.Title, k+1, len(used))),
+			Author:  pi.Author,
+			Comment: pi.Comment,
+			AltText: pi.AltText,
+		}, partOffsets)
+		part := &mergeSource{path: src, nums: nums[i]}
+		if plan != nil {
+			o.dryRun = new(Plan)
+		}
+		err := writePuzzle(dst, gzip.DefaultCompression, o,
+			func() ([]memberSummary, error) { return summarizeExisting(dst) },
+			func(out io.Writer, level int, o *options) error {
+				return mergeTo(out, dst, []*mergeSource{part}, jpg.Bytes(), desk, level, o)
+			})
+		if err != nil {
+			return ret, err
+		}
+		if plan != nil {
+			plan.Files = append(plan.Files, o.dryRun.Files...)
+			plan.Members = append(plan.Members, o.dryRun.Members...)
+			plan.Keys = append(plan.Keys, o.dryRun.Keys...)
+		}
+		ret = append(ret, dst)
+	}
+	return ret, nil
+}
+
+// splitCells returns how many columns and rows of cells SplitPuzzle divides
+// a w×h picture into, to make parts of them as strategy says.
+func splitCells(parts, w, h int, strategy SplitStrategy) (cols, rows int) {
+	switch strategy {
+	case SplitColumns:
+		return parts, 1
+	case SplitRows:
+		return 1, parts
+	}
+	cols, rows = parts, 1
+	best := math.Inf(1)
+	for r := 1; r <= parts; r++ {
+		if parts%r != 0 {
+			continue
+		}
+		c := parts / r
+		// How far from square the cells are: 0 for square ones
+		if d := math.Abs(math.Log(float64(w*r+1) / float64(h*c+1))); d < best {
+			cols, rows, best = c, r, d
+		}
+	}
+	return cols, rows
+}
+
+// pieceSizes returns the sizes in pixels of the pieces numbered nums in the
+// puzzle at path, from their PNG headers; those which cannot be read as PNG
+// files are left out.
+func pieceSizes(path string, nums []int) (map[int]image.Point, error) {
+	want := make(map[int]bool, len(nums))
+	for _, n := range nums {
+		want[n] = true
+	}
+	ret := make(map[int]image.Point, len(nums))
+	err := walkPuzzle(path, func(hdr *tar.Header, r io.Reader) error {
+		m := rePieceName.FindStringSubmatch(hdr.Name)
+		if m == nil {
+			return nil
+		}
+		n, err := strconv.Atoi(m[1])
+		if err != nil || !want[n] {
+			return nil
+		}
+		want[n] = false // Only the first of each number counts
+		if cfg, err := png.DecodeConfig(r); err == nil {
+			ret[n] = image.Pt(cfg.Width, cfg.Height)
+		}
+		return nil
+	})
+	return ret, err
+}
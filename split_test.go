@@ -0,0 +1,125 @@
+package palapuzzle
+
+import (
+	"fmt"
+	"image"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+
+	"github.com/c12h/palapuzzle/palapuzzletest"
+)
+
+func TestSplitPuzzle(t *testing.T) {
+	// Four by four pieces of 32×32 pixels
+	spec := palapuzzletest.Spec{Cols: 4, Rows: 4}
+	old := make(map[int]string) // The pieces' content
+	for _, m := range readMembers(t, palapuzzletest.File(t, spec)) {
+		if sub := rePieceName.FindStringSubmatch(m.Name); sub != nil {
+			n, _ := strconv.Atoi(sub[1])
+			old[n] = m.Body
+		}
+	}
+	// Where each part's pieces are, as in any 2×2 block of the grid
+	block := []image.Point{{0, 0}, {32, 0}, {0, 32}, {32, 32}}
+
+	for _, tc := range []struct {
+		parts   int
+		size    image.Point     // Each part's picture's
+		pieces  [][]int         // The old numbers of each part's pieces
+		offsets [][]image.Point // Their offsets in the part
+	}{
+		// Two columns, as two rows would be no squarer
+		{2, image.Pt(64, 128), [][]int{{0, 1, 4, 5, 8, 9, 12, 13}, {2, 3, 6, 7, 10, 11, 14, 15}}, [][]image.Point{
+			append(block, block[0].Add(image.Pt(0, 64)), block[1].Add(image.Pt(0, 64)),
+				block[2].Add(image.Pt(0, 64)), block[3].Add(image.Pt(0, 64))),
+			nil, // The same
+		}},
+		{4, image.Pt(64, 64), [][]int{{0, 1, 4, 5}, {2, 3, 6, 7}, {8, 9, 12, 13}, {10, 11, 14, 15}}, [][]image.Point{
+			block, block, block, block,
+		}},
+	} {
+		t.Run(strconv.Itoa(tc.parts), func(t *testing.T) {
+			src := filepath.Join(t.TempDir(), "grid.puzzle")
+			os.WriteFile(src, palapuzzletest.Bytes(spec), 0644)
+
+			var plan Plan
+			names, err := SplitPuzzle(src, tc.parts, SplitGrid, DryRun(&plan))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(names) != tc.parts || len(plan.Files) != tc.parts {
+				t.Fatalf("DryRun: names %q, Plan.Files %v; want %d of each", names, plan.Files, tc.parts)
+			}
+			desktops := 0
+			for _, d := range plan.Members {
+				if d.Member == "pala.desktop" {
+					desktops++
+				}
+			}
+			for i, fc := range plan.Files {
+				if fc.Path != names[i] || fc.Action != "create" {
+					t.Errorf("Plan.Files[%d] = %v, want to create %s", i, fc, names[i])
+				}
+				if _, err := os.Stat(names[i]); err == nil {
+					t.Errorf("DryRun wrote %s", names[i])
+				}
+			}
+			if desktops != tc.parts {
+				t.Errorf("Plan.Members has %d pala.desktop changes, want %d", desktops, tc.parts)
+			}
+
+			names, err = SplitPuzzle(src, tc.parts, SplitGrid)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(names) != tc.parts {
+				t.Fatalf("wrote %q, want %d parts", names, tc.parts)
+			}
+			for k, name := range names {
+				if want := filepath.Join(filepath.Dir(src), fmt.Sprintf("grid-%d.puzzle", k+1)); name != want {
+					t.Errorf("part %d is %s, want %s", k+1, name, want)
+				}
+				pi, err := ScanPuzzle(name)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if len(pi.Warnings) != 0 {
+					t.Errorf("part %d has warnings %v", k+1, pi.Warnings)
+				}
+				nums := tc.pieces[k]
+				if pi.NPieceFiles != len(nums) || pi.NPiecesDecl != len(nums) {
+					t.Errorf("part %d has %d pieces, PieceCount %d; want %d", k+1, pi.NPieceFiles, pi.NPiecesDecl, len(nums))
+				}
+				if want := fmt.Sprintf("Test puzzle (%d of %d)", k+1, tc.parts); pi.Title != want {
+					t.Errorf("part %d has Title %q, want %q", k+1, pi.Title, want)
+				}
+				want := tc.offsets[k]
+				if want == nil {
+					want = tc.offsets[0]
+				}
+				got := pi.desktop.pieceOffsets()
+				if len(got) != len(want) {
+					t.Errorf("part %d has offsets %v, want %v", k+1, got, want)
+				}
+				members := make(map[string]string)
+				for _, m := range readMembers(t, name) {
+					members[m.Name] = m.Body
+				}
+				for j, n := range nums {
+					if got[j] != want[j] {
+						t.Errorf("part %d: piece %d (was %d) has offset %v, want %v", k+1, j, n, got[j], want[j])
+					}
+					if members[strconv.Itoa(j)+".png"] != old[n] {
+						t.Errorf("part %d: %d.png is not %d.png", k+1, j, n)
+					}
+				}
+				// Each part is cropped to its pieces
+				if got := image.Pt(pi.ImageWidth, pi.ImageHeight); got != tc.size {
+					t.Errorf("part %d's image is %v, want %v", k+1, got, tc.size)
+				}
+			}
+		})
+	}
+}
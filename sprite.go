@@ -0,0 +1,150 @@
+package palapuzzle
+
+import (
+	"encoding/json"
+	"fmt"
+	"image"
+	"image/draw"
+	"image/png"
+	"os"
+	"path/filepath"
+	"sort"
+)
+
+// SpriteSheetSize is the width and height of the sprite sheets made by
+// ExportSprites when it is given no size: small enough for any browser to
+// hold as a texture.
+const SpriteSheetSize = 2048
+
+// spritePadding is the gap left around each piece on a sprite sheet, so
+// that scaled drawing does not bleed one piece's pixels into the next.
+const spritePadding = 1
+
+// An Atlas says where ExportSprites put each piece of a puzzle. It is
+// written beside the sheets as atlas.json.
+type Atlas struct {
+	Title  string `json:"title"`
+	Author string `json:"author"`
+	// The size of the solved puzzle, if its pieces have offsets
+	Width  int `json:"width,omitempty"`
+	Height int `json:"height,omitempty"`
+	// The sprite sheets' filenames, in the same directory as atlas.json
+	Sheets []string      `json:"sheets"`
+	Pieces []AtlasSprite `json:"pieces"`
+}
+
+// An AtlasSprite is where one piece is on a sprite sheet.
+type AtlasSprite struct {
+	Piece  int `json:"piece"` // Its number, as in N.png
+	Sheet  int `json:"sheet"` // Which of the Atlas's sheets it is on
+	X      int `json:"x"`
+	Y      int `json:"y"`
+	Width  int `json:"w"`
+	Height int `json:"h"`
+	// Where its top-left corner goes in the solved puzzle, from pala.desktop;
+	// nil if the puzzle does not say
+	Offset *[2]int `json:"offset"`
+}
+
+// ExportSprites packs the pieces of the puzzle at path into PNG sprite
+// sheets of at most size×size pixels (SpriteSheetSize if size is 0), written
+// to dir as sheet0.png, sheet1.png and so on, with an Atlas written there as
+// atlas.json, so that a puzzle player in a browser can load the whole puzzle
+// in a few requests. Pieces are packed in rows, tallest first. It returns
+// the atlas.
+func ExportSprites(path, dir string, size int) (*Atlas, error) {
+	if size == 0 {
+		size = SpriteSheetSize
+	}
+	pi, err := ScanPuzzle(path)
+	if err != nil {
+		return nil, err
+	}
+	pc, err := readContent(path)
+	if err != nil {
+		return nil, err
+	}
+	atlas := &Atlas{Title: pi.Title, Author: pi.Author, Sheets: []string{}, Pieces: []AtlasSprite{}}
+	if area, err := pc.bounds(); err == nil {
+		atlas.Width, atlas.Height = area.Dx(), area.Dy()
+	}
+
+	nums := make([]int, 0, len(pc.pieces))
+	for n := range pc.pieces {
+		nums = append(nums, n)
+	}
+	sort.Slice(nums, func(i, j int) bool {
+		hi, hj := pc.pieces[nums[i]].Bounds().Dy(), pc.pieces[nums[j]].Bounds().Dy()
+		if hi != hj {
+			return hi > hj
+		}
+		return nums[i] < nums[j]
+	})
+
+	// Shelf packing: pieces go left to right along a row as tall as its
+	// first piece, and a new sheet is started when a row will not fit.
+	var sheets []*image.NRGBA
+	var used []image.Point // How much of each sheet is used, for cropping
+	x, y, rowH := size, 0, 0
+	for _, n := range nums {
+		img := pc.pieces[n]
+		b := img.Bounds()
+		w, h := b.Dx()+2*spritePadding, b.Dy()+2*spritePadding
+		if w > size || h > size {
+			return nil, &Error{"pack pieces of", path,
+				fmt.Errorf("piece %d is %dx%d, too big for a %dx%d sheet", n, b.Dx(), b.Dy(), size, size)}
+		}
+		if x+w > size {
+			x, y, rowH = 0, y+rowH, h
+		}
+		if len(sheets) == 0 || y+h > size {
+			sheets = append(sheets, image.NewNRGBA(image.Rect(0, 0, size, size)))
+			used = append(used, image.Point{})
+			x, y, rowH = 0, 0, h
+		}
+		s := len(sheets) - 1
+		dst := image.Rect(x+spritePadding, y+spritePadding, x+w-spritePadding, y+h-spritePadding)
+		draw.Draw(sheets[s], dst, img, b.Min, draw.Src)
+		used[s] = image.Pt(max(used[s].X, x+w), max(used[s].Y, y+h))
+		sp := AtlasSprite{Piece: n, Sheet: s, X: dst.Min.X, Y: dst.Min.Y, Width: b.Dx(), Height: b.Dy()}
+		if off, ok := pc.offsets[n]; ok {
+			sp.Offset = &[2]int{off.X, off.Y}
+		}
+		atlas.Pieces = append(atlas.Pieces, sp)
+		x += w
+	}
+	sort.Slice(atlas.Pieces, func(i, j int) bool { return atlas.Pieces[i].Piece < atlas.Pieces[j].Piece })
+
+	for i, sheet := range sheets {
+		name := fmt.Sprintf("sheet%d.png", i)
+		if err := writeSheet(filepath.Join(dir, name), sheet.SubImage(image.Rectangle{Max: used[i]})); err != nil {
+			return nil, err
+		}
+		atlas.Sheets = append(atlas.Sheets, name)
+	}
+	data, err := json.MarshalIndent(atlas, "", "\t")
+	if err != nil {
+		return nil, err
+	}
+	p := filepath.Join(dir, "atlas.json")
+	if err := os.WriteFile(p, append(data, '\n'), 0644); err != nil {
+		return nil, &Error{"write atlas", p, err}
+	}
+	return atlas, nil
+}
+
+// writeSheet writes the sprite sheet img to a new PNG file at path.
+func writeSheet(path string, img image.Image) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return &Error{"create sprite sheet", path, err}
+	}
+	if err := png.Encode(f, img); err != nil {
+		f.Close()
+		return &Error{"write sprite sheet", path, err}
+	}
+	if err := f.Close(); err != nil {
+		return &Error{"write sprite sheet", path, err}
+	}
+	return nil
+}
@@ -0,0 +1,228 @@
+package palapuzzle
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"image"
+	"io"
+	"io/fs"
+	"os"
+	"sort"
+	"strings"
+	"time"
+)
+
+// savePositionsGroup is the group of a Palapeli savegame holding where
+// each piece is, as N=x,y.
+const savePositionsGroup = "XYCo-ordinates"
+
+// A Progress is how far a game of a puzzle has got.
+type Progress struct {
+	Pieces int // How many pieces the puzzle has
+	Placed int // How many are joined to at least one other piece
+}
+
+// Done reports whether the puzzle is finished.
+func (p *Progress) Done() bool {
+	return p.Pieces > 0 && p.Placed == p.Pieces
+}
+
+// Progress reads Palapeli's savegame for the named puzzle in c, which is
+// kept beside it with ".save" in place of ".puzzle", and works out how far
+// the game has got. Pieces count as placed once they have been joined to
+// another piece, which shows in the savegame as their positions being the
+// same distance from their places in the solved puzzle (given by its
+// piece offsets). If there is no savegame, the error satisfies
+// errors.Is(err, fs.ErrNotExist).
+func (c *Collection) Progress(name string) (*Progress, error) {
+	b, p := c.backend(), c.Path(name)
+	pi, err := ScanBackend(b, p)
+	if err != nil {
+		return nil, err
+	}
+	save := c.Path(strings.TrimSuffix(name, ".puzzle") + ".save")
+	r, err := b.Open(save)
+	if err != nil {
+		return nil, &Error{"open savegame", save, err}
+	}
+	data, err := io.ReadAll(r)
+	r.Close()
+	if err != nil {
+		return nil, &Error{"read savegame", save, err}
+	}
+	pos := parseDesktop(data).points(savePositionsGroup)
+	var offsets map[int]image.Point
+	if pi.desktop != nil {
+		offsets = pi.desktop.pieceOffsets()
+	}
+	return &Progress{Pieces: pi.NPieceFiles, Placed: placedPieces(pos, offsets)}, nil
+}
+
+// placedPieces counts the pieces which are in the same place relative to
+// at least one other piece as in the solved puzzle.
+func placedPieces(pos, offsets map[int]image.Point) int {
+	shifts := make(map[image.Point]int)
+	for n, p := range pos {
+		if off, ok := offsets[n]; ok {
+			shifts[p.Sub(off)]++
+		}
+	}
+	placed := 0
+	for _, k := range shifts {
+		if k > 1 {
+			placed += k
+		}
+	}
+	return placed
+}
+
+// A StatsDB is a record of the progress of games over time, kept in a local
+// file of JSON lines, which can answer questions like "how many pieces were
+// placed this month?" Snapshots are only ever added to the file.
+type StatsDB struct {
+	Path string
+}
+
+// A Snapshot is the progress of one game at one time.
+type Snapshot struct {
+	Time   time.Time `json:"time"`
+	Puzzle string    `json:"puzzle"` // The puzzle's Backend name
+	Pieces int       `json:"pieces"`
+	Placed int       `json:"placed"`
+}
+
+// Record adds a snapshot of each game in c that has progressed since it was
+// last recorded (or has never been), and returns how many it added. Puzzles
+// without savegames are skipped. Savegames which cannot be read are too,
+// and their errors joined into the returned error.
+func (db *StatsDB) Record(c *Collection) (int, error) {
+	old, err := db.Snapshots()
+	if err != nil {
+		return 0, err
+	}
+	last := make(map[string]Snapshot)
+	for _, s := range old {
+		last[s.Puzzle] = s
+	}
+	names, err := c.List()
+	if err != nil {
+		return 0, err
+	}
+	now := time.Now().UTC()
+	var add []Snapshot
+	var errs []error
+	for _, name := range names {
+		p, err := c.Progress(name)
+		if errors.Is(err, fs.ErrNotExist) {
+			continue
+		} else if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		s := Snapshot{now, c.Path(name), p.Pieces, p.Placed}
+		if l, ok := last[s.Puzzle]; ok && l.Pieces == s.Pieces && l.Placed == s.Placed {
+			continue
+		}
+		add = append(add, s)
+	}
+	if len(add) == 0 {
+		return 0, errors.Join(errs...)
+	}
+	f, err := os.OpenFile(db.Path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0644)
+	if err != nil {
+		return 0, &Error{"open stats", db.Path, err}
+	}
+	enc := json.NewEncoder(f)
+	for _, s := range add {
+		if err := enc.Encode(s); err != nil {
+			f.Close()
+			return 0, &Error{"write stats", db.Path, err}
+		}
+	}
+	if err := f.Close(); err != nil {
+		return 0, &Error{"write stats", db.Path, err}
+	}
+	return len(add), errors.Join(errs...)
+}
+
+// Snapshots returns every snapshot in db, oldest first.
+func (db *StatsDB) Snapshots() ([]Snapshot, error) {
+	f, err := os.Open(db.Path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	} else if err != nil {
+		return nil, &Error{"open stats", db.Path, err}
+	}
+	defer f.Close()
+	var ret []Snapshot
+	sc := bufio.NewScanner(f)
+	for sc.Scan() {
+		var s Snapshot
+		if err := json.Unmarshal(sc.Bytes(), &s); err != nil {
+			return nil, &Error{"parse stats", db.Path, err}
+		}
+		ret = append(ret, s)
+	}
+	if err := sc.Err(); err != nil {
+		return nil, &Error{"read stats", db.Path, err}
+	}
+	sort.SliceStable(ret, func(i, j int) bool { return ret[i].Time.Before(ret[j].Time) })
+	return ret, nil
+}
+
+// PiecesPlaced returns how many pieces were placed, in all games together,
+// between snapshots taken from from up to (but not including) to. Progress
+// made before a game was first recorded is not counted, and pieces taken
+// apart again are subtracted.
+func (db *StatsDB) PiecesPlaced(from, to time.Time) (int, error) {
+	all, err := db.Snapshots()
+	if err != nil {
+		return 0, err
+	}
+	last := make(map[string]Snapshot)
+	total := 0
+	for _, s := range all {
+		if l, ok := last[s.Puzzle]; ok && !s.Time.Before(from) && s.Time.Before(to) {
+			total += s.Placed - l.Placed
+		}
+		last[s.Puzzle] = s
+	}
+	return total, nil
+}
+
+// AverageTimeToFinish returns the average time taken to finish puzzles with
+// from minPieces to maxPieces pieces, from the first snapshot of each game to
+// the first showing it finished, and how many games that is over. Games
+// which were already finished when first recorded are not counted.
+func (db *StatsDB) AverageTimeToFinish(minPieces, maxPieces int) (time.Duration, int, error) {
+	all, err := db.Snapshots()
+	if err != nil {
+		return 0, 0, err
+	}
+	first := make(map[string]Snapshot)
+	done := make(map[string]bool)
+	var sum time.Duration
+	n := 0
+	for _, s := range all {
+		if s.Pieces < minPieces || s.Pieces > maxPieces || done[s.Puzzle] {
+			continue
+		}
+		p := Progress{s.Pieces, s.Placed}
+		f, ok := first[s.Puzzle]
+		if !ok {
+			first[s.Puzzle] = s
+			done[s.Puzzle] = p.Done() // Too late to tell how long it took
+			continue
+		}
+		if p.Done() {
+			done[s.Puzzle] = true
+			sum += s.Time.Sub(f.Time)
+			n++
+		}
+	}
+	if n == 0 {
+		return 0, 0, nil
+	}
+	return sum / time.Duration(n), n, nil
+}
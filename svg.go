@@ -0,0 +1,76 @@
+package palapuzzle
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+)
+
+// CutLineWidth is the width, in millimetres, of the lines ExportCutSVG
+// draws: a hairline, which laser cutters and plotters take as a cut.
+const CutLineWidth = 0.1
+
+// ExportCutSVG writes an SVG drawing of the lines along which the puzzle at
+// path is cut to w, and nothing else, at a printed width of widthMM
+// millimetres, for laser cutters and cutting plotters. The lines are the
+// boundaries of the pieces, found from their pixels at their offsets, so
+// they include the outline of the whole puzzle and follow each piece's
+// pixels exactly (which at any usual scale is far finer than a cutter can
+// follow). Each boundary between two pieces is drawn once.
+func ExportCutSVG(path string, w io.Writer, widthMM float64) error {
+	pc, err := readContent(path)
+	if err != nil {
+		return err
+	}
+	area, err := pc.bounds()
+	if err != nil {
+		return &Error{"trace pieces of", path, err}
+	}
+	if widthMM <= 0 {
+		return &Error{"scale cut lines of", path, fmt.Errorf("width %gmm is not positive", widthMM)}
+	}
+	pw, ph := area.Dx(), area.Dy()
+	owner := pc.owners(area)
+	at := func(x, y int) int32 {
+		if x < 0 || y < 0 || x >= pw || y >= ph {
+			return -1
+		}
+		return owner[y*pw+x]
+	}
+
+	bw := bufio.NewWriter(w)
+	mmPerPixel := widthMM / float64(pw)
+	fmt.Fprintf(bw, `<?xml version="1.0" encoding="UTF-8"?>`+"\n")
+	fmt.Fprintf(bw, `<svg xmlns="http://www.w3.org/2000/svg" width="%gmm" height="%gmm" viewBox="0 0 %d %d">`+"\n",
+		widthMM, float64(ph)*mmPerPixel, pw, ph)
+	fmt.Fprintf(bw, `<path fill="none" stroke="#000" stroke-width="%g" stroke-linecap="square" d="`,
+		CutLineWidth/mmPerPixel)
+	// Horizontal edges: between rows y-1 and y, merged into runs.
+	for y := 0; y <= ph; y++ {
+		start := -1
+		for x := 0; x <= pw; x++ {
+			cut := x < pw && at(x, y-1) != at(x, y)
+			if cut && start < 0 {
+				start = x
+			} else if !cut && start >= 0 {
+				fmt.Fprintf(bw, "M%d %dH%d", start, y, x)
+				start = -1
+			}
+		}
+	}
+	// Vertical edges: between columns x-1 and x.
+	for x := 0; x <= pw; x++ {
+		start := -1
+		for y := 0; y <= ph; y++ {
+			cut := y < ph && at(x-1, y) != at(x, y)
+			if cut && start < 0 {
+				start = y
+			} else if !cut && start >= 0 {
+				fmt.Fprintf(bw, "M%d %dV%d", x, start, y)
+				start = -1
+			}
+		}
+	}
+	fmt.Fprintf(bw, "\"/>\n</svg>\n")
+	return bw.Flush()
+}
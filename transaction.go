@@ -0,0 +1,156 @@
+package palapuzzle
+
+import (
+	"errors"
+	"io"
+	"sync"
+)
+
+// A Transaction groups changes to several puzzles so that either all of them
+// are made or none are. Functions given the InTransaction option write their
+// new puzzles to temporary files as usual, but leave them there instead of
+// renaming them into place; Commit then renames them all, or Rollback
+// deletes them all.
+//
+// Each temporary file is held open until the Transaction ends. A puzzle
+// cannot be changed twice in one Transaction, since the second change would
+// not see the first.
+type Transaction struct {
+	mu     sync.Mutex
+	staged []stagedFile
+	dsts   map[string]bool
+	after  []func() error // Run once the staged puzzles are in place
+	done   bool
+}
+
+// A stagedFile is a new puzzle waiting to be renamed into place.
+type stagedFile struct {
+	dst string
+	w   io.WriteCloser
+}
+
+// ErrTransactionDone is returned when a Transaction is used after Commit or
+// Rollback.
+var ErrTransactionDone = errors.New("palapuzzle: transaction already ended")
+
+// errStaged means that a puzzle has already been changed in a Transaction.
+var errStaged = errors.New("palapuzzle: already changed in this transaction")
+
+// InTransaction makes functions which write puzzles stage them in tx, to be
+// made visible by tx.Commit, rather than replacing them straight away.
+func InTransaction(tx *Transaction) Option {
+	return func(o *options) { o.tx = tx }
+}
+
+// Transact calls fn with an InTransaction option for a new Transaction,
+// which fn should pass to each function it calls. If fn succeeds the
+// Transaction is committed; otherwise it is rolled back and fn's error
+// returned.
+func Transact(fn func(tx Option) error) error {
+	tx := &Transaction{}
+	if err := fn(InTransaction(tx)); err != nil {
+		tx.Rollback()
+		return err
+	}
+	return tx.Commit()
+}
+
+// check reports an error if dst cannot be changed in tx.
+func (tx *Transaction) check(dst string) error {
+	tx.mu.Lock()
+	defer tx.mu.Unlock()
+	if tx.done {
+		return ErrTransactionDone
+	}
+	if tx.dsts[dst] {
+		return errStaged
+	}
+	return nil
+}
+
+// stage adds w, a completely written new version of dst, to tx.
+func (tx *Transaction) stage(dst string, w io.WriteCloser) error {
+	tx.mu.Lock()
+	defer tx.mu.Unlock()
+	if tx.done {
+		return ErrTransactionDone
+	}
+	if tx.dsts[dst] {
+		return errStaged
+	}
+	if tx.dsts == nil {
+		tx.dsts = make(map[string]bool)
+	}
+	tx.dsts[dst] = true
+	tx.staged = append(tx.staged, stagedFile{dst, w})
+	return nil
+}
+
+// afterCommit has tx call fn once Commit has put every staged puzzle in
+// place, as to record the changes in a Collection's journal.
+func (tx *Transaction) afterCommit(fn func() error) {
+	tx.mu.Lock()
+	defer tx.mu.Unlock()
+	tx.after = append(tx.after, fn)
+}
+
+// Commit puts every staged puzzle in place, and then records any changes to
+// Collections which keep journals. If putting any in place fails (which
+// should only happen if the disk or server fails), the rest are discarded,
+// nothing is recorded, and the errors are returned.
+func (tx *Transaction) Commit() error {
+	tx.mu.Lock()
+	defer tx.mu.Unlock()
+	if tx.done {
+		return ErrTransactionDone
+	}
+	tx.done = true
+	var errs []error
+	for _, sf := range tx.staged {
+		if len(errs) > 0 {
+			abort(sf.w)
+		} else if err := sf.w.Close(); err != nil {
+			errs = append(errs, &Error{"write", sf.dst, err})
+		}
+	}
+	if len(errs) > 0 {
+		return errors.Join(errs...)
+	}
+	for _, fn := range tx.after {
+		if err := fn(); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// Rollback discards every staged puzzle, leaving the originals as they were.
+// It does nothing after Commit.
+func (tx *Transaction) Rollback() error {
+	tx.mu.Lock()
+	defer tx.mu.Unlock()
+	if tx.done {
+		return nil
+	}
+	tx.done = true
+	for _, sf := range tx.staged {
+		abort(sf.w)
+	}
+	return nil
+}
+
+// finishWrite completes out, the new content of dst: it is staged if o has
+// a Transaction, or else closed so that it takes effect.
+func finishWrite(out io.WriteCloser, dst string, o *options) error {
+	if o.tx != nil {
+		if err := o.tx.stage(dst, out); err != nil {
+			abort(out)
+			return &Error{"write", dst, err}
+		}
+		return nil
+	}
+	if err := out.Close(); err != nil {
+		return &Error{"write", dst, err}
+	}
+	return nil
+}
@@ -0,0 +1,84 @@
+package palapuzzle
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"errors"
+	"io"
+	"time"
+)
+
+// UpdateMember rewrites the puzzle at path, in place, with content as its
+// member of the given name: a better image.jpg, say, or a fixed copy of one
+// corrupt piece. The new member takes the place of the first one with that
+// name, keeping its mode (any later ones are dropped); if there is none, it
+// is added at the end. Every other member is copied unchanged, except that
+// a CHECKSUMS or SIGNATURE member no longer matches, so run WriteChecksums
+// or Sign again afterwards. Names which would be unsafe to unpack (see
+// ScanPuzzle) are refused. UpdateMember heeds the writing options (see
+// Option).
+func UpdateMember(path, name string, content io.Reader, opts ...Option) error {
+	hdr := &tar.Header{Name: name, Typeflag: tar.TypeReg}
+	if name == "" {
+		return &Error{"update member of", path, errors.New("palapuzzle: no member name")}
+	}
+	if why := unsafeMember(hdr); why != "" {
+		return &Error{"update member " + name + " of", path, errors.New("palapuzzle: unsafe member name: " + why)}
+	}
+	// The content is read first, as its size goes in the header, and the
+	// puzzle may be written more than once (under Reproducible, say).
+	data, err := io.ReadAll(content)
+	if err != nil {
+		return &Error{"read new member " + name + " for", path, err}
+	}
+	return writePuzzle(path, gzip.DefaultCompression, getOptions(opts),
+		func() ([]memberSummary, error) { return summarize(path) },
+		func(out io.Writer, level int, o *options) error {
+			return updateTo(out, path, name, data, level, o)
+		})
+}
+
+// updateTo does the work of UpdateMember, writing to out.
+func updateTo(out io.Writer, path, name string, data []byte, level int, o *options) error {
+	zw, err := newGzipWriter(out, level, o)
+	if err != nil {
+		return &Error{"create", path, err}
+	}
+	tw := tar.NewWriter(zw)
+	now := time.Now()
+	written := false
+	err = walkPuzzle(path, func(hdr *tar.Header, r io.Reader) error {
+		var err error
+		switch {
+		case hdr.Name != name:
+			err = copyMember(hdr, r, tw)
+		case !written:
+			tmpl := *hdr
+			tmpl.Typeflag, tmpl.Linkname, tmpl.ModTime = tar.TypeReg, "", now
+			err = writeMember(tw, name, data, &tmpl)
+			written = true
+		}
+		if err != nil {
+			return &Error{"rewrite member " + hdr.Name + " of", path, err}
+		}
+		return nil
+	})
+	if err == nil && !written {
+		tmpl := &tar.Header{Typeflag: tar.TypeReg, Mode: 0644, ModTime: now}
+		if err = writeMember(tw, name, data, tmpl); err != nil {
+			err = &Error{"write member " + name + " of", path, err}
+		}
+	}
+	if err != nil {
+		zw.Close() // Stop any goroutines; output is discarded anyway
+		return err
+	}
+	if err := tw.Close(); err != nil {
+		zw.Close()
+		return &Error{"write", path, err}
+	}
+	if err := zw.Close(); err != nil {
+		return &Error{"write", path, err}
+	}
+	return nil
+}
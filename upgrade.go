@@ -0,0 +1,145 @@
+package palapuzzle
+
+import (
+	"compress/gzip"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// UpgradePuzzle rewrites the puzzle at path, in place, in the layout of
+// FormatModern, and reports whether anything needed changing. Slicer
+// settings lose their position prefixes and are moved into the [SlicerArgs]
+// group, and a puzzle which records no piece count at all is given one,
+// from the number of pieces it has. Every other key, comment and member is
+// kept as it was. UpgradePuzzle heeds the writing options (see Option).
+func UpgradePuzzle(path string, opts ...Option) (bool, error) {
+	pi, err := ScanPuzzle(path)
+	if err != nil {
+		return false, err
+	}
+	if pi.desktop == nil {
+		return false, &Error{"find member pala.desktop in", path, nil}
+	}
+	if !pi.desktop.upgrade(pi.NPieceFiles) {
+		return false, nil
+	}
+	err = rewritePuzzle(path, path, gzip.DefaultCompression, getOptions(opts),
+		rewriteDesktop(pi.desktop, nil))
+	if err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// upgrade changes d to the modern layout, as UpgradePuzzle describes, and
+// reports whether anything changed. nPieces is used as the piece count if
+// d has none.
+func (d *desktopFile) upgrade(nPieces int) bool {
+	if d.formatVersion() == FormatModern {
+		return false
+	}
+	type setting struct{ key, value string }
+	var moved []setting
+	changed := false
+	have := make(map[string]bool) // Plain keys in [SlicerArgs]
+	for _, l := range d.lines {
+		if l.isKey && l.group == slicerGroup && !reNumberedKey.MatchString(l.key) {
+			have[l.key] = true
+		}
+	}
+	kept := make([]desktopLine, 0, len(d.lines))
+	for _, l := range d.lines {
+		key := l.key
+		if m := reNumberedKey.FindStringSubmatch(key); m != nil && l.isKey {
+			key = m[1]
+		}
+		switch {
+		case !l.isKey || (key == l.key && (l.group == slicerGroup || !isSlicerKey(key))):
+			kept = append(kept, l)
+		case l.group == slicerGroup:
+			// Rename it where it is, unless it is there already.
+			changed = true
+			if !have[key] {
+				have[key] = true
+				l.key, l.text = key, d.eol(key+"="+l.value)
+				kept = append(kept, l)
+			}
+		default:
+			changed = true
+			moved = append(moved, setting{key, l.value})
+		}
+	}
+	d.lines = kept
+	for _, s := range moved {
+		if _, ok := d.get(slicerGroup, s.key); !ok {
+			d.set(slicerGroup, s.key, s.value)
+		}
+	}
+	if _, ok := d.get(slicerGroup, "PieceCount"); !ok && nPieces > 0 {
+		d.set(slicerGroup, "PieceCount", strconv.Itoa(nPieces))
+		changed = true
+	}
+	return changed
+}
+
+// legacySlicerKeys are the names Palapeli 1.x gives the standard slicer
+// settings.
+var legacySlicerKeys = map[string]string{
+	"Flexibility": "010_Flexibility",
+	"PieceCount":  "020_PieceCount",
+	"PlugSize":    "030_PlugSize",
+}
+
+// legacyGroups are the groups of pala.desktop that Palapeli 1.x reads.
+var legacyGroups = map[string]bool{
+	"":           true, // Before the first group header
+	mainGroup:    true,
+	slicerGroup:  true,
+	offsetsGroup: true,
+}
+
+// ExportLegacy writes a copy of the puzzle src to dst in the layout of
+// FormatLegacy, for older versions of Palapeli such as the ones shipped with
+// KDE 4. Slicer settings are given their old names, with position prefixes
+// (other slicers' settings are numbered after the standard ones), and groups
+// of pala.desktop that those versions do not read are left out. The members
+// of the puzzle are copied unchanged. ExportLegacy heeds the writing options
+// (see Option).
+func ExportLegacy(src, dst string, opts ...Option) error {
+	pi, err := ScanPuzzle(src)
+	if err != nil {
+		return err
+	}
+	if pi.desktop == nil {
+		return &Error{"find member pala.desktop in", src, nil}
+	}
+	pi.desktop.downgrade()
+	return rewritePuzzle(src, dst, gzip.DefaultCompression, getOptions(opts),
+		rewriteDesktop(pi.desktop, nil))
+}
+
+// downgrade changes d to the legacy layout, as ExportLegacy describes.
+func (d *desktopFile) downgrade() {
+	d.upgrade(0) // So that every slicer setting is in [SlicerArgs], unnumbered
+	next := 10 * (len(legacySlicerKeys) + 1)
+	kept := d.lines[:0]
+	for _, l := range d.lines {
+		if !legacyGroups[l.group] {
+			continue
+		}
+		if l.isKey && l.group == slicerGroup {
+			name, ok := legacySlicerKeys[l.key]
+			if !ok {
+				name = fmt.Sprintf("%03d_%s", next, l.key)
+				next += 10
+			}
+			l.key, l.text = name, d.eol(name+"="+l.value)
+		}
+		kept = append(kept, l)
+	}
+	d.lines = kept
+	if n := len(d.lines); n > 0 && strings.TrimSpace(d.lines[n-1].text) == "" {
+		d.lines = d.lines[:n-1] // Left over from a group that was dropped
+	}
+}
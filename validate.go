@@ -0,0 +1,75 @@
+package palapuzzle
+
+// Rules are the sets of checks which Validate makes.
+type Rules uint
+
+const (
+	// What scanning finds: missing and duplicate pieces, damage to the
+	// archive, unknown members and so on
+	RuleScan Rules = 1 << iota
+	// That PieceCount matches the pieces there are
+	RulePieceCount
+	// That there is a pala.desktop, giving an offset for every piece
+	RuleManifest
+	// That every piece, and image.jpg, can be decoded; this reads them all
+	RuleImages
+
+	AllRules = RuleScan | RulePieceCount | RuleManifest | RuleImages
+)
+
+// A Report is what Validate found, sorted by how much it matters.
+type Report struct {
+	// Problems which stop the puzzle working properly: findings of
+	// SeverityError
+	Errors []Warning
+	// Cosmetic problems, and notices: findings of lesser severity
+	Warnings []Warning
+	// All of them, in the order of the rules which found them (see
+	// LintRule), with the rules' IDs; the findings of rules added by
+	// RegisterRule, which have no WarningKind, are only fully described here
+	Findings []Finding
+	// What scanning found, apart from its warnings
+	Info *PuzzleInfo
+}
+
+// OK reports whether r found nothing that stops the puzzle working.
+func (r *Report) OK() bool { return len(r.Errors) == 0 }
+
+// Validate checks the puzzle at path (or URL, as for ScanPuzzle) by the given
+// rules (AllRules if rules is 0), and reports what it finds. Each set of
+// rules stands for some of the LintRules; those added by RegisterRule are
+// part of RuleScan. Damaged archives are read as far as they go, as under
+// BestEffort, and the damage reported; the error is only for puzzles which
+// cannot be read at all.
+func Validate(path string, rules Rules) (*Report, error) {
+	if rules == 0 {
+		rules = AllRules
+	}
+	opts := []Option{BestEffort(), ReportUnknownMembers()}
+	if rules&RuleScan != 0 {
+		opts = append(opts, HashMembers()) // To find identical pieces
+	}
+	if rules&RuleImages != 0 {
+		opts = append(opts, DeepCheck())
+	}
+	pi, err := ScanPuzzle(path, opts...)
+	if err != nil {
+		return nil, err
+	}
+
+	l := &Linter{Enable: ruleIDs(rules)}
+	found, err := l.Lint(pi)
+	if err != nil {
+		return nil, err
+	}
+
+	r := &Report{Findings: found, Info: pi}
+	for _, f := range found {
+		if f.Severity == SeverityError {
+			r.Errors = append(r.Errors, f.Warning())
+		} else {
+			r.Warnings = append(r.Warnings, f.Warning())
+		}
+	}
+	return r, nil
+}
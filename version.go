@@ -0,0 +1,70 @@
+package palapuzzle
+
+import "regexp"
+
+// A FormatVersion says which generation of Palapeli a puzzle's layout comes
+// from. The generations differ in how pala.desktop is laid out; the members
+// of the archive are the same.
+//
+// Everything in this package works with puzzles of either version. Palapeli
+// 2.x reads legacy puzzles, but the slicer settings of a legacy puzzle (and
+// so its piece count) are not shown and are lost if it is re-sliced; use
+// UpgradePuzzle to fix that.
+type FormatVersion int
+
+const (
+	// The version cannot be told, because the puzzle records no slicer
+	// settings; it is readable by every version of Palapeli
+	FormatUnknown FormatVersion = iota
+	// Palapeli 1.x, as shipped with KDE 4: slicer settings have their
+	// position in the slicer's dialog as a prefix, like "020_PieceCount",
+	// and may be in the [Desktop Entry] group rather than [SlicerArgs]
+	FormatLegacy
+	// Palapeli 2.x and later: slicer settings have plain names, like
+	// "PieceCount", in the [SlicerArgs] group
+	FormatModern
+)
+
+// slicerGroup is the group of pala.desktop holding the slicer's settings.
+const slicerGroup = "SlicerArgs"
+
+// reNumberedKey matches slicer settings with a legacy position prefix.
+var reNumberedKey = regexp.MustCompile(`^\d{3}_(.+)$`)
+
+func (v FormatVersion) String() string {
+	switch v {
+	case FormatLegacy:
+		return "1.x"
+	case FormatModern:
+		return "2.x"
+	}
+	return "unknown"
+}
+
+// formatVersion works out which layout d has.
+func (d *desktopFile) formatVersion() FormatVersion {
+	v := FormatUnknown
+	for _, l := range d.lines {
+		if !l.isKey {
+			continue
+		}
+		numbered := reNumberedKey.MatchString(l.key)
+		switch {
+		case numbered || (l.group != slicerGroup && isSlicerKey(l.key)):
+			return FormatLegacy
+		case l.group == slicerGroup:
+			v = FormatModern
+		}
+	}
+	return v
+}
+
+// isSlicerKey reports whether key (without any position prefix) is one of
+// the slicer settings that Palapeli's standard slicers use.
+func isSlicerKey(key string) bool {
+	switch key {
+	case "PieceCount", "Flexibility", "PlugSize":
+		return true
+	}
+	return false
+}
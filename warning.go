@@ -0,0 +1,284 @@
+package palapuzzle
+
+import (
+	"errors"
+	"fmt"
+)
+
+// A WarningKind says what sort of problem a Warning describes. Each kind is
+// also an error, so that errors.Is(w, WarnMissingPiece) is true of any
+// Warning w of that kind.
+//
+// Kinds are part of this package's stable API: the value and code of an
+// existing kind will never change, and neither will be reused if a kind is
+// ever withdrawn. FindingCodes lists them all.
+type WarningKind int
+
+const (
+	// A piece file N.png is missing, although higher-numbered ones exist;
+	// or a long run of them is, from "piece" to "last"
+	WarnMissingPiece WarningKind = iota + 1
+	// There is more than one member named N.png
+	WarnDuplicatePiece
+	// The PieceCount in pala.desktop is not a number
+	WarnBadPieceCount
+	// The archive is cut short or corrupt, and was only read up to there
+	WarnTruncated
+	// A member is named like a piece, N.png, but N is too large to be one
+	WarnBadPieceName
+	// A member is not a piece, image.jpg or pala.desktop
+	WarnUnknownMember
+	// The member image.jpg is not a JPEG image
+	WarnImageFormat
+	// There is no pala.desktop
+	WarnNoDesktop
+	// The PieceCount in pala.desktop is not how many pieces there are
+	// (found by Validate)
+	WarnPieceCountMismatch
+	// A piece has no offset in pala.desktop (found by Validate)
+	WarnMissingOffset
+	// A piece file cannot be decoded as a PNG image (found under the
+	// DeepCheck option, and by Validate)
+	WarnBadPiece
+	// The member image.jpg is a damaged JPEG image (found under the
+	// DeepCheck option, and by Validate)
+	WarnBadImage
+	// A member's name climbs out of the archive ("../x") or is absolute, or
+	// it is a link or device rather than a file
+	WarnUnsafeMember
+	// There is data after the end of the archive
+	WarnTrailingData
+	// A member does not match the CHECKSUMS member
+	WarnChecksum
+	// Several pieces have identical content (found under the HashMembers
+	// option)
+	WarnIdenticalPieces
+)
+
+// A Severity says how much a kind of finding matters.
+type Severity int
+
+const (
+	// Worth knowing, but nothing is wrong with the puzzle as such
+	SeverityNotice Severity = iota
+	// Something is off, but the puzzle can still be played
+	SeverityWarning
+	// The puzzle is incomplete or damaged
+	SeverityError
+)
+
+func (s Severity) String() string {
+	switch s {
+	case SeverityNotice:
+		return "notice"
+	case SeverityWarning:
+		return "warning"
+	case SeverityError:
+		return "error"
+	}
+	return fmt.Sprintf("Severity(%d)", int(s))
+}
+
+// MarshalText encodes s as its name, like "warning".
+func (s Severity) MarshalText() ([]byte, error) {
+	return []byte(s.String()), nil
+}
+
+// A FindingCode describes one kind of finding this package can report.
+type FindingCode struct {
+	Kind        WarningKind `json:"-"`
+	Code        string      `json:"code"`        // Stable identifier, like "missing-piece"
+	Name        string      `json:"name"`        // Short description, like "missing piece"
+	Description string      `json:"description"` // A sentence or two for documentation
+	Severity    Severity    `json:"severity"`
+	// The names of the Params that findings of this kind have
+	Params []string `json:"params"`
+}
+
+// findingCodes lists every WarningKind, in order.
+var findingCodes = []FindingCode{
+	{WarnMissingPiece, "missing-piece", "missing piece",
+		"A piece file N.png is missing, although higher-numbered pieces exist; a long run of missing pieces gets one finding for the lot.",
+		SeverityError, []string{"piece", "last"}},
+	{WarnDuplicatePiece, "duplicate-piece", "duplicate piece",
+		"More than one member of the archive is named N.png for the same N.",
+		SeverityWarning, []string{"piece", "count"}},
+	{WarnBadPieceCount, "bad-piece-count", "bad PieceCount",
+		"The PieceCount key in pala.desktop does not hold a number.",
+		SeverityWarning, []string{"value"}},
+	{WarnTruncated, "truncated", "truncated archive",
+		"The archive is cut short or corrupt; what came before the damage was read, as the BestEffort option allows.",
+		SeverityError, []string{"member", "error"}},
+	{WarnBadPieceName, "bad-piece-name", "bad piece name",
+		"A member is named like a piece, N.png, but N is too large to be a piece number; the Lenient option ignores it.",
+		SeverityWarning, []string{"member"}},
+	{WarnUnknownMember, "unknown-member", "unknown member",
+		"A member of the archive is not a piece, image.jpg or pala.desktop; only reported under the ReportUnknownMembers option.",
+		SeverityNotice, []string{"member", "size"}},
+	{WarnImageFormat, "image-format", "image not JPEG",
+		"The member image.jpg holds an image in some other format, or one which cannot be decoded; Palapeli may not show it.",
+		SeverityWarning, []string{"format"}},
+	{WarnNoDesktop, "no-desktop", "no pala.desktop",
+		"The archive has no pala.desktop, so Palapeli cannot load it, and it has no title, author or piece offsets. The RequireDesktop option makes it an error.",
+		SeverityError, []string{}},
+	{WarnPieceCountMismatch, "piece-count-mismatch", "wrong PieceCount",
+		"The PieceCount in pala.desktop differs from the number of pieces in the archive.",
+		SeverityWarning, []string{"declared", "found"}},
+	{WarnMissingOffset, "missing-offset", "missing piece offset",
+		"A piece has no offset in the PieceOffsets group of pala.desktop, so it cannot be put in place; a finding without a piece means no piece has one.",
+		SeverityWarning, []string{"piece"}},
+	{WarnBadPiece, "bad-piece", "bad piece image",
+		"A piece file N.png cannot be decoded as a PNG image.",
+		SeverityError, []string{"piece", "error"}},
+	{WarnBadImage, "bad-image", "bad image.jpg",
+		"The member image.jpg is a JPEG image which is cut short or cannot be decoded, so there is no preview.",
+		SeverityWarning, []string{"error"}},
+	{WarnUnsafeMember, "unsafe-member", "unsafe member",
+		"A member's name contains \"..\" or is an absolute path, or the member is a link or device; unpacking it could write outside the destination. The puzzle may have been tampered with.",
+		SeverityError, []string{"member", "reason"}},
+	{WarnTrailingData, "trailing-data", "trailing data",
+		"There is data after the end of the archive, as when files are joined by mistake; Palapeli ignores it, but other tools may not. The RejectTrailingData option makes it an error.",
+		SeverityWarning, []string{"where"}},
+	{WarnChecksum, "checksum", "checksum mismatch",
+		"The CHECKSUMS member (see WriteChecksums) gives a different SHA-256 sum for a member, or does not list it, or lists a member which is missing; the puzzle has been damaged or changed since its checksums were written. The reason is \"mismatch\", \"unlisted\" or \"missing\", or \"malformed\" or \"not first\" for the CHECKSUMS member itself.",
+		SeverityError, []string{"member", "reason"}},
+	{WarnIdenticalPieces, "identical-pieces", "identical pieces",
+		"Several piece files N.png have the same content, as some buggy slicers write, so the puzzle cannot be put together; \"pieces\" lists their numbers, separated by commas.",
+		SeverityError, []string{"pieces"}},
+}
+
+// FindingCodes returns a description of every kind of finding that this
+// package can report, in the order of their WarningKind values. Frontends
+// can use it to build filters, and documentation to list them.
+func FindingCodes() []FindingCode {
+	return append([]FindingCode(nil), findingCodes...)
+}
+
+func (k WarningKind) info() (FindingCode, bool) {
+	if k >= 1 && int(k) <= len(findingCodes) {
+		return findingCodes[k-1], true
+	}
+	return FindingCode{}, false
+}
+
+func (k WarningKind) String() string {
+	if fc, ok := k.info(); ok {
+		return fc.Name
+	}
+	return "unknown warning"
+}
+
+// Severity returns how much findings of kind k matter.
+func (k WarningKind) Severity() Severity {
+	fc, _ := k.info()
+	return fc.Severity
+}
+
+// Code returns k's stable identifier, like "missing-piece".
+func (k WarningKind) Code() string {
+	if fc, ok := k.info(); ok {
+		return fc.Code
+	}
+	return "unknown"
+}
+
+// KindForCode returns the WarningKind whose code is code.
+func KindForCode(code string) (WarningKind, bool) {
+	for _, fc := range findingCodes {
+		if fc.Code == code {
+			return fc.Kind, true
+		}
+	}
+	return 0, false
+}
+
+// MarshalText encodes k as its code, so that kinds appear as "missing-piece"
+// and so on in JSON.
+func (k WarningKind) MarshalText() ([]byte, error) {
+	if _, ok := k.info(); !ok {
+		return nil, fmt.Errorf("palapuzzle: unknown WarningKind %d", int(k))
+	}
+	return []byte(k.Code()), nil
+}
+
+// UnmarshalText decodes a code produced by MarshalText.
+func (k *WarningKind) UnmarshalText(text []byte) error {
+	kind, ok := KindForCode(string(text))
+	if !ok {
+		return fmt.Errorf("palapuzzle: unknown finding code %q", text)
+	}
+	*k = kind
+	return nil
+}
+
+func (k WarningKind) Error() string { return "palapuzzle: " + k.String() }
+
+// A Warning describes a problem with a puzzle which did not stop it being
+// scanned.
+type Warning struct {
+	Kind WarningKind
+	Text string // Details, suitable for display
+	// The details as data, by names which the kind's FindingCode lists:
+	// "piece" for the piece number of a missing piece, say. Numbers are
+	// written in decimal.
+	Params map[string]string
+}
+
+// Severity returns how much w matters, which depends only on its kind.
+func (w Warning) Severity() Severity { return w.Kind.Severity() }
+
+func (w Warning) String() string { return w.Text }
+
+func (w Warning) Error() string { return w.Text }
+
+// Is reports whether target is w's kind, for the benefit of errors.Is.
+func (w Warning) Is(target error) bool {
+	k, ok := target.(WarningKind)
+	return ok && k == w.Kind
+}
+
+// AsWarning reports whether err is (or wraps) a Warning, and if so returns it.
+func AsWarning(err error) (Warning, bool) {
+	var w Warning
+	ok := errors.As(err, &w)
+	return w, ok
+}
+
+// HasWarning reports whether pi has any warnings of the given kind.
+func HasWarning(pi *PuzzleInfo, kind WarningKind) bool {
+	for _, w := range pi.Warnings {
+		if w.Kind == kind {
+			return true
+		}
+	}
+	return false
+}
+
+// WarningsOf returns pi's warnings of the given kind.
+func (pi *PuzzleInfo) WarningsOf(kind WarningKind) []Warning {
+	var ret []Warning
+	for _, w := range pi.Warnings {
+		if w.Kind == kind {
+			ret = append(ret, w)
+		}
+	}
+	return ret
+}
+
+// warn adds a warning of the given kind to pi, as newWarning makes it.
+func (pi *PuzzleInfo) warn(kind WarningKind, text string, params ...string) {
+	pi.Warnings = append(pi.Warnings, newWarning(kind, text, params...))
+}
+
+// newWarning returns a warning of the given kind, with params given as
+// pairs of names and values.
+func newWarning(kind WarningKind, text string, params ...string) Warning {
+	var m map[string]string
+	if len(params) > 0 {
+		m = make(map[string]string, len(params)/2)
+		for i := 0; i+1 < len(params); i += 2 {
+			m[params[i]] = params[i+1]
+		}
+	}
+	return Warning{kind, text, m}
+}